@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/keleustes/armada-crd/pkg/apis"
 	"github.com/keleustes/oslc-operator/pkg/controller"
 	"github.com/keleustes/oslc-operator/pkg/k8sutil"
+	"github.com/keleustes/oslc-operator/pkg/services"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -27,6 +29,13 @@ func printVersion() {
 }
 
 func main() {
+	var kindOrderConfig string
+	flag.StringVar(&kindOrderConfig, "kind-order-config", "",
+		"Yaml file overriding the order in which the kinds of sub resources are installed and uninstalled")
+	var syncWavePollPeriod time.Duration
+	flag.DurationVar(&syncWavePollPeriod, "sync-wave-poll-period", services.DefaultSyncWavePollPeriod,
+		"Period at which the sub resources which are not all applied and healthy yet are checked (0 to disable)")
+
 	opts := zap.Options{}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
@@ -40,6 +49,16 @@ func main() {
 
 	printVersion()
 
+	sorter := services.DefaultKindSorter
+	if kindOrderConfig != "" {
+		loaded, err := services.LoadSortOrderConfig(kindOrderConfig)
+		if err != nil {
+			log.Error(err, "Failed to load kind ordering", "file", kindOrderConfig)
+			os.Exit(1)
+		}
+		sorter = loaded
+	}
+
 	namespace, err := k8sutil.GetWatchNamespace()
 	if err != nil {
 		log.Error(err, "Failed to get watch namespace")
@@ -80,7 +99,7 @@ func main() {
 	}
 
 	// Setup all Controllers
-	if err := controller.AddToManager(mgr); err != nil {
+	if err := controller.AddToManager(mgr, sorter, syncWavePollPeriod); err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
@@ -1,16 +1,21 @@
 package controller
 
 import (
+	"time"
+
+	"github.com/keleustes/oslc-operator/pkg/services"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 // AddToManagerFuncs is a list of functions to add all Controllers to the Manager
-var AddToManagerFuncs []func(manager.Manager) error
+var AddToManagerFuncs []func(manager.Manager, services.KindSorter, time.Duration) error
 
-// AddToManager adds all Controllers to the Manager
-func AddToManager(m manager.Manager) error {
+// AddToManager adds all Controllers to the Manager. The controllers sort the
+// sub resources by kind with sorter, and check the sub resources which are not
+// all applied and healthy yet every syncWavePollPeriod.
+func AddToManager(m manager.Manager, sorter services.KindSorter, syncWavePollPeriod time.Duration) error {
 	for _, f := range AddToManagerFuncs {
-		if err := f(m); err != nil {
+		if err := f(m, sorter, syncWavePollPeriod); err != nil {
 			return err
 		}
 	}
@@ -40,6 +40,7 @@ type BaseReconciler struct {
 	recorder                record.EventRecorder
 	managerFactory          services.OslcManagerFactory
 	reconcilePeriod         time.Duration
+	syncWavePollPeriod      time.Duration
 	depResourceWatchUpdater services.DependentResourceWatchUpdater
 }
 
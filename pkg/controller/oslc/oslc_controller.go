@@ -16,7 +16,10 @@ package oslc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
 	oslcmgr "github.com/keleustes/oslc-operator/pkg/oslc"
@@ -37,20 +40,21 @@ var oslclog = logf.Log.WithName("oslc-controller")
 
 // AddOslcController creates a new Oslc Controller and adds it to
 // the Manager. The Manager will set fields on the Controller and Start it when
-// the Manager is Started.
-func AddOslcController(mgr manager.Manager) error {
-	return addOslc(mgr, newOslcReconciler(mgr))
+// the Manager is Started. The sub resources are sorted by kind with sorter.
+func AddOslcController(mgr manager.Manager, sorter services.KindSorter, syncWavePollPeriod time.Duration) error {
+	return addOslc(mgr, newOslcReconciler(mgr, sorter, syncWavePollPeriod))
 }
 
 // newOslcReconciler returns a new reconcile.Reconciler
-func newOslcReconciler(mgr manager.Manager) reconcile.Reconciler {
+func newOslcReconciler(mgr manager.Manager, sorter services.KindSorter, syncWavePollPeriod time.Duration) reconcile.Reconciler {
 	r := &OslcReconciler{
 		BaseReconciler: BaseReconciler{
 			client:         mgr.GetClient(),
 			scheme:         mgr.GetScheme(),
 			recorder:       mgr.GetEventRecorderFor("oslc-recorder"),
-			managerFactory: oslcmgr.NewManagerFactory(mgr),
+			managerFactory: oslcmgr.NewManagerFactory(mgr, sorter),
 			// reconcilePeriod: flags.ReconcilePeriod,
+			syncWavePollPeriod: syncWavePollPeriod,
 		},
 	}
 	return r
@@ -116,7 +120,8 @@ func (r *OslcReconciler) Reconcile(ctx context.Context, request reconcile.Reques
 	instance.SetNamespace(request.Namespace)
 	instance.SetName(request.Name)
 
-	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	extension := services.OslcSpecExtension{}
+	err := services.GetOslc(context.TODO(), r.client, request.NamespacedName, instance, &extension)
 	instance.Init()
 
 	if apierrors.IsNotFound(err) {
@@ -130,7 +135,12 @@ func (r *OslcReconciler) Reconcile(ctx context.Context, request reconcile.Reques
 		return reconcile.Result{}, err
 	}
 
-	mgr := r.managerFactory.NewOslcManager(instance)
+	if rolledBack, err := r.rollbackOslc(instance, extension); rolledBack {
+		// The update of the spec triggers another reconcile
+		return reconcile.Result{}, err
+	}
+
+	mgr := r.managerFactory.NewOslcManager(instance, extension)
 	reclog = reclog.WithValues("oslc", mgr.ResourceName())
 
 	var shouldRequeue bool
@@ -143,7 +153,7 @@ func (r *OslcReconciler) Reconcile(ctx context.Context, request reconcile.Reques
 		if !instance.IsDeleted() {
 			// TODO(jeb): Changed the behavior to stop only if we are not
 			// in a delete phase.
-			return reconcile.Result{}, err
+			return services.ReconcileResult(err, r.reconcilePeriod)
 		}
 	}
 
@@ -152,7 +162,7 @@ func (r *OslcReconciler) Reconcile(ctx context.Context, request reconcile.Reques
 			// Need to requeue because finalizer update does not change metadata.generation
 			return reconcile.Result{Requeue: true}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
 	if instance.IsTargetStateUninitialized() {
@@ -161,7 +171,7 @@ func (r *OslcReconciler) Reconcile(ctx context.Context, request reconcile.Reques
 		if err != nil {
 			return reconcile.Result{}, err
 		}
-		err = r.client.Status().Update(context.TODO(), instance)
+		err = r.updateResourceStatus(instance)
 		return reconcile.Result{}, err
 	}
 
@@ -171,33 +181,66 @@ func (r *OslcReconciler) Reconcile(ctx context.Context, request reconcile.Reques
 	}
 	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
 
+	if services.IsDryRun(instance) {
+		err = r.planOslc(mgr, instance)
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	}
+	instance.Status.RemoveCondition(services.ConditionDryRun)
+
+	if err := r.recordOslcRevision(mgr, instance); err != nil {
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	}
+
+	suspended := services.IsFlowSuspended(instance, extension)
+	switch {
+	case services.IsFlowResumeRequested(instance),
+		!suspended && hasCondition(instance, services.ConditionSuspended, av1.ConditionStatusTrue):
+		// Released by the ResumeAnnotation, or once spec.suspend and the SuspendAnnotation are unset
+		err = r.resumeOslc(mgr, instance, extension)
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	case services.IsFlowAbortRequested(instance):
+		err = r.abortOslc(mgr, instance)
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	case suspended:
+		// The running steps of the native engine keep being checked
+		err = r.suspendOslc(mgr, instance)
+		return services.ReconcileResult(err, services.FlowRequeuePeriod(mgr.FlowStatus(), r.reconcilePeriod))
+	}
+
 	switch {
 	case !mgr.IsInstalled():
 		if shouldRequeue, err = r.installOslc(mgr, instance); shouldRequeue {
-			return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+			// The next sync waves are applied by the next reconciles
+			period := services.FlowRequeuePeriod(mgr.FlowStatus(), r.reconcilePeriod)
+			return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(true, period, r.syncWavePollPeriod)}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	case mgr.IsUpdateRequired():
 		if shouldRequeue, err = r.updateOslc(mgr, instance); shouldRequeue {
-			return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+			period := services.FlowRequeuePeriod(mgr.FlowStatus(), r.reconcilePeriod)
+			return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(true, period, r.syncWavePollPeriod)}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
 	if err := r.reconcileOslc(mgr, instance); err != nil {
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
 	reclog.Info("Reconciled Oslc")
 	err = r.updateResourceStatus(instance)
-	return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+	return reconcile.Result{RequeueAfter: services.FlowRequeuePeriod(mgr.FlowStatus(), r.reconcilePeriod)}, err
 }
 
-// logAndRecordFailure adds a failure event to the recorder
+// logAndRecordFailure adds a failure event to the recorder, followed by one
+// event per sub resource which failed
 func (r OslcReconciler) logAndRecordFailure(instance *av1.Oslc, hrc *av1.LcmResourceCondition, err error) {
 	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name)
 	reclog.Error(err, fmt.Sprintf("%s. ErrorCondition", hrc.Type.String()))
 	r.recorder.Event(instance, corev1.EventTypeWarning, hrc.Type.String(), hrc.Reason.String())
+	for _, resErr := range services.ResourceErrors(err) {
+		r.recorder.Event(instance, corev1.EventTypeWarning, hrc.Type.String(), resErr.Error())
+	}
 }
 
 // logAndRecordSuccess adds a success event to the recorder
@@ -207,12 +250,14 @@ func (r OslcReconciler) logAndRecordSuccess(instance *av1.Oslc, hrc *av1.LcmReso
 	r.recorder.Event(instance, corev1.EventTypeNormal, hrc.Type.String(), hrc.Reason.String())
 }
 
-// updateResource updates the Resource object in the cluster
+// updateResource updates the Resource object in the cluster, preserving the extension of its spec
 func (r OslcReconciler) updateResource(instance *av1.Oslc) error {
-	return r.client.Update(context.TODO(), instance)
+	return services.UpdateOslc(context.TODO(), r.client, instance, nil)
 }
 
-// updateResourceStatus updates the the Status field of the Resource object in the cluster
+// updateResourceStatus patches the Status field of the Resource object in the cluster.
+// The write is skipped when the status did not change and fails on conflict when
+// the Resource has been modified since it was read.
 func (r OslcReconciler) updateResourceStatus(instance *av1.Oslc) error {
 	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name)
 
@@ -221,10 +266,9 @@ func (r OslcReconciler) updateResourceStatus(instance *av1.Oslc) error {
 
 	// JEB: Be sure to have update status subresources in the CRD.yaml
 	// JEB: Look for kubebuilder subresources in the _types.go
-	err := r.client.Status().Update(context.TODO(), instance)
+	err := services.PatchStatus(context.TODO(), r.client, instance)
 	if err != nil {
-		reclog.Error(err, "Failure to update status. Ignoring")
-		err = nil
+		reclog.Error(err, "Failure to update status")
 	}
 
 	return err
@@ -232,11 +276,16 @@ func (r OslcReconciler) updateResourceStatus(instance *av1.Oslc) error {
 
 // ensureSynced checks that the OslcManager is in sync with the cluster
 func (r OslcReconciler) ensureSynced(mgr services.OslcManager, instance *av1.Oslc) error {
-	if err := mgr.SyncResource(context.TODO()); err != nil {
+	err := mgr.SyncResource(context.TODO())
+	for _, adopted := range mgr.AdoptedResources() {
+		r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonAdopted,
+			fmt.Sprintf("Adopted %s %s/%s", adopted.GetKind(), adopted.GetNamespace(), adopted.GetName()))
+	}
+	if err != nil {
 		hrc := av1.LcmResourceCondition{
 			Type:    av1.ConditionIrreconcilable,
 			Status:  av1.ConditionStatusTrue,
-			Reason:  av1.ReasonReconcileError,
+			Reason:  services.ConditionReason(err, av1.ReasonReconcileError),
 			Message: err.Error(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
@@ -248,15 +297,70 @@ func (r OslcReconciler) ensureSynced(mgr services.OslcManager, instance *av1.Osl
 	return nil
 }
 
+// rollbackOslc restores the spec of the revision the spec.rollbackTo or the RollbackToAnnotation
+// of instance points to and sets its flow kind to rollback. It returns true if instance has been
+// updated, in which case both have been cleared.
+func (r OslcReconciler) rollbackOslc(instance *av1.Oslc, current services.OslcSpecExtension) (bool, error) {
+	revision, ok := services.GetRollbackRevision(instance, current)
+	if !ok || instance.IsDeleted() {
+		return false, nil
+	}
+	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name, "revision", revision)
+	reclog.Info("Rolling back")
+
+	revisions, err := services.ListRevisions(context.TODO(), r.client, instance)
+	if err != nil {
+		return false, err
+	}
+
+	var snapshot *services.RevisionSnapshot
+	var extension *services.OslcSpecExtension
+	if recorded := services.FindRevision(revisions, revision); recorded == nil {
+		err = fmt.Errorf("revision %d not found", revision)
+	} else if snapshot, err = services.RevisionSnapshotOf(recorded); err == nil {
+		if extension, err = services.RestoreRevision(instance, snapshot); err == nil {
+			// A suspended flow stays suspended
+			extension.Suspend = current.Suspend
+		}
+	}
+
+	if err != nil {
+		annotations := instance.GetAnnotations()
+		delete(annotations, services.RollbackToAnnotation)
+		instance.SetAnnotations(annotations)
+		current.RollbackTo = nil
+		if err := services.UpdateOslc(context.TODO(), r.client, instance, &current); err != nil {
+			return true, err
+		}
+
+		hrc := av1.LcmResourceCondition{
+			Type:    av1.ConditionError,
+			Status:  av1.ConditionStatusTrue,
+			Reason:  av1.LcmResourceConditionReason(services.ReasonRollbackError),
+			Message: err.Error(),
+		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, err)
+		_ = r.updateResourceStatus(instance)
+		return true, err
+	}
+
+	if err := services.UpdateOslc(context.TODO(), r.client, instance, extension); err != nil {
+		return true, err
+	}
+	reclog.Info("Restored revision", "version", extension.TargetVersion)
+	r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonRollbackStarted,
+		fmt.Sprintf("Rolling back to revision %d (version %q)", revision, extension.TargetVersion))
+	return true, nil
+}
+
 // updateFinalizers asserts that the finalizers match what is expected based on
 // whether the instance is currently being deleted or not. It returns true if
 // the finalizers were changed, false otherwise
 func (r OslcReconciler) updateFinalizers(instance *av1.Oslc) (bool, error) {
 	pendingFinalizers := instance.GetFinalizers()
 	if !instance.IsDeleted() && !r.contains(pendingFinalizers, finalizerOslc) {
-		finalizers := append(pendingFinalizers, finalizerOslc)
-		instance.SetFinalizers(finalizers)
-		err := r.updateResource(instance)
+		err := services.PatchFinalizer(context.TODO(), r.client, instance, finalizerOslc, true)
 
 		return true, err
 	}
@@ -285,11 +389,11 @@ func (r OslcReconciler) deleteOslc(mgr services.OslcManager, instance *av1.Oslc)
 	}
 
 	uninstalledResource, err := mgr.UninstallResource(context.TODO())
-	if err != nil && err != services.ErrNotFound {
+	if err != nil && !errors.Is(err, services.ErrNotFound) {
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionFailed,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonUninstallError,
+			Reason:       services.ConditionReason(err, av1.ReasonUninstallError),
 			Message:      err.Error(),
 			ResourceName: uninstalledResource.GetName(),
 		}
@@ -301,7 +405,7 @@ func (r OslcReconciler) deleteOslc(mgr services.OslcManager, instance *av1.Oslc)
 	}
 	instance.Status.RemoveCondition(av1.ConditionFailed)
 
-	if err == services.ErrNotFound {
+	if errors.Is(err, services.ErrNotFound) {
 		reclog.Info("Resource already uninstalled, Removing finalizer")
 	} else {
 		hrc := av1.LcmResourceCondition{
@@ -316,16 +420,247 @@ func (r OslcReconciler) deleteOslc(mgr services.OslcManager, instance *av1.Oslc)
 		return false, err
 	}
 
-	finalizers := []string{}
-	for _, pendingFinalizer := range pendingFinalizers {
-		if pendingFinalizer != finalizerOslc {
-			finalizers = append(finalizers, pendingFinalizer)
+	err = services.PatchFinalizer(context.TODO(), r.client, instance, finalizerOslc, false)
+
+	return true, err
+}
+
+// recordOslcRevision records a ControllerRevision of the spec of instance if it
+// changed, and the current and previous revision numbers in its status and conditions
+func (r OslcReconciler) recordOslcRevision(mgr services.OslcManager, instance *av1.Oslc) error {
+	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name)
+
+	history, err := mgr.RecordRevision(context.TODO())
+	if err != nil {
+		hrc := av1.LcmResourceCondition{
+			Type:    services.ConditionRevision,
+			Status:  av1.ConditionStatusTrue,
+			Reason:  services.ConditionReason(err, services.ReasonRevisionError),
+			Message: err.Error(),
 		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, err)
+
+		_ = r.updateResourceStatus(instance)
+		return err
+	}
+	if err := services.PatchRevisionStatus(context.TODO(), r.client, instance, *history); err != nil {
+		reclog.Error(err, "Failure to update revision status")
+		return err
 	}
-	instance.SetFinalizers(finalizers)
-	err = r.updateResource(instance)
 
-	return true, err
+	hrc := av1.LcmResourceCondition{
+		Type:    services.ConditionRevision,
+		Status:  av1.ConditionStatusTrue,
+		Reason:  services.ReasonRevisionRecorded,
+		Message: history.String(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	if history.Created {
+		reclog.Info("Recorded revision", "revision", history.Current)
+		r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonRevisionRecorded,
+			fmt.Sprintf("Recorded revision %d", history.Current))
+	}
+	return nil
+}
+
+// planOslc records the plan of the actions the install or update of instance
+// would perform, without performing them
+func (r OslcReconciler) planOslc(mgr services.OslcManager, instance *av1.Oslc) error {
+	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name)
+	reclog.Info("Planning")
+
+	plan, err := mgr.PlanResource(context.TODO())
+	if err != nil {
+		hrc := av1.LcmResourceCondition{
+			Type:    services.ConditionDryRun,
+			Status:  av1.ConditionStatusTrue,
+			Reason:  services.ConditionReason(err, services.ReasonDryRunError),
+			Message: err.Error(),
+		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, err)
+
+		_ = r.updateResourceStatus(instance)
+		return err
+	}
+
+	hrc := av1.LcmResourceCondition{
+		Type:    services.ConditionDryRun,
+		Status:  av1.ConditionStatusTrue,
+		Reason:  services.ReasonDryRunSuccessful,
+		Message: services.FormatPlan(plan),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	instance.Status.Reason = services.PlanSummary(plan)
+	r.logAndRecordSuccess(instance, &hrc)
+
+	return r.updateResourceStatus(instance)
+}
+
+// recordApprovals records the approval gates of the flow in the Approval condition and
+// emits an event for each approval which has just been granted or has just expired
+func (r OslcReconciler) recordApprovals(instance *av1.Oslc, flow *services.FlowStatus, reconciledResource *av1.LifecycleFlow) {
+	if len(flow.Approvals) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(flow.Approvals))
+	for _, approval := range flow.Approvals {
+		lines = append(lines, approval.String())
+		switch {
+		case approval.Changed && approval.Granted:
+			r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonApprovalGranted, approval.String())
+		case approval.Changed && approval.Expired:
+			r.recorder.Event(instance, corev1.EventTypeWarning, services.ReasonApprovalExpired, approval.String())
+		}
+	}
+
+	reason := services.ReasonApprovalGranted
+	status := av1.ConditionStatusTrue
+	if flow.PendingApprovals() != 0 {
+		reason = services.ReasonApprovalPending
+		status = av1.ConditionStatusFalse
+	}
+	hrc := av1.LcmResourceCondition{
+		Type:         services.ConditionApproval,
+		Status:       status,
+		Reason:       av1.LcmResourceConditionReason(reason),
+		Message:      strings.Join(lines, "\n"),
+		ResourceName: reconciledResource.GetName(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+}
+
+// suspendOslc holds the flow of instance. Nothing is installed, updated or reconciled
+// while spec.suspend or the SuspendAnnotation is set.
+func (r OslcReconciler) suspendOslc(mgr services.OslcManager, instance *av1.Oslc) error {
+	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name)
+	reclog.Info("Suspending")
+
+	if err := mgr.SuspendFlow(context.TODO(), true); err != nil {
+		return r.recordFlowControlFailure(instance, services.ConditionSuspended, err)
+	}
+
+	if !hasCondition(instance, services.ConditionSuspended, av1.ConditionStatusTrue) {
+		hrc := av1.LcmResourceCondition{
+			Type:         services.ConditionSuspended,
+			Status:       av1.ConditionStatusTrue,
+			Reason:       services.ReasonFlowSuspended,
+			Message:      "flow suspended",
+			ResourceName: mgr.ResourceName(),
+		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordSuccess(instance, &hrc)
+	}
+	return r.recordFlowControl(mgr, instance)
+}
+
+// resumeOslc releases the flow of instance, clears its spec.suspend and removes the
+// SuspendAnnotation and the ResumeAnnotation
+func (r OslcReconciler) resumeOslc(mgr services.OslcManager, instance *av1.Oslc, extension services.OslcSpecExtension) error {
+	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name)
+	reclog.Info("Resuming")
+
+	if err := mgr.SuspendFlow(context.TODO(), false); err != nil {
+		return r.recordFlowControlFailure(instance, services.ConditionSuspended, err)
+	}
+	extension.Suspend = false
+	if err := r.removeAnnotations(instance, &extension, services.SuspendAnnotation, services.ResumeAnnotation); err != nil {
+		return err
+	}
+
+	hrc := av1.LcmResourceCondition{
+		Type:         services.ConditionSuspended,
+		Status:       av1.ConditionStatusFalse,
+		Reason:       services.ReasonFlowResumed,
+		Message:      "flow resumed",
+		ResourceName: mgr.ResourceName(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	r.logAndRecordSuccess(instance, &hrc)
+	return r.recordFlowControl(mgr, instance)
+}
+
+// abortOslc terminates the flow of instance and removes the AbortAnnotation. The
+// Phase CRs are left as they are for inspection.
+func (r OslcReconciler) abortOslc(mgr services.OslcManager, instance *av1.Oslc) error {
+	reclog := oslclog.WithValues("namespace", instance.Namespace, "oslc", instance.Name)
+	reclog.Info("Aborting")
+
+	if err := mgr.AbortFlow(context.TODO()); err != nil {
+		return r.recordFlowControlFailure(instance, services.ConditionAborted, err)
+	}
+	if err := r.removeAnnotations(instance, nil, services.AbortAnnotation); err != nil {
+		return err
+	}
+
+	message := "flow aborted"
+	if flow := mgr.FlowStatus(); flow != nil {
+		message = flow.Summary()
+	}
+	hrc := av1.LcmResourceCondition{
+		Type:         services.ConditionAborted,
+		Status:       av1.ConditionStatusTrue,
+		Reason:       services.ReasonFlowAborted,
+		Message:      message,
+		ResourceName: mgr.ResourceName(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	r.logAndRecordSuccess(instance, &hrc)
+	return r.recordFlowControl(mgr, instance)
+}
+
+// recordFlowControl records the progress of the flow of instance, if any, in its status
+func (r OslcReconciler) recordFlowControl(mgr services.OslcManager, instance *av1.Oslc) error {
+	if flow := mgr.FlowStatus(); flow != nil {
+		return r.recordFlowProgress(instance, flow, av1.NewLifecycleFlow(instance.GetNamespace(), mgr.ResourceName()))
+	}
+	return r.updateResourceStatus(instance)
+}
+
+// recordFlowControlFailure records in the condition that the flow of instance could not be
+// suspended, resumed or aborted
+func (r OslcReconciler) recordFlowControlFailure(instance *av1.Oslc, conditionType string, err error) error {
+	hrc := av1.LcmResourceCondition{
+		Type:    av1.LcmResourceConditionType(conditionType),
+		Status:  av1.ConditionStatusFalse,
+		Reason:  services.ConditionReason(err, av1.ReasonReconcileError),
+		Message: err.Error(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	r.logAndRecordFailure(instance, &hrc, err)
+
+	_ = r.updateResourceStatus(instance)
+	return err
+}
+
+// removeAnnotations removes the annotations from instance in the cluster. The extension
+// of its spec is updated as well unless nil.
+func (r OslcReconciler) removeAnnotations(instance *av1.Oslc, extension *services.OslcSpecExtension, keys ...string) error {
+	annotations := instance.GetAnnotations()
+	for _, key := range keys {
+		delete(annotations, key)
+	}
+	instance.SetAnnotations(annotations)
+
+	status := instance.Status
+	if err := services.UpdateOslc(context.TODO(), r.client, instance, extension); err != nil {
+		return err
+	}
+	// The update returns the status stored in the cluster
+	instance.Status = status
+	return nil
+}
+
+// hasCondition returns true if instance has the condition with the status
+func hasCondition(instance *av1.Oslc, conditionType string, status av1.LcmResourceConditionStatus) bool {
+	for _, condition := range instance.Status.Conditions {
+		if condition.Type.String() == conditionType && condition.Status == status {
+			return true
+		}
+	}
+	return false
 }
 
 // installOslc attempts to install instance. It returns true if the reconciler should be re-enqueueed
@@ -340,7 +675,7 @@ func (r OslcReconciler) installOslc(mgr services.OslcManager, instance *av1.Oslc
 		hrc := av1.LcmResourceCondition{
 			Type:    av1.ConditionFailed,
 			Status:  av1.ConditionStatusTrue,
-			Reason:  av1.ReasonInstallError,
+			Reason:  services.ConditionReason(err, av1.ReasonInstallError),
 			Message: err.Error(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
@@ -385,7 +720,7 @@ func (r OslcReconciler) updateOslc(mgr services.OslcManager, instance *av1.Oslc)
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionFailed,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonUpdateError,
+			Reason:       services.ConditionReason(err, av1.ReasonUpdateError),
 			Message:      err.Error(),
 			ResourceName: updatedResource.GetName(),
 		}
@@ -428,7 +763,7 @@ func (r OslcReconciler) reconcileOslc(mgr services.OslcManager, instance *av1.Os
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionIrreconcilable,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonReconcileError,
+			Reason:       services.ConditionReason(err, av1.ReasonReconcileError),
 			Message:      err.Error(),
 			ResourceName: reconciledResource.GetName(),
 		}
@@ -445,6 +780,10 @@ func (r OslcReconciler) reconcileOslc(mgr services.OslcManager, instance *av1.Os
 		return err
 	}
 
+	if flow := mgr.FlowStatus(); flow != nil {
+		return r.recordFlowProgress(instance, flow, reconciledResource)
+	}
+
 	if reconciledResource.IsFailedOrError() {
 		// We reconcile. Everything is ready. The flow is now ok
 		instance.Status.RemoveCondition(av1.ConditionRunning)
@@ -483,3 +822,66 @@ func (r OslcReconciler) reconcileOslc(mgr services.OslcManager, instance *av1.Os
 
 	return nil
 }
+
+// recordFlowProgress records the progress of the flow executed by the native engine in the
+// status of instance. The Oslc is deployed once all the steps completed, in error once one
+// of them failed.
+func (r OslcReconciler) recordFlowProgress(instance *av1.Oslc, flow *services.FlowStatus, reconciledResource *av1.LifecycleFlow) error {
+	reason := services.ReasonFlowRunning
+	switch flow.Phase {
+	case services.FlowStepSucceeded:
+		reason = services.ReasonFlowSucceeded
+	case services.FlowStepFailed:
+		reason = services.ReasonFlowFailed
+	}
+
+	hrc := av1.LcmResourceCondition{
+		Type:         services.ConditionFlow,
+		Status:       av1.ConditionStatusTrue,
+		Reason:       av1.LcmResourceConditionReason(reason),
+		Message:      flow.Format(),
+		ResourceName: reconciledResource.GetName(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	instance.Status.Reason = flow.Summary()
+	if !flow.Phase.IsCompleted() {
+		instance.Status.RemoveCondition(services.ConditionAborted)
+	}
+	r.recordApprovals(instance, flow, reconciledResource)
+	if phase := flow.CurrentPhase(); phase != "" {
+		instance.Status.ActualPhase = phase
+	}
+
+	switch flow.Phase {
+	case services.FlowStepFailed:
+		instance.Status.RemoveCondition(av1.ConditionRunning)
+
+		message := flow.Summary()
+		if failed := flow.FailedStep(); failed != nil {
+			message = failed.String()
+		}
+		hrc := av1.LcmResourceCondition{
+			Type:         av1.ConditionError,
+			Status:       av1.ConditionStatusTrue,
+			Reason:       av1.ReasonUnderlyingResourcesError,
+			Message:      message,
+			ResourceName: reconciledResource.GetName(),
+		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, errors.New(message))
+	case services.FlowStepSucceeded:
+		instance.Status.RemoveCondition(av1.ConditionRunning)
+
+		hrc := av1.LcmResourceCondition{
+			Type:         av1.ConditionDeployed,
+			Status:       av1.ConditionStatusTrue,
+			Reason:       av1.ReasonUnderlyingResourcesReady,
+			Message:      flow.Summary(),
+			ResourceName: reconciledResource.GetName(),
+		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordSuccess(instance, &hrc)
+	}
+
+	return r.updateResourceStatus(instance)
+}
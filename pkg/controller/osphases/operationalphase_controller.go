@@ -16,9 +16,12 @@ package osphases
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"github.com/keleustes/oslc-operator/pkg/health"
 	operationalphasemgr "github.com/keleustes/oslc-operator/pkg/osphases"
 	services "github.com/keleustes/oslc-operator/pkg/services"
 
@@ -37,20 +40,21 @@ var operationalphaselog = logf.Log.WithName("operationalphase-controller")
 
 // AddOperationalPhaseController creates a new OperationalPhase Controller and adds it to
 // the Manager. The Manager will set fields on the Controller and Start it when
-// the Manager is Started.
-func AddOperationalPhaseController(mgr manager.Manager) error {
-	return addOperationalPhase(mgr, newOperationalPhaseReconciler(mgr))
+// the Manager is Started. The sub resources are sorted by kind with sorter.
+func AddOperationalPhaseController(mgr manager.Manager, sorter services.KindSorter, syncWavePollPeriod time.Duration) error {
+	return addOperationalPhase(mgr, newOperationalPhaseReconciler(mgr, sorter, syncWavePollPeriod))
 }
 
 // newOperationalPhaseReconciler returns a new reconcile.Reconciler
-func newOperationalPhaseReconciler(mgr manager.Manager) reconcile.Reconciler {
+func newOperationalPhaseReconciler(mgr manager.Manager, sorter services.KindSorter, syncWavePollPeriod time.Duration) reconcile.Reconciler {
 	r := &OperationalPhaseReconciler{
 		PhaseReconciler: PhaseReconciler{
 			client:         mgr.GetClient(),
 			scheme:         mgr.GetScheme(),
 			recorder:       mgr.GetEventRecorderFor("operationalphase-recorder"),
-			managerFactory: operationalphasemgr.NewManagerFactory(mgr),
+			managerFactory: operationalphasemgr.NewManagerFactory(mgr, sorter),
 			// reconcilePeriod: flags.ReconcilePeriod,
+			syncWavePollPeriod: syncWavePollPeriod,
 		},
 	}
 	return r
@@ -143,7 +147,7 @@ func (r *OperationalPhaseReconciler) Reconcile(ctx context.Context, request reco
 		if !instance.IsDeleted() {
 			// TODO(jeb): Changed the behavior to stop only if we are not
 			// in a delete phase.
-			return reconcile.Result{}, err
+			return services.ReconcileResult(err, r.reconcilePeriod)
 		}
 	}
 
@@ -152,7 +156,7 @@ func (r *OperationalPhaseReconciler) Reconcile(ctx context.Context, request reco
 			// Need to requeue because finalizer update does not change metadata.generation
 			return reconcile.Result{Requeue: true}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
 	if instance.IsTargetStateUninitialized() {
@@ -161,7 +165,7 @@ func (r *OperationalPhaseReconciler) Reconcile(ctx context.Context, request reco
 		if err != nil {
 			return reconcile.Result{}, err
 		}
-		err = r.client.Status().Update(context.TODO(), instance)
+		err = r.updateResourceStatus(instance)
 		return reconcile.Result{}, err
 	}
 
@@ -171,33 +175,49 @@ func (r *OperationalPhaseReconciler) Reconcile(ctx context.Context, request reco
 	}
 	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
 
+	if services.IsDryRun(instance) {
+		err = r.planOperationalPhase(mgr, instance)
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	}
+	instance.Status.RemoveCondition(services.ConditionDryRun)
+
+	if err := r.recordOperationalPhaseRevision(mgr, instance); err != nil {
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	}
+
 	switch {
 	case !mgr.IsInstalled():
 		if shouldRequeue, err = r.installOperationalPhase(mgr, instance); shouldRequeue {
-			return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+			// The next sync waves are applied by the next reconciles
+			return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(true, r.reconcilePeriod, r.syncWavePollPeriod)}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	case mgr.IsUpdateRequired():
 		if shouldRequeue, err = r.updateOperationalPhase(mgr, instance); shouldRequeue {
-			return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+			return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(true, r.reconcilePeriod, r.syncWavePollPeriod)}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
-	if err := r.reconcileOperationalPhase(mgr, instance); err != nil {
-		return reconcile.Result{}, err
+	progressing, err := r.reconcileOperationalPhase(mgr, instance)
+	if err != nil {
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
 	reclog.Info("Reconciled OperationalPhase")
 	err = r.updateResourceStatus(instance)
-	return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+	return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(progressing, r.reconcilePeriod, r.syncWavePollPeriod)}, err
 }
 
-// logAndRecordFailure adds a failure event to the recorder
+// logAndRecordFailure adds a failure event to the recorder, followed by one
+// event per sub resource which failed
 func (r OperationalPhaseReconciler) logAndRecordFailure(instance *av1.OperationalPhase, hrc *av1.LcmResourceCondition, err error) {
 	reclog := operationalphaselog.WithValues("namespace", instance.Namespace, "operationalphase", instance.Name)
 	reclog.Error(err, fmt.Sprintf("%s. ErrorCondition", hrc.Type.String()))
 	r.recorder.Event(instance, corev1.EventTypeWarning, hrc.Type.String(), hrc.Reason.String())
+	for _, resErr := range services.ResourceErrors(err) {
+		r.recorder.Event(instance, corev1.EventTypeWarning, hrc.Type.String(), resErr.Error())
+	}
 }
 
 // logAndRecordSuccess adds a success event to the recorder
@@ -212,7 +232,9 @@ func (r OperationalPhaseReconciler) updateResource(instance *av1.OperationalPhas
 	return r.client.Update(context.TODO(), instance)
 }
 
-// updateResourceStatus updates the the Status field of the Resource object in the cluster
+// updateResourceStatus patches the Status field of the Resource object in the cluster.
+// The write is skipped when the status did not change and fails on conflict when
+// the Resource has been modified since it was read.
 func (r OperationalPhaseReconciler) updateResourceStatus(instance *av1.OperationalPhase) error {
 	reclog := operationalphaselog.WithValues("namespace", instance.Namespace, "operationalphase", instance.Name)
 
@@ -221,10 +243,9 @@ func (r OperationalPhaseReconciler) updateResourceStatus(instance *av1.Operation
 
 	// JEB: Be sure to have update status subresources in the CRD.yaml
 	// JEB: Look for kubebuilder subresources in the _types.go
-	err := r.client.Status().Update(context.TODO(), instance)
+	err := services.PatchStatus(context.TODO(), r.client, instance)
 	if err != nil {
-		reclog.Error(err, "Failure to update status. Ignoring")
-		err = nil
+		reclog.Error(err, "Failure to update status")
 	}
 
 	return err
@@ -232,11 +253,16 @@ func (r OperationalPhaseReconciler) updateResourceStatus(instance *av1.Operation
 
 // ensureSynced checks that the OperationalPhaseManager is in sync with the cluster
 func (r OperationalPhaseReconciler) ensureSynced(mgr services.OperationalPhaseManager, instance *av1.OperationalPhase) error {
-	if err := mgr.SyncResource(context.TODO()); err != nil {
+	err := mgr.SyncResource(context.TODO())
+	for _, adopted := range mgr.AdoptedResources() {
+		r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonAdopted,
+			fmt.Sprintf("Adopted %s %s/%s", adopted.GetKind(), adopted.GetNamespace(), adopted.GetName()))
+	}
+	if err != nil {
 		hrc := av1.LcmResourceCondition{
 			Type:    av1.ConditionIrreconcilable,
 			Status:  av1.ConditionStatusTrue,
-			Reason:  av1.ReasonReconcileError,
+			Reason:  services.ConditionReason(err, av1.ReasonReconcileError),
 			Message: err.Error(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
@@ -254,9 +280,7 @@ func (r OperationalPhaseReconciler) ensureSynced(mgr services.OperationalPhaseMa
 func (r OperationalPhaseReconciler) updateFinalizers(instance *av1.OperationalPhase) (bool, error) {
 	pendingFinalizers := instance.GetFinalizers()
 	if !instance.IsDeleted() && !r.contains(pendingFinalizers, finalizerOperationalPhase) {
-		finalizers := append(pendingFinalizers, finalizerOperationalPhase)
-		instance.SetFinalizers(finalizers)
-		err := r.updateResource(instance)
+		err := services.PatchFinalizer(context.TODO(), r.client, instance, finalizerOperationalPhase, true)
 
 		return true, err
 	}
@@ -285,11 +309,11 @@ func (r OperationalPhaseReconciler) deleteOperationalPhase(mgr services.Operatio
 	}
 
 	uninstalledResource, err := mgr.UninstallResource(context.TODO())
-	if err != nil && err != services.ErrNotFound {
+	if err != nil && !errors.Is(err, services.ErrNotFound) {
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionFailed,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonUninstallError,
+			Reason:       services.ConditionReason(err, av1.ReasonUninstallError),
 			Message:      err.Error(),
 			ResourceName: uninstalledResource.GetName(),
 		}
@@ -301,7 +325,7 @@ func (r OperationalPhaseReconciler) deleteOperationalPhase(mgr services.Operatio
 	}
 	instance.Status.RemoveCondition(av1.ConditionFailed)
 
-	if err == services.ErrNotFound {
+	if errors.Is(err, services.ErrNotFound) {
 		reclog.Info("Resource already uninstalled, Removing finalizer")
 	} else {
 		hrc := av1.LcmResourceCondition{
@@ -316,16 +340,82 @@ func (r OperationalPhaseReconciler) deleteOperationalPhase(mgr services.Operatio
 		return false, err
 	}
 
-	finalizers := []string{}
-	for _, pendingFinalizer := range pendingFinalizers {
-		if pendingFinalizer != finalizerOperationalPhase {
-			finalizers = append(finalizers, pendingFinalizer)
+	err = services.PatchFinalizer(context.TODO(), r.client, instance, finalizerOperationalPhase, false)
+
+	return true, err
+}
+
+// recordOperationalPhaseRevision records a ControllerRevision of the spec of instance if it
+// changed, and the current and previous revision numbers in its status and conditions
+func (r OperationalPhaseReconciler) recordOperationalPhaseRevision(mgr services.OperationalPhaseManager, instance *av1.OperationalPhase) error {
+	reclog := operationalphaselog.WithValues("namespace", instance.Namespace, "operationalphase", instance.Name)
+
+	history, err := mgr.RecordRevision(context.TODO())
+	if err != nil {
+		hrc := av1.LcmResourceCondition{
+			Type:    services.ConditionRevision,
+			Status:  av1.ConditionStatusTrue,
+			Reason:  services.ConditionReason(err, services.ReasonRevisionError),
+			Message: err.Error(),
 		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, err)
+
+		_ = r.updateResourceStatus(instance)
+		return err
+	}
+	if err := services.PatchRevisionStatus(context.TODO(), r.client, instance, *history); err != nil {
+		reclog.Error(err, "Failure to update revision status")
+		return err
 	}
-	instance.SetFinalizers(finalizers)
-	err = r.updateResource(instance)
 
-	return true, err
+	hrc := av1.LcmResourceCondition{
+		Type:    services.ConditionRevision,
+		Status:  av1.ConditionStatusTrue,
+		Reason:  services.ReasonRevisionRecorded,
+		Message: history.String(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	if history.Created {
+		reclog.Info("Recorded revision", "revision", history.Current)
+		r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonRevisionRecorded,
+			fmt.Sprintf("Recorded revision %d", history.Current))
+	}
+	return nil
+}
+
+// planOperationalPhase records the plan of the actions the install or update of instance
+// would perform, without performing them
+func (r OperationalPhaseReconciler) planOperationalPhase(mgr services.OperationalPhaseManager, instance *av1.OperationalPhase) error {
+	reclog := operationalphaselog.WithValues("namespace", instance.Namespace, "operationalphase", instance.Name)
+	reclog.Info("Planning")
+
+	plan, err := mgr.PlanResource(context.TODO())
+	if err != nil {
+		hrc := av1.LcmResourceCondition{
+			Type:    services.ConditionDryRun,
+			Status:  av1.ConditionStatusTrue,
+			Reason:  services.ConditionReason(err, services.ReasonDryRunError),
+			Message: err.Error(),
+		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, err)
+
+		_ = r.updateResourceStatus(instance)
+		return err
+	}
+
+	hrc := av1.LcmResourceCondition{
+		Type:    services.ConditionDryRun,
+		Status:  av1.ConditionStatusTrue,
+		Reason:  services.ReasonDryRunSuccessful,
+		Message: services.FormatPlan(plan),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	instance.Status.Reason = services.PlanSummary(plan)
+	r.logAndRecordSuccess(instance, &hrc)
+
+	return r.updateResourceStatus(instance)
 }
 
 // installOperationalPhase attempts to install instance. It returns true if the reconciler should be re-enqueueed
@@ -340,7 +430,7 @@ func (r OperationalPhaseReconciler) installOperationalPhase(mgr services.Operati
 		hrc := av1.LcmResourceCondition{
 			Type:    av1.ConditionFailed,
 			Status:  av1.ConditionStatusTrue,
-			Reason:  av1.ReasonInstallError,
+			Reason:  services.ConditionReason(err, av1.ReasonInstallError),
 			Message: err.Error(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
@@ -385,7 +475,7 @@ func (r OperationalPhaseReconciler) updateOperationalPhase(mgr services.Operatio
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionFailed,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonUpdateError,
+			Reason:       services.ConditionReason(err, av1.ReasonUpdateError),
 			Message:      err.Error(),
 			ResourceName: updatedResource.GetName(),
 		}
@@ -416,8 +506,9 @@ func (r OperationalPhaseReconciler) updateOperationalPhase(mgr services.Operatio
 	return true, err
 }
 
-// reconcileOperationalPhase reconciles the phases with the flow
-func (r OperationalPhaseReconciler) reconcileOperationalPhase(mgr services.OperationalPhaseManager, instance *av1.OperationalPhase) error {
+// reconcileOperationalPhase reconciles the phases with the flow. It returns true
+// if the sub resources are still progressing
+func (r OperationalPhaseReconciler) reconcileOperationalPhase(mgr services.OperationalPhaseManager, instance *av1.OperationalPhase) (bool, error) {
 	reclog := operationalphaselog.WithValues("namespace", instance.Namespace, "operationalphase", instance.Name)
 	reclog.Info("Reconciling OperationalPhase and LcmResource")
 
@@ -428,7 +519,7 @@ func (r OperationalPhaseReconciler) reconcileOperationalPhase(mgr services.Opera
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionIrreconcilable,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonReconcileError,
+			Reason:       services.ConditionReason(err, av1.ReasonReconcileError),
 			Message:      err.Error(),
 			ResourceName: reconciledResource.GetName(),
 		}
@@ -436,34 +527,37 @@ func (r OperationalPhaseReconciler) reconcileOperationalPhase(mgr services.Opera
 		r.logAndRecordFailure(instance, &hrc, err)
 
 		_ = r.updateResourceStatus(instance)
-		return err
+		return false, err
 	}
 	instance.Status.RemoveCondition(av1.ConditionIrreconcilable)
 
 	if err := r.watchDependentResources(reconciledResource); err != nil {
 		reclog.Error(err, "Failed to update watch on dependent resources")
-		return err
+		return false, err
 	}
 
-	if reconciledResource.IsFailedOrError() {
-		// We reconcile. Everything is ready. The flow is now ok
+	verdict := health.CheckAll(reconciledResource.GetDependentResources())
+	if verdict.IsFailed() {
+		// We reconcile. One of the sub resources failed. The flow is now in error
 		instance.Status.RemoveCondition(av1.ConditionRunning)
 
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionError,
 			Status:       av1.ConditionStatusTrue,
 			Reason:       av1.ReasonUnderlyingResourcesError,
-			Message:      reconciledResource.GetPhaseKind().String(),
+			Message:      verdict.Reason,
 			ResourceName: reconciledResource.GetName(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
-		r.logAndRecordSuccess(instance, &hrc)
+		instance.Status.Reason = verdict.Reason
+		r.logAndRecordFailure(instance, &hrc, errors.New(verdict.Reason))
 
 		err = r.updateResourceStatus(instance)
-		return err
+		return false, err
 	}
+	instance.Status.RemoveCondition(av1.ConditionError)
 
-	if reconciledResource.IsReady() {
+	if verdict.IsReady() {
 		// We reconcile. Everything is ready. The flow is now ok
 		instance.Status.RemoveCondition(av1.ConditionRunning)
 
@@ -478,8 +572,19 @@ func (r OperationalPhaseReconciler) reconcileOperationalPhase(mgr services.Opera
 		r.logAndRecordSuccess(instance, &hrc)
 
 		err = r.updateResourceStatus(instance)
-		return err
+		return false, err
 	}
 
-	return nil
+	// The sub resources are still progressing
+	hrc := av1.LcmResourceCondition{
+		Type:         av1.ConditionRunning,
+		Status:       av1.ConditionStatusTrue,
+		Reason:       services.ReasonUnderlyingResourcesProgressing,
+		Message:      verdict.Reason,
+		ResourceName: reconciledResource.GetName(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	instance.Status.Reason = verdict.Reason
+
+	return true, nil
 }
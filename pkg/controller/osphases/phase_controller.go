@@ -40,6 +40,7 @@ type PhaseReconciler struct {
 	recorder                record.EventRecorder
 	managerFactory          services.PhaseManagerFactory
 	reconcilePeriod         time.Duration
+	syncWavePollPeriod      time.Duration
 	depResourceWatchUpdater services.DependentResourceWatchUpdater
 }
 
@@ -16,9 +16,12 @@ package osphases
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"github.com/keleustes/oslc-operator/pkg/health"
 	rollbackphasemgr "github.com/keleustes/oslc-operator/pkg/osphases"
 	services "github.com/keleustes/oslc-operator/pkg/services"
 
@@ -37,20 +40,21 @@ var rollbackphaselog = logf.Log.WithName("rollbackphase-controller")
 
 // AddRollbackPhaseController creates a new RollbackPhase Controller and adds it to
 // the Manager. The Manager will set fields on the Controller and Start it when
-// the Manager is Started.
-func AddRollbackPhaseController(mgr manager.Manager) error {
-	return addRollbackPhase(mgr, newRollbackPhaseReconciler(mgr))
+// the Manager is Started. The sub resources are sorted by kind with sorter.
+func AddRollbackPhaseController(mgr manager.Manager, sorter services.KindSorter, syncWavePollPeriod time.Duration) error {
+	return addRollbackPhase(mgr, newRollbackPhaseReconciler(mgr, sorter, syncWavePollPeriod))
 }
 
 // newRollbackPhaseReconciler returns a new reconcile.Reconciler
-func newRollbackPhaseReconciler(mgr manager.Manager) reconcile.Reconciler {
+func newRollbackPhaseReconciler(mgr manager.Manager, sorter services.KindSorter, syncWavePollPeriod time.Duration) reconcile.Reconciler {
 	r := &RollbackPhaseReconciler{
 		PhaseReconciler: PhaseReconciler{
 			client:         mgr.GetClient(),
 			scheme:         mgr.GetScheme(),
 			recorder:       mgr.GetEventRecorderFor("rollbackphase-recorder"),
-			managerFactory: rollbackphasemgr.NewManagerFactory(mgr),
+			managerFactory: rollbackphasemgr.NewManagerFactory(mgr, sorter),
 			// reconcilePeriod: flags.ReconcilePeriod,
+			syncWavePollPeriod: syncWavePollPeriod,
 		},
 	}
 	return r
@@ -143,7 +147,7 @@ func (r *RollbackPhaseReconciler) Reconcile(ctx context.Context, request reconci
 		if !instance.IsDeleted() {
 			// TODO(jeb): Changed the behavior to stop only if we are not
 			// in a delete phase.
-			return reconcile.Result{}, err
+			return services.ReconcileResult(err, r.reconcilePeriod)
 		}
 	}
 
@@ -152,7 +156,7 @@ func (r *RollbackPhaseReconciler) Reconcile(ctx context.Context, request reconci
 			// Need to requeue because finalizer update does not change metadata.generation
 			return reconcile.Result{Requeue: true}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
 	if instance.IsTargetStateUninitialized() {
@@ -161,7 +165,7 @@ func (r *RollbackPhaseReconciler) Reconcile(ctx context.Context, request reconci
 		if err != nil {
 			return reconcile.Result{}, err
 		}
-		err = r.client.Status().Update(context.TODO(), instance)
+		err = r.updateResourceStatus(instance)
 		return reconcile.Result{}, err
 	}
 
@@ -171,33 +175,49 @@ func (r *RollbackPhaseReconciler) Reconcile(ctx context.Context, request reconci
 	}
 	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
 
+	if services.IsDryRun(instance) {
+		err = r.planRollbackPhase(mgr, instance)
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	}
+	instance.Status.RemoveCondition(services.ConditionDryRun)
+
+	if err := r.recordRollbackPhaseRevision(mgr, instance); err != nil {
+		return services.ReconcileResult(err, r.reconcilePeriod)
+	}
+
 	switch {
 	case !mgr.IsInstalled():
 		if shouldRequeue, err = r.installRollbackPhase(mgr, instance); shouldRequeue {
-			return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+			// The next sync waves are applied by the next reconciles
+			return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(true, r.reconcilePeriod, r.syncWavePollPeriod)}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	case mgr.IsUpdateRequired():
 		if shouldRequeue, err = r.updateRollbackPhase(mgr, instance); shouldRequeue {
-			return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+			return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(true, r.reconcilePeriod, r.syncWavePollPeriod)}, err
 		}
-		return reconcile.Result{}, err
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
-	if err := r.reconcileRollbackPhase(mgr, instance); err != nil {
-		return reconcile.Result{}, err
+	progressing, err := r.reconcileRollbackPhase(mgr, instance)
+	if err != nil {
+		return services.ReconcileResult(err, r.reconcilePeriod)
 	}
 
 	reclog.Info("Reconciled RollbackPhase")
 	err = r.updateResourceStatus(instance)
-	return reconcile.Result{RequeueAfter: r.reconcilePeriod}, err
+	return reconcile.Result{RequeueAfter: services.SyncWaveRequeuePeriod(progressing, r.reconcilePeriod, r.syncWavePollPeriod)}, err
 }
 
-// logAndRecordFailure adds a failure event to the recorder
+// logAndRecordFailure adds a failure event to the recorder, followed by one
+// event per sub resource which failed
 func (r RollbackPhaseReconciler) logAndRecordFailure(instance *av1.RollbackPhase, hrc *av1.LcmResourceCondition, err error) {
 	reclog := rollbackphaselog.WithValues("namespace", instance.Namespace, "rollbackphase", instance.Name)
 	reclog.Error(err, fmt.Sprintf("%s. ErrorCondition", hrc.Type.String()))
 	r.recorder.Event(instance, corev1.EventTypeWarning, hrc.Type.String(), hrc.Reason.String())
+	for _, resErr := range services.ResourceErrors(err) {
+		r.recorder.Event(instance, corev1.EventTypeWarning, hrc.Type.String(), resErr.Error())
+	}
 }
 
 // logAndRecordSuccess adds a success event to the recorder
@@ -212,7 +232,9 @@ func (r RollbackPhaseReconciler) updateResource(instance *av1.RollbackPhase) err
 	return r.client.Update(context.TODO(), instance)
 }
 
-// updateResourceStatus updates the the Status field of the Resource object in the cluster
+// updateResourceStatus patches the Status field of the Resource object in the cluster.
+// The write is skipped when the status did not change and fails on conflict when
+// the Resource has been modified since it was read.
 func (r RollbackPhaseReconciler) updateResourceStatus(instance *av1.RollbackPhase) error {
 	reclog := rollbackphaselog.WithValues("namespace", instance.Namespace, "rollbackphase", instance.Name)
 
@@ -221,10 +243,9 @@ func (r RollbackPhaseReconciler) updateResourceStatus(instance *av1.RollbackPhas
 
 	// JEB: Be sure to have update status subresources in the CRD.yaml
 	// JEB: Look for kubebuilder subresources in the _types.go
-	err := r.client.Status().Update(context.TODO(), instance)
+	err := services.PatchStatus(context.TODO(), r.client, instance)
 	if err != nil {
-		reclog.Error(err, "Failure to update status. Ignoring")
-		err = nil
+		reclog.Error(err, "Failure to update status")
 	}
 
 	return err
@@ -232,11 +253,16 @@ func (r RollbackPhaseReconciler) updateResourceStatus(instance *av1.RollbackPhas
 
 // ensureSynced checks that the RollbackPhaseManager is in sync with the cluster
 func (r RollbackPhaseReconciler) ensureSynced(mgr services.RollbackPhaseManager, instance *av1.RollbackPhase) error {
-	if err := mgr.SyncResource(context.TODO()); err != nil {
+	err := mgr.SyncResource(context.TODO())
+	for _, adopted := range mgr.AdoptedResources() {
+		r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonAdopted,
+			fmt.Sprintf("Adopted %s %s/%s", adopted.GetKind(), adopted.GetNamespace(), adopted.GetName()))
+	}
+	if err != nil {
 		hrc := av1.LcmResourceCondition{
 			Type:    av1.ConditionIrreconcilable,
 			Status:  av1.ConditionStatusTrue,
-			Reason:  av1.ReasonReconcileError,
+			Reason:  services.ConditionReason(err, av1.ReasonReconcileError),
 			Message: err.Error(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
@@ -254,9 +280,7 @@ func (r RollbackPhaseReconciler) ensureSynced(mgr services.RollbackPhaseManager,
 func (r RollbackPhaseReconciler) updateFinalizers(instance *av1.RollbackPhase) (bool, error) {
 	pendingFinalizers := instance.GetFinalizers()
 	if !instance.IsDeleted() && !r.contains(pendingFinalizers, finalizerRollbackPhase) {
-		finalizers := append(pendingFinalizers, finalizerRollbackPhase)
-		instance.SetFinalizers(finalizers)
-		err := r.updateResource(instance)
+		err := services.PatchFinalizer(context.TODO(), r.client, instance, finalizerRollbackPhase, true)
 
 		return true, err
 	}
@@ -285,11 +309,11 @@ func (r RollbackPhaseReconciler) deleteRollbackPhase(mgr services.RollbackPhaseM
 	}
 
 	uninstalledResource, err := mgr.UninstallResource(context.TODO())
-	if err != nil && err != services.ErrNotFound {
+	if err != nil && !errors.Is(err, services.ErrNotFound) {
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionFailed,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonUninstallError,
+			Reason:       services.ConditionReason(err, av1.ReasonUninstallError),
 			Message:      err.Error(),
 			ResourceName: uninstalledResource.GetName(),
 		}
@@ -301,7 +325,7 @@ func (r RollbackPhaseReconciler) deleteRollbackPhase(mgr services.RollbackPhaseM
 	}
 	instance.Status.RemoveCondition(av1.ConditionFailed)
 
-	if err == services.ErrNotFound {
+	if errors.Is(err, services.ErrNotFound) {
 		reclog.Info("Resource already uninstalled, Removing finalizer")
 	} else {
 		hrc := av1.LcmResourceCondition{
@@ -316,16 +340,82 @@ func (r RollbackPhaseReconciler) deleteRollbackPhase(mgr services.RollbackPhaseM
 		return false, err
 	}
 
-	finalizers := []string{}
-	for _, pendingFinalizer := range pendingFinalizers {
-		if pendingFinalizer != finalizerRollbackPhase {
-			finalizers = append(finalizers, pendingFinalizer)
+	err = services.PatchFinalizer(context.TODO(), r.client, instance, finalizerRollbackPhase, false)
+
+	return true, err
+}
+
+// recordRollbackPhaseRevision records a ControllerRevision of the spec of instance if it
+// changed, and the current and previous revision numbers in its status and conditions
+func (r RollbackPhaseReconciler) recordRollbackPhaseRevision(mgr services.RollbackPhaseManager, instance *av1.RollbackPhase) error {
+	reclog := rollbackphaselog.WithValues("namespace", instance.Namespace, "rollbackphase", instance.Name)
+
+	history, err := mgr.RecordRevision(context.TODO())
+	if err != nil {
+		hrc := av1.LcmResourceCondition{
+			Type:    services.ConditionRevision,
+			Status:  av1.ConditionStatusTrue,
+			Reason:  services.ConditionReason(err, services.ReasonRevisionError),
+			Message: err.Error(),
 		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, err)
+
+		_ = r.updateResourceStatus(instance)
+		return err
+	}
+	if err := services.PatchRevisionStatus(context.TODO(), r.client, instance, *history); err != nil {
+		reclog.Error(err, "Failure to update revision status")
+		return err
 	}
-	instance.SetFinalizers(finalizers)
-	err = r.updateResource(instance)
 
-	return true, err
+	hrc := av1.LcmResourceCondition{
+		Type:    services.ConditionRevision,
+		Status:  av1.ConditionStatusTrue,
+		Reason:  services.ReasonRevisionRecorded,
+		Message: history.String(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	if history.Created {
+		reclog.Info("Recorded revision", "revision", history.Current)
+		r.recorder.Event(instance, corev1.EventTypeNormal, services.ReasonRevisionRecorded,
+			fmt.Sprintf("Recorded revision %d", history.Current))
+	}
+	return nil
+}
+
+// planRollbackPhase records the plan of the actions the install or update of instance
+// would perform, without performing them
+func (r RollbackPhaseReconciler) planRollbackPhase(mgr services.RollbackPhaseManager, instance *av1.RollbackPhase) error {
+	reclog := rollbackphaselog.WithValues("namespace", instance.Namespace, "rollbackphase", instance.Name)
+	reclog.Info("Planning")
+
+	plan, err := mgr.PlanResource(context.TODO())
+	if err != nil {
+		hrc := av1.LcmResourceCondition{
+			Type:    services.ConditionDryRun,
+			Status:  av1.ConditionStatusTrue,
+			Reason:  services.ConditionReason(err, services.ReasonDryRunError),
+			Message: err.Error(),
+		}
+		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+		r.logAndRecordFailure(instance, &hrc, err)
+
+		_ = r.updateResourceStatus(instance)
+		return err
+	}
+
+	hrc := av1.LcmResourceCondition{
+		Type:    services.ConditionDryRun,
+		Status:  av1.ConditionStatusTrue,
+		Reason:  services.ReasonDryRunSuccessful,
+		Message: services.FormatPlan(plan),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	instance.Status.Reason = services.PlanSummary(plan)
+	r.logAndRecordSuccess(instance, &hrc)
+
+	return r.updateResourceStatus(instance)
 }
 
 // installRollbackPhase attempts to install instance. It returns true if the reconciler should be re-enqueueed
@@ -340,7 +430,7 @@ func (r RollbackPhaseReconciler) installRollbackPhase(mgr services.RollbackPhase
 		hrc := av1.LcmResourceCondition{
 			Type:    av1.ConditionFailed,
 			Status:  av1.ConditionStatusTrue,
-			Reason:  av1.ReasonInstallError,
+			Reason:  services.ConditionReason(err, av1.ReasonInstallError),
 			Message: err.Error(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
@@ -385,7 +475,7 @@ func (r RollbackPhaseReconciler) updateRollbackPhase(mgr services.RollbackPhaseM
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionFailed,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonUpdateError,
+			Reason:       services.ConditionReason(err, av1.ReasonUpdateError),
 			Message:      err.Error(),
 			ResourceName: updatedResource.GetName(),
 		}
@@ -416,8 +506,9 @@ func (r RollbackPhaseReconciler) updateRollbackPhase(mgr services.RollbackPhaseM
 	return true, err
 }
 
-// reconcileRollbackPhase reconciles the phases with the flow
-func (r RollbackPhaseReconciler) reconcileRollbackPhase(mgr services.RollbackPhaseManager, instance *av1.RollbackPhase) error {
+// reconcileRollbackPhase reconciles the phases with the flow. It returns true
+// if the sub resources are still progressing
+func (r RollbackPhaseReconciler) reconcileRollbackPhase(mgr services.RollbackPhaseManager, instance *av1.RollbackPhase) (bool, error) {
 	reclog := rollbackphaselog.WithValues("namespace", instance.Namespace, "rollbackphase", instance.Name)
 	reclog.Info("Reconciling RollbackPhase and LcmResource")
 
@@ -428,7 +519,7 @@ func (r RollbackPhaseReconciler) reconcileRollbackPhase(mgr services.RollbackPha
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionIrreconcilable,
 			Status:       av1.ConditionStatusTrue,
-			Reason:       av1.ReasonReconcileError,
+			Reason:       services.ConditionReason(err, av1.ReasonReconcileError),
 			Message:      err.Error(),
 			ResourceName: reconciledResource.GetName(),
 		}
@@ -436,34 +527,37 @@ func (r RollbackPhaseReconciler) reconcileRollbackPhase(mgr services.RollbackPha
 		r.logAndRecordFailure(instance, &hrc, err)
 
 		_ = r.updateResourceStatus(instance)
-		return err
+		return false, err
 	}
 	instance.Status.RemoveCondition(av1.ConditionIrreconcilable)
 
 	if err := r.watchDependentResources(reconciledResource); err != nil {
 		reclog.Error(err, "Failed to update watch on dependent resources")
-		return err
+		return false, err
 	}
 
-	if reconciledResource.IsFailedOrError() {
-		// We reconcile. Everything is ready. The flow is now ok
+	verdict := health.CheckAll(reconciledResource.GetDependentResources())
+	if verdict.IsFailed() {
+		// We reconcile. One of the sub resources failed. The flow is now in error
 		instance.Status.RemoveCondition(av1.ConditionRunning)
 
 		hrc := av1.LcmResourceCondition{
 			Type:         av1.ConditionError,
 			Status:       av1.ConditionStatusTrue,
 			Reason:       av1.ReasonUnderlyingResourcesError,
-			Message:      reconciledResource.GetPhaseKind().String(),
+			Message:      verdict.Reason,
 			ResourceName: reconciledResource.GetName(),
 		}
 		instance.Status.SetCondition(hrc, instance.Spec.TargetState)
-		r.logAndRecordSuccess(instance, &hrc)
+		instance.Status.Reason = verdict.Reason
+		r.logAndRecordFailure(instance, &hrc, errors.New(verdict.Reason))
 
 		err = r.updateResourceStatus(instance)
-		return err
+		return false, err
 	}
+	instance.Status.RemoveCondition(av1.ConditionError)
 
-	if reconciledResource.IsReady() {
+	if verdict.IsReady() {
 		// We reconcile. Everything is ready. The flow is now ok
 		instance.Status.RemoveCondition(av1.ConditionRunning)
 
@@ -478,8 +572,19 @@ func (r RollbackPhaseReconciler) reconcileRollbackPhase(mgr services.RollbackPha
 		r.logAndRecordSuccess(instance, &hrc)
 
 		err = r.updateResourceStatus(instance)
-		return err
+		return false, err
 	}
 
-	return nil
+	// The sub resources are still progressing
+	hrc := av1.LcmResourceCondition{
+		Type:         av1.ConditionRunning,
+		Status:       av1.ConditionStatusTrue,
+		Reason:       services.ReasonUnderlyingResourcesProgressing,
+		Message:      verdict.Reason,
+		ResourceName: reconciledResource.GetName(),
+	}
+	instance.Status.SetCondition(hrc, instance.Spec.TargetState)
+	instance.Status.Reason = verdict.Reason
+
+	return true, nil
 }
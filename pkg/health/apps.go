@@ -0,0 +1,116 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// checkDeployment waits for the rollout of the Deployment to complete
+func checkDeployment(u *unstructured.Unstructured) Verdict {
+	d := &appsv1.Deployment{}
+	if err := fromUnstructured(u, d); err != nil {
+		return Failed("can not decode Deployment: %s", err)
+	}
+
+	if d.Spec.Paused {
+		return Progressing("rollout is paused")
+	}
+	if d.Generation > d.Status.ObservedGeneration {
+		return Progressing("waiting for the rollout to be observed")
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return Failed("rollout exceeded its progress deadline")
+		}
+		if cond.Type == appsv1.DeploymentReplicaFailure && cond.Status == corev1.ConditionTrue {
+			return Failed("replica failure: %s", cond.Message)
+		}
+	}
+
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	if d.Status.UpdatedReplicas < replicas {
+		return Progressing("%d out of %d new replicas have been updated", d.Status.UpdatedReplicas, replicas)
+	}
+	if d.Status.Replicas > d.Status.UpdatedReplicas {
+		return Progressing("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas)
+	}
+	if d.Status.AvailableReplicas < d.Status.UpdatedReplicas {
+		return Progressing("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+	}
+	return Healthy("")
+}
+
+// checkStatefulSet waits for the rollout of the StatefulSet to complete
+func checkStatefulSet(u *unstructured.Unstructured) Verdict {
+	s := &appsv1.StatefulSet{}
+	if err := fromUnstructured(u, s); err != nil {
+		return Failed("can not decode StatefulSet: %s", err)
+	}
+
+	if s.Generation > s.Status.ObservedGeneration {
+		return Progressing("waiting for the rollout to be observed")
+	}
+
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return Progressing("%d of %d replicas are ready", s.Status.ReadyReplicas, replicas)
+	}
+
+	if s.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return Healthy("")
+	}
+	if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+		expected := replicas - *ru.Partition
+		if s.Status.UpdatedReplicas < expected {
+			return Progressing("%d of %d new replicas have been updated", s.Status.UpdatedReplicas, expected)
+		}
+		return Healthy("")
+	}
+	if s.Status.UpdateRevision != "" && s.Status.CurrentRevision != s.Status.UpdateRevision {
+		return Progressing("waiting for the update to revision %s", s.Status.UpdateRevision)
+	}
+	return Healthy("")
+}
+
+// checkDaemonSet waits for the rollout of the DaemonSet to complete
+func checkDaemonSet(u *unstructured.Unstructured) Verdict {
+	d := &appsv1.DaemonSet{}
+	if err := fromUnstructured(u, d); err != nil {
+		return Failed("can not decode DaemonSet: %s", err)
+	}
+
+	if d.Generation > d.Status.ObservedGeneration {
+		return Progressing("waiting for the rollout to be observed")
+	}
+	if d.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+		return Healthy("")
+	}
+	if d.Status.UpdatedNumberScheduled < d.Status.DesiredNumberScheduled {
+		return Progressing("%d of %d new pods have been updated", d.Status.UpdatedNumberScheduled, d.Status.DesiredNumberScheduled)
+	}
+	if d.Status.NumberAvailable < d.Status.DesiredNumberScheduled {
+		return Progressing("%d of %d updated pods are available", d.Status.NumberAvailable, d.Status.DesiredNumberScheduled)
+	}
+	return Healthy("")
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"testing"
+)
+
+func TestCheckDeployment(t *testing.T) {
+	deployment := func(spec map[string]interface{}, status map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"spec": spec, "status": status}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "paused", obj: newObject("apps/v1", "Deployment", "api", deployment(
+			map[string]interface{}{"paused": true}, map[string]interface{}{})), want: StatusProgressing},
+		{name: "generation not observed", obj: newObject("apps/v1", "Deployment", "api", map[string]interface{}{
+			"metadata": map[string]interface{}{"generation": int64(2)},
+			"status":   map[string]interface{}{"observedGeneration": int64(1)},
+		}), want: StatusProgressing},
+		{name: "progress deadline exceeded", obj: newObject("apps/v1", "Deployment", "api", deployment(
+			map[string]interface{}{},
+			map[string]interface{}{"conditions": []interface{}{
+				map[string]interface{}{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded"},
+			}})), want: StatusFailed},
+		{name: "replica failure", obj: newObject("apps/v1", "Deployment", "api", deployment(
+			map[string]interface{}{},
+			map[string]interface{}{"conditions": []interface{}{
+				map[string]interface{}{"type": "ReplicaFailure", "status": "True", "message": "quota"},
+			}})), want: StatusFailed},
+		{name: "replicas not updated", obj: newObject("apps/v1", "Deployment", "api", deployment(
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(2), "availableReplicas": int64(3)})),
+			want: StatusProgressing},
+		{name: "old replicas pending termination", obj: newObject("apps/v1", "Deployment", "api", deployment(
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"replicas": int64(4), "updatedReplicas": int64(3), "availableReplicas": int64(3)})),
+			want: StatusProgressing},
+		{name: "updated replicas not available", obj: newObject("apps/v1", "Deployment", "api", deployment(
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(3), "availableReplicas": int64(2)})),
+			want: StatusProgressing},
+		{name: "rolled out", obj: newObject("apps/v1", "Deployment", "api", deployment(
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(3), "availableReplicas": int64(3)})),
+			want: StatusHealthy},
+	})
+}
+
+func TestCheckStatefulSet(t *testing.T) {
+	statefulSet := func(spec map[string]interface{}, status map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"spec": spec, "status": status}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "replicas not ready", obj: newObject("apps/v1", "StatefulSet", "db", statefulSet(
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"readyReplicas": int64(2)})), want: StatusProgressing},
+		{name: "on delete", obj: newObject("apps/v1", "StatefulSet", "db", statefulSet(
+			map[string]interface{}{"replicas": int64(3), "updateStrategy": map[string]interface{}{"type": "OnDelete"}},
+			map[string]interface{}{"readyReplicas": int64(3), "currentRevision": "db-1", "updateRevision": "db-2"})),
+			want: StatusHealthy},
+		{name: "partition not updated", obj: newObject("apps/v1", "StatefulSet", "db", statefulSet(
+			map[string]interface{}{"replicas": int64(3), "updateStrategy": map[string]interface{}{
+				"type": "RollingUpdate", "rollingUpdate": map[string]interface{}{"partition": int64(1)}}},
+			map[string]interface{}{"readyReplicas": int64(3), "updatedReplicas": int64(1)})), want: StatusProgressing},
+		{name: "partition updated", obj: newObject("apps/v1", "StatefulSet", "db", statefulSet(
+			map[string]interface{}{"replicas": int64(3), "updateStrategy": map[string]interface{}{
+				"type": "RollingUpdate", "rollingUpdate": map[string]interface{}{"partition": int64(1)}}},
+			map[string]interface{}{"readyReplicas": int64(3), "updatedReplicas": int64(2)})), want: StatusHealthy},
+		{name: "revision not updated", obj: newObject("apps/v1", "StatefulSet", "db", statefulSet(
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"readyReplicas": int64(3), "currentRevision": "db-1", "updateRevision": "db-2"})),
+			want: StatusProgressing},
+		{name: "rolled out", obj: newObject("apps/v1", "StatefulSet", "db", statefulSet(
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"readyReplicas": int64(3), "currentRevision": "db-2", "updateRevision": "db-2"})),
+			want: StatusHealthy},
+	})
+}
+
+func TestCheckDaemonSet(t *testing.T) {
+	daemonSet := func(strategy string, status map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"spec":   map[string]interface{}{"updateStrategy": map[string]interface{}{"type": strategy}},
+			"status": status,
+		}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "on delete", obj: newObject("apps/v1", "DaemonSet", "agent", daemonSet("OnDelete",
+			map[string]interface{}{"desiredNumberScheduled": int64(3)})), want: StatusHealthy},
+		{name: "pods not updated", obj: newObject("apps/v1", "DaemonSet", "agent", daemonSet("RollingUpdate",
+			map[string]interface{}{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(2), "numberAvailable": int64(3)})),
+			want: StatusProgressing},
+		{name: "pods not available", obj: newObject("apps/v1", "DaemonSet", "agent", daemonSet("RollingUpdate",
+			map[string]interface{}{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(2)})),
+			want: StatusProgressing},
+		{name: "rolled out", obj: newObject("apps/v1", "DaemonSet", "agent", daemonSet("RollingUpdate",
+			map[string]interface{}{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(3)})),
+			want: StatusHealthy},
+	})
+}
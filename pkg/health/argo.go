@@ -0,0 +1,44 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Phases of an Argo Workflow
+const (
+	workflowPending   = "Pending"
+	workflowRunning   = "Running"
+	workflowSucceeded = "Succeeded"
+	workflowFailed    = "Failed"
+	workflowError     = "Error"
+)
+
+// checkWorkflow waits for the Argo Workflow to succeed
+func checkWorkflow(u *unstructured.Unstructured) Verdict {
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	message, _, _ := unstructured.NestedString(u.Object, "status", "message")
+
+	switch phase {
+	case workflowSucceeded:
+		return Healthy("")
+	case workflowFailed, workflowError:
+		return Failed("workflow %s: %s", phase, message)
+	case "":
+		return Progressing("workflow is %s", workflowPending)
+	}
+	return Progressing("workflow is %s", phase)
+}
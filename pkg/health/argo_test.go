@@ -0,0 +1,37 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"testing"
+)
+
+func TestCheckWorkflow(t *testing.T) {
+	workflow := func(phase string) map[string]interface{} {
+		return map[string]interface{}{"status": map[string]interface{}{"phase": phase, "message": "step failed"}}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "not started", obj: newObject("argoproj.io/v1alpha1", "Workflow", "flow", nil), want: StatusProgressing},
+		{name: "running", obj: newObject("argoproj.io/v1alpha1", "Workflow", "flow", workflow("Running")),
+			want: StatusProgressing},
+		{name: "succeeded", obj: newObject("argoproj.io/v1alpha1", "Workflow", "flow", workflow("Succeeded")),
+			want: StatusHealthy},
+		{name: "failed", obj: newObject("argoproj.io/v1alpha1", "Workflow", "flow", workflow("Failed")),
+			want: StatusFailed},
+		{name: "error", obj: newObject("argoproj.io/v1alpha1", "Workflow", "flow", workflow("Error")),
+			want: StatusFailed},
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// waitingFailureReasons are the reasons of a waiting container which will
+// not recover without intervention
+var waitingFailureReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// checkJob waits for the Job to complete
+func checkJob(u *unstructured.Unstructured) Verdict {
+	j := &batchv1.Job{}
+	if err := fromUnstructured(u, j); err != nil {
+		return Failed("can not decode Job: %s", err)
+	}
+
+	for _, cond := range j.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobFailed:
+			return Failed("job failed: %s %s", cond.Reason, cond.Message)
+		case batchv1.JobComplete:
+			return Healthy("")
+		}
+	}
+	return Progressing("job is running (%d active, %d succeeded, %d failed)", j.Status.Active, j.Status.Succeeded, j.Status.Failed)
+}
+
+// checkPod waits for the containers of the Pod to be ready, or for the Pod to complete
+func checkPod(u *unstructured.Unstructured) Verdict {
+	p := &corev1.Pod{}
+	if err := fromUnstructured(u, p); err != nil {
+		return Failed("can not decode Pod: %s", err)
+	}
+
+	for _, cs := range append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...) {
+		if cs.State.Waiting != nil && waitingFailureReasons[cs.State.Waiting.Reason] {
+			return Failed("container %s: %s %s", cs.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message)
+		}
+	}
+
+	switch p.Status.Phase {
+	case corev1.PodSucceeded:
+		return Healthy("")
+	case corev1.PodFailed:
+		return Failed("pod failed: %s %s", p.Status.Reason, p.Status.Message)
+	case corev1.PodRunning:
+		for _, cond := range p.Status.Conditions {
+			if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+				return Healthy("")
+			}
+		}
+		return Progressing("pod is running but not ready")
+	}
+	return Progressing("pod is %s", p.Status.Phase)
+}
+
+// checkPersistentVolumeClaim waits for the PVC to be bound
+func checkPersistentVolumeClaim(u *unstructured.Unstructured) Verdict {
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := fromUnstructured(u, pvc); err != nil {
+		return Failed("can not decode PersistentVolumeClaim: %s", err)
+	}
+
+	switch pvc.Status.Phase {
+	case corev1.ClaimBound:
+		return Healthy("")
+	case corev1.ClaimLost:
+		return Failed("claim lost its volume")
+	}
+	return Progressing("claim is %s", pvc.Status.Phase)
+}
+
+// checkService waits for the LoadBalancer services to get an ingress
+func checkService(u *unstructured.Unstructured) Verdict {
+	svc := &corev1.Service{}
+	if err := fromUnstructured(u, svc); err != nil {
+		return Failed("can not decode Service: %s", err)
+	}
+
+	if svc.Spec.Type == corev1.ServiceTypeLoadBalancer && len(svc.Status.LoadBalancer.Ingress) == 0 {
+		return Progressing("waiting for the load balancer ingress")
+	}
+	return Healthy("")
+}
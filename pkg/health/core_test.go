@@ -0,0 +1,97 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"testing"
+)
+
+func TestCheckJob(t *testing.T) {
+	job := func(conditions ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"status": map[string]interface{}{"conditions": conditions, "active": int64(1)}}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "running", obj: newObject("batch/v1", "Job", "db-sync", job()), want: StatusProgressing},
+		{name: "complete", obj: newObject("batch/v1", "Job", "db-sync", job(
+			map[string]interface{}{"type": "Complete", "status": "True"})), want: StatusHealthy},
+		{name: "failed", obj: newObject("batch/v1", "Job", "db-sync", job(
+			map[string]interface{}{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded"})), want: StatusFailed},
+		{name: "condition not true", obj: newObject("batch/v1", "Job", "db-sync", job(
+			map[string]interface{}{"type": "Failed", "status": "False"})), want: StatusProgressing},
+	})
+}
+
+func TestCheckPod(t *testing.T) {
+	pod := func(status map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"status": status}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "pending", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Pending"})),
+			want: StatusProgressing},
+		{name: "succeeded", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Succeeded"})),
+			want: StatusHealthy},
+		{name: "failed", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Failed"})),
+			want: StatusFailed},
+		{name: "running not ready", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Running",
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "False"}}})),
+			want: StatusProgressing},
+		{name: "running ready", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Running",
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}}})),
+			want: StatusHealthy},
+		{name: "crash loop", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Running",
+			"containerStatuses": []interface{}{map[string]interface{}{"name": "api",
+				"state": map[string]interface{}{"waiting": map[string]interface{}{"reason": "CrashLoopBackOff"}}}}})),
+			want: StatusFailed},
+		{name: "init image pull", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Pending",
+			"initContainerStatuses": []interface{}{map[string]interface{}{"name": "init",
+				"state": map[string]interface{}{"waiting": map[string]interface{}{"reason": "ImagePullBackOff"}}}}})),
+			want: StatusFailed},
+		{name: "container creating", obj: newObject("v1", "Pod", "api", pod(map[string]interface{}{"phase": "Pending",
+			"containerStatuses": []interface{}{map[string]interface{}{"name": "api",
+				"state": map[string]interface{}{"waiting": map[string]interface{}{"reason": "ContainerCreating"}}}}})),
+			want: StatusProgressing},
+	})
+}
+
+func TestCheckPersistentVolumeClaim(t *testing.T) {
+	pvc := func(phase string) map[string]interface{} {
+		return map[string]interface{}{"status": map[string]interface{}{"phase": phase}}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "pending", obj: newObject("v1", "PersistentVolumeClaim", "data", pvc("Pending")), want: StatusProgressing},
+		{name: "bound", obj: newObject("v1", "PersistentVolumeClaim", "data", pvc("Bound")), want: StatusHealthy},
+		{name: "lost", obj: newObject("v1", "PersistentVolumeClaim", "data", pvc("Lost")), want: StatusFailed},
+	})
+}
+
+func TestCheckService(t *testing.T) {
+	service := func(serviceType string, ingress ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"spec":   map[string]interface{}{"type": serviceType},
+			"status": map[string]interface{}{"loadBalancer": map[string]interface{}{"ingress": ingress}},
+		}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "cluster ip", obj: newObject("v1", "Service", "api", service("ClusterIP")), want: StatusHealthy},
+		{name: "load balancer pending", obj: newObject("v1", "Service", "api", service("LoadBalancer")),
+			want: StatusProgressing},
+		{name: "load balancer ready", obj: newObject("v1", "Service", "api", service("LoadBalancer",
+			map[string]interface{}{"ip": "10.0.0.1"})), want: StatusHealthy},
+	})
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// checkCustomResourceDefinition waits for the CRD to be Established
+func checkCustomResourceDefinition(u *unstructured.Unstructured) Verdict {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cond["type"] == "Established" && cond["status"] == "True" {
+			return Healthy("")
+		}
+		if cond["type"] == "NamesAccepted" && cond["status"] == "False" {
+			return Failed("names not accepted: %v", cond["message"])
+		}
+	}
+	return Progressing("waiting for the CRD to be established")
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"testing"
+)
+
+func TestCheckCustomResourceDefinition(t *testing.T) {
+	crd := func(conditions ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"status": map[string]interface{}{"conditions": conditions}}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "no condition", obj: newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "phases", crd()),
+			want: StatusProgressing},
+		{name: "established", obj: newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "phases", crd(
+			map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+			map[string]interface{}{"type": "Established", "status": "True"})), want: StatusHealthy},
+		{name: "names not accepted", obj: newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "phases", crd(
+			map[string]interface{}{"type": "NamesAccepted", "status": "False", "message": "conflict"})), want: StatusFailed},
+		{name: "not established yet", obj: newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "phases", crd(
+			map[string]interface{}{"type": "Established", "status": "False"})), want: StatusProgressing},
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health computes the readiness and failure verdicts of the
+// sub resources created by the operator.
+package health
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Status is the health of an object
+type Status string
+
+const (
+	// StatusHealthy indicates the object is ready
+	StatusHealthy Status = "Healthy"
+
+	// StatusProgressing indicates the object is not ready yet but may become ready
+	StatusProgressing Status = "Progressing"
+
+	// StatusFailed indicates the object failed and will not become ready without intervention
+	StatusFailed Status = "Failed"
+)
+
+// Verdict is the result of a health check
+type Verdict struct {
+	Status Status
+	Reason string
+}
+
+// IsReady returns true if the object is healthy
+func (v Verdict) IsReady() bool {
+	return v.Status == StatusHealthy
+}
+
+// IsFailed returns true if the object failed
+func (v Verdict) IsFailed() bool {
+	return v.Status == StatusFailed
+}
+
+// Healthy builds an healthy verdict
+func Healthy(reason string) Verdict {
+	return Verdict{Status: StatusHealthy, Reason: reason}
+}
+
+// Progressing builds a progressing verdict
+func Progressing(format string, args ...interface{}) Verdict {
+	return Verdict{Status: StatusProgressing, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Failed builds a failed verdict
+func Failed(format string, args ...interface{}) Verdict {
+	return Verdict{Status: StatusFailed, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Checker computes the health of the objects of a given kind
+type Checker interface {
+	Check(u *unstructured.Unstructured) Verdict
+}
+
+// CheckerFunc is a function implementing Checker
+type CheckerFunc func(u *unstructured.Unstructured) Verdict
+
+// Check calls the function
+func (f CheckerFunc) Check(u *unstructured.Unstructured) Verdict {
+	return f(u)
+}
+
+var (
+	checkersLock sync.RWMutex
+	checkers     = map[schema.GroupKind]Checker{
+		{Group: "apps", Kind: "Deployment"}:                               CheckerFunc(checkDeployment),
+		{Group: "apps", Kind: "StatefulSet"}:                              CheckerFunc(checkStatefulSet),
+		{Group: "apps", Kind: "DaemonSet"}:                                CheckerFunc(checkDaemonSet),
+		{Group: "batch", Kind: "Job"}:                                     CheckerFunc(checkJob),
+		{Group: "", Kind: "Pod"}:                                          CheckerFunc(checkPod),
+		{Group: "", Kind: "PersistentVolumeClaim"}:                        CheckerFunc(checkPersistentVolumeClaim),
+		{Group: "", Kind: "Service"}:                                      CheckerFunc(checkService),
+		{Group: "argoproj.io", Kind: "Workflow"}:                          CheckerFunc(checkWorkflow),
+		{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}: CheckerFunc(checkCustomResourceDefinition),
+	}
+)
+
+// Register adds or replaces the checker used for a kind
+func Register(gk schema.GroupKind, checker Checker) {
+	checkersLock.Lock()
+	defer checkersLock.Unlock()
+	checkers[gk] = checker
+}
+
+// checkerFor returns the checker of a kind, if any
+func checkerFor(gk schema.GroupKind) (Checker, bool) {
+	checkersLock.RLock()
+	defer checkersLock.RUnlock()
+	checker, ok := checkers[gk]
+	return checker, ok
+}
+
+// Check computes the health of an object. The Oslc and the phase kinds are
+// checked using their status. The other objects whose kind has no registered
+// checker are considered healthy as soon as they exist.
+func Check(u *unstructured.Unstructured) Verdict {
+	if u.GetDeletionTimestamp() != nil {
+		return Progressing("%s %s is being deleted", u.GetKind(), u.GetName())
+	}
+
+	gk := u.GroupVersionKind().GroupKind()
+	if checker, ok := checkerFor(gk); ok {
+		return checker.Check(u)
+	}
+	if gk.Group == lcmGroup {
+		return checkLcmResource(u)
+	}
+	return Healthy("")
+}
+
+// CheckAll aggregates the health of a list of objects. The list is failed if
+// one of the objects failed, progressing if one of them is progressing and
+// healthy otherwise. The reason lists the objects which are not healthy.
+func CheckAll(items []unstructured.Unstructured) Verdict {
+	failed := make([]string, 0)
+	progressing := make([]string, 0)
+
+	for i := range items {
+		verdict := Check(&items[i])
+		switch verdict.Status {
+		case StatusFailed:
+			failed = append(failed, describe(&items[i], verdict))
+		case StatusProgressing:
+			progressing = append(progressing, describe(&items[i], verdict))
+		}
+	}
+
+	if len(failed) != 0 {
+		return Failed(strings.Join(failed, "; "))
+	}
+	if len(progressing) != 0 {
+		return Progressing(strings.Join(progressing, "; "))
+	}
+	return Healthy("")
+}
+
+// describe prefixes the reason of the verdict with the identity of the object
+func describe(u *unstructured.Unstructured, verdict Verdict) string {
+	return fmt.Sprintf("%s %s: %s", u.GetKind(), u.GetName(), verdict.Reason)
+}
+
+// fromUnstructured converts an unstructured object into its typed version
+func fromUnstructured(u *unstructured.Unstructured, obj interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj)
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// newObject returns an unstructured object out of its kind, name and extra fields
+func newObject(apiVersion string, kind string, name string, fields map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	for k, v := range fields {
+		u.Object[k] = v
+	}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace("openstack")
+	u.SetName(name)
+	return u
+}
+
+// checkVerdicts runs Check on each object of tests and compares the status of the verdicts
+func checkVerdicts(t *testing.T, tests []verdictTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(tt.obj)
+			if got.Status != tt.want {
+				t.Errorf("Check() = %v (%s), want %v", got.Status, got.Reason, tt.want)
+			}
+		})
+	}
+}
+
+type verdictTest struct {
+	name string
+	obj  *unstructured.Unstructured
+	want Status
+}
+
+func TestCheck(t *testing.T) {
+	deleted := newObject("v1", "ConfigMap", "deleted", nil)
+	now := metav1.Now()
+	deleted.SetDeletionTimestamp(&now)
+
+	checkVerdicts(t, []verdictTest{
+		{name: "unknown kind", obj: newObject("v1", "ConfigMap", "config", nil), want: StatusHealthy},
+		{name: "being deleted", obj: deleted, want: StatusProgressing},
+		{name: "lcm resource", obj: newObject("openstacklcm.airshipit.org/v1alpha1", "InstallPhase", "install", nil),
+			want: StatusProgressing},
+	})
+}
+
+func TestCheckAll(t *testing.T) {
+	healthy := newObject("v1", "ConfigMap", "config", nil)
+	progressing := newObject("v1", "PersistentVolumeClaim", "data", map[string]interface{}{
+		"status": map[string]interface{}{"phase": "Pending"},
+	})
+	failed := newObject("v1", "PersistentVolumeClaim", "lost", map[string]interface{}{
+		"status": map[string]interface{}{"phase": "Lost"},
+	})
+
+	tests := []struct {
+		name       string
+		items      []unstructured.Unstructured
+		want       Status
+		wantReason string
+	}{
+		{name: "empty", items: nil, want: StatusHealthy},
+		{name: "healthy", items: []unstructured.Unstructured{*healthy}, want: StatusHealthy},
+		{name: "progressing", items: []unstructured.Unstructured{*healthy, *progressing}, want: StatusProgressing,
+			wantReason: "PersistentVolumeClaim data: claim is Pending"},
+		{name: "failed wins", items: []unstructured.Unstructured{*progressing, *failed, *healthy}, want: StatusFailed,
+			wantReason: "PersistentVolumeClaim lost: claim lost its volume"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CheckAll(tt.items)
+			if got.Status != tt.want || got.Reason != tt.wantReason {
+				t.Errorf("CheckAll() = %v (%q), want %v (%q)", got.Status, got.Reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	gk := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	Register(gk, CheckerFunc(func(u *unstructured.Unstructured) Verdict {
+		return Failed("widget is broken")
+	}))
+	defer func() {
+		checkersLock.Lock()
+		delete(checkers, gk)
+		checkersLock.Unlock()
+	}()
+
+	if got := Check(newObject("example.com/v1", "Widget", "widget", nil)); !got.IsFailed() {
+		t.Errorf("Check() = %v, want the verdict of the registered checker", got.Status)
+	}
+}
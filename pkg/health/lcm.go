@@ -0,0 +1,45 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// lcmGroup is the group of the Oslc and of the phase kinds
+const lcmGroup = "openstacklcm.airshipit.org"
+
+// checkLcmResource waits for an Oslc or a Phase to reach its target state.
+// The verdict is computed from the status maintained by the controller of
+// the resource.
+func checkLcmResource(u *unstructured.Unstructured) Verdict {
+	actualState, _, _ := unstructured.NestedString(u.Object, "status", "actualState")
+	satisfied, _, _ := unstructured.NestedBool(u.Object, "status", "satisfied")
+	reason, _, _ := unstructured.NestedString(u.Object, "status", "reason")
+
+	switch av1.LcmResourceState(actualState) {
+	case av1.StateError, av1.StateFailed:
+		return Failed("%s is %s: %s", u.GetKind(), actualState, reason)
+	}
+	if satisfied {
+		return Healthy("")
+	}
+	if actualState == "" {
+		return Progressing("%s has not been reconciled yet", u.GetKind())
+	}
+	return Progressing("%s is %s", u.GetKind(), actualState)
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"testing"
+)
+
+func TestCheckLcmResource(t *testing.T) {
+	lcm := func(actualState string, satisfied bool) map[string]interface{} {
+		return map[string]interface{}{"status": map[string]interface{}{
+			"actualState": actualState, "satisfied": satisfied, "reason": "job failed"}}
+	}
+
+	checkVerdicts(t, []verdictTest{
+		{name: "not reconciled", obj: newObject("openstacklcm.airshipit.org/v1alpha1", "Oslc", "keystone", nil),
+			want: StatusProgressing},
+		{name: "satisfied", obj: newObject("openstacklcm.airshipit.org/v1alpha1", "InstallPhase", "install",
+			lcm("deployed", true)), want: StatusHealthy},
+		{name: "not satisfied", obj: newObject("openstacklcm.airshipit.org/v1alpha1", "InstallPhase", "install",
+			lcm("pending", false)), want: StatusProgressing},
+		{name: "failed", obj: newObject("openstacklcm.airshipit.org/v1alpha1", "TestPhase", "test",
+			lcm("failed", false)), want: StatusFailed},
+		{name: "error", obj: newObject("openstacklcm.airshipit.org/v1alpha1", "Oslc", "keystone",
+			lcm("error", false)), want: StatusFailed},
+	})
+}
@@ -13,37 +13,31 @@
 package helmv3
 
 import (
-	// "fmt"
+	"fmt"
 	"io/ioutil"
-	// "os"
-	// "path/filepath"
+	"os"
+	"path/filepath"
 	"sort"
-	// "strings"
+	"strings"
 
-	// "github.com/ghodss/yaml"
+	"github.com/ghodss/yaml"
 
-	// "helm.sh/helm/v3/pkg/chartutil"
-	// "helm.sh/helm/v3/pkg/manifest"
-	// "helm.sh/helm/v3/pkg/proto/hapi/chart"
-	// "helm.sh/helm/v3/pkg/releaseutil"
-	// "helm.sh/helm/v3/pkg/renderutil"
-	// "helm.sh/helm/v3/pkg/timeconv"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	// "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	// "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-var (
-	log = logf.Log.WithName("helmv3")
-
-	// defaultKubeVersion is the default value of --kube-version flag
-	// defaultKubeVersion = fmt.Sprintf("%s.%s", chartutil.DefaultKubeVersion.Major, chartutil.DefaultKubeVersion.Minor)
-)
+var log = logf.Log.WithName("helmv3")
 
 type OwnerRefHelmv3Renderer struct {
+	discovery    discovery.DiscoveryInterface
 	refs         []metav1.OwnerReference
 	suffix       string
 	renderFiles  []string
@@ -72,115 +66,170 @@ func (o *OwnerRefHelmv3Renderer) RenderChart(name string, namespace string, char
 
 	ownedRenderedFiles := av1.NewSubResourceList(namespace, name)
 
-	// // verify chart path exists
-	// var chartPath string
-	// if _, err := os.Stat(chartLocation); err == nil {
-	// 	if chartPath, err = filepath.Abs(chartLocation); err != nil {
-	// 		return ownedRenderedFiles, err
-	// 	}
-	// } else {
-	// 	return ownedRenderedFiles, err
-	// }
-
-	// // get combined values and create config
-	// rawVals, err := yaml.Marshal(o.renderValues)
-	// if err != nil {
-	// 	return ownedRenderedFiles, err
-	// }
-	// config := &chart.Config{Raw: string(rawVals), Values: map[string]*chart.Value{}}
-
-	// // Check chart requirements to make sure all dependencies are present in /charts
-	// c, err := chartutil.Load(chartPath)
-	// if err != nil {
-	// 	return ownedRenderedFiles, err
-	// }
-
-	// renderOpts := renderutil.Options{
-	// 	ReleaseOptions: chartutil.ReleaseOptions{
-	// 		Name:      name,
-	// 		IsInstall: true,
-	// 		IsUpgrade: false,
-	// 		Time:      timeconv.Now(),
-	// 		Namespace: namespace,
-	// 	},
-	// 	KubeVersion: defaultKubeVersion,
-	// }
-
-	// renderedTemplates, err := renderutil.Render(c, config, renderOpts)
-	// if err != nil {
-	// 	return ownedRenderedFiles, err
-	// }
-
-	// listManifests := manifest.SplitManifests(renderedTemplates)
-	// var manifestsToRender []manifest.Manifest
-
-	// // if we have a list of files to render, then check that each of the
-	// // provided files exists in the chart.
-	// if len(o.renderFiles) > 0 {
-	// 	for _, f := range o.renderFiles {
-	// 		missing := true
-	// 		if !filepath.IsAbs(f) {
-	// 			newF, err := filepath.Abs(filepath.Join(chartPath, f))
-	// 			if err != nil {
-	// 				return ownedRenderedFiles, fmt.Errorf("could not turn template path %s into absolute path: %s", f, err)
-	// 			}
-	// 			f = newF
-	// 		}
-
-	// 		for _, manifest := range listManifests {
-	// 			// manifest.Name is rendered using linux-style filepath separators on Windows as
-	// 			// well as macOS/linux.
-	// 			manifestPathSplit := strings.Split(manifest.Name, "/")
-	// 			// remove the chart name from the path
-	// 			manifestPathSplit = manifestPathSplit[1:]
-	// 			toJoin := append([]string{chartPath}, manifestPathSplit...)
-	// 			manifestPath := filepath.Join(toJoin...)
-
-	// 			// if the filepath provided matches a manifest path in the
-	// 			// chart, render that manifest
-	// 			if f == manifestPath {
-	// 				manifestsToRender = append(manifestsToRender, manifest)
-	// 				missing = false
-	// 			}
-	// 		}
-	// 		if missing {
-	// 			return ownedRenderedFiles, fmt.Errorf("could not find template %s in chart", f)
-	// 		}
-	// 	}
-	// } else {
-	// 	// no renderFiles provided, render all manifests in the chart
-	// 	manifestsToRender = listManifests
-	// }
-
-	// for _, m := range manifestsToRender {
-	// 	fileName := filepath.Base(m.Name)
-	// 	if fileName == "NOTES.txt" {
-	// 		continue
-	// 	}
-	// 	if strings.HasPrefix(fileName, "_") {
-	// 		continue
-	// 	}
-
-	// 	// TODO(jeb): We need to figure how to reuse configmap
-	// 	// if strings.HasSuffix(fileName, ".yaml") && strings.Contains(m.Name, "templates/lifecycle-") {
-	// 	if strings.HasSuffix(fileName, ".yaml") {
-	// 		parsed, _ := o.fromYaml(name, namespace, m.Content)
-
-	// 		for _, u := range parsed.Items {
-	// 			ownedRenderedFiles.Items = append(ownedRenderedFiles.Items, u)
-	// 		}
-	// 	}
-	// }
+	// verify chart path exists
+	var chartPath string
+	if _, err := os.Stat(chartLocation); err == nil {
+		if chartPath, err = filepath.Abs(chartLocation); err != nil {
+			return ownedRenderedFiles, err
+		}
+	} else {
+		return ownedRenderedFiles, err
+	}
+
+	// The loader accepts both a chart directory and a packaged chart archive
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return ownedRenderedFiles, err
+	}
+
+	// Apply the dependencies conditions, tags and import-values the same
+	// way helm install would do it.
+	if err := chartutil.ProcessDependencies(c, o.renderValues); err != nil {
+		return ownedRenderedFiles, err
+	}
+
+	releaseOptions := chartutil.ReleaseOptions{
+		Name:      name,
+		Namespace: namespace,
+		Revision:  1,
+		IsInstall: true,
+		IsUpgrade: false,
+	}
+
+	caps, err := o.capabilities()
+	if err != nil {
+		return ownedRenderedFiles, err
+	}
+	vals, err := chartutil.ToRenderValues(c, o.renderValues, releaseOptions, caps)
+	if err != nil {
+		return ownedRenderedFiles, err
+	}
+
+	renderedTemplates, err := engine.Render(c, vals)
+	if err != nil {
+		return ownedRenderedFiles, err
+	}
+
+	// Sort the template names so that the content of the SubResourceList
+	// does not depend on the map iteration order.
+	var listManifests []string
+	for manifestName := range renderedTemplates {
+		listManifests = append(listManifests, manifestName)
+	}
+	sort.Strings(listManifests)
+
+	var manifestsToRender []string
+
+	// if we have a list of files to render, then check that each of the
+	// provided files exists in the chart.
+	if len(o.renderFiles) > 0 {
+		for _, f := range o.renderFiles {
+			missing := true
+			if !filepath.IsAbs(f) {
+				newF, err := filepath.Abs(filepath.Join(chartPath, f))
+				if err != nil {
+					return ownedRenderedFiles, fmt.Errorf("could not turn template path %s into absolute path: %s", f, err)
+				}
+				f = newF
+			}
+
+			for _, manifestName := range listManifests {
+				// manifestName is rendered using linux-style filepath separators on Windows as
+				// well as macOS/linux.
+				manifestPathSplit := strings.Split(manifestName, "/")
+				// remove the chart name from the path
+				manifestPathSplit = manifestPathSplit[1:]
+				toJoin := append([]string{chartPath}, manifestPathSplit...)
+				manifestPath := filepath.Join(toJoin...)
+
+				// if the filepath provided matches a manifest path in the
+				// chart, render that manifest
+				if f == manifestPath {
+					manifestsToRender = append(manifestsToRender, manifestName)
+					missing = false
+				}
+			}
+			if missing {
+				return ownedRenderedFiles, fmt.Errorf("could not find template %s in chart", f)
+			}
+		}
+	} else {
+		// no renderFiles provided, render all manifests in the chart
+		manifestsToRender = listManifests
+	}
+
+	for _, manifestName := range manifestsToRender {
+		fileName := filepath.Base(manifestName)
+		if fileName == "NOTES.txt" {
+			continue
+		}
+		if strings.HasPrefix(fileName, "_") {
+			continue
+		}
+
+		// TODO(jeb): We need to figure how to reuse configmap
+		if strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml") {
+			parsed, err := o.fromYaml(name, namespace, renderedTemplates[manifestName])
+			if err != nil {
+				return ownedRenderedFiles, fmt.Errorf("could not parse rendered template %s: %s", manifestName, err)
+			}
+
+			ownedRenderedFiles.Items = append(ownedRenderedFiles.Items, parsed.Items...)
+		}
+	}
 
 	return ownedRenderedFiles, nil
 }
 
+// capabilities returns the capabilities of the cluster the chart is rendered for,
+// the same way helm install computes them. The defaults of helm are used when the
+// renderer has no discovery client.
+func (o *OwnerRefHelmv3Renderer) capabilities() (*chartutil.Capabilities, error) {
+	caps := chartutil.DefaultCapabilities.Copy()
+	if o.discovery == nil {
+		return caps, nil
+	}
+
+	kubeVersion, err := o.discovery.ServerVersion()
+	if err != nil {
+		return caps, fmt.Errorf("could not get the server version: %s", err)
+	}
+	caps.KubeVersion = chartutil.KubeVersion{
+		Version: kubeVersion.GitVersion,
+		Major:   kubeVersion.Major,
+		Minor:   kubeVersion.Minor,
+	}
+
+	// Some aggregated APIs may be unavailable, which does not prevent the rendering
+	groups, resources, err := o.discovery.ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return caps, fmt.Errorf("could not get the server API versions: %s", err)
+	}
+
+	versions := make([]string, 0)
+	for _, group := range groups {
+		for _, version := range group.Versions {
+			versions = append(versions, version.GroupVersion)
+		}
+	}
+	for _, list := range resources {
+		for _, resource := range list.APIResources {
+			versions = append(versions, list.GroupVersion+"/"+resource.Kind)
+		}
+	}
+	sort.Strings(versions)
+	caps.APIVersions = chartutil.VersionSet(versions)
+	return caps, nil
+}
+
+// sortManifests returns the documents of a split manifest in the order
+// in which they appear in the original file.
 func sortManifests(in map[string]string) []string {
 	var keys []string
 	for k := range in {
 		keys = append(keys, k)
 	}
-	sort.Strings(keys)
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
 
 	var manifests []string
 	for _, k := range keys {
@@ -194,57 +243,48 @@ func (o *OwnerRefHelmv3Renderer) fromYaml(name string, namespace string, filecon
 
 	ownedRenderedFiles := av1.NewSubResourceList(namespace, name)
 
-	// manifests := releaseutil.SplitManifests(filecontent)
-	// for _, manifest := range sortManifests(manifests) {
-	// 	manifestMap := chartutil.FromYaml(manifest)
-
-	// 	if _, ok := manifestMap["Error"]; ok {
-	// 		log.Error(nil, "error parsing rendered template to add ownerrefs")
-	// 		continue
-	// 	}
-
-	// 	// Check if the document is empty
-	// 	if len(manifestMap) == 0 {
-	// 		continue
-	// 	}
-
-	// 	unst, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&manifestMap)
-	// 	if err != nil {
-	// 		log.Error(err, "error converting to Unstructured")
-	// 		continue
-	// 	}
-
-	// 	u := &unstructured.Unstructured{Object: unst}
-	// 	u.SetOwnerReferences(o.refs)
-
-	// 	// Init name and namespace
-	// 	if u.GetName() == "" {
-	// 		u.SetName(name + "-" + o.suffix)
-	// 	}
-
-	// 	if u.GetNamespace() == "" {
-	// 		u.SetNamespace(namespace)
-	// 	}
-
-	// 	// Add OwnerReferences
-	// 	u.SetOwnerReferences(o.refs)
-
-	// 	// Add labels
-	// 	// labels := map[string]string{
-	// 	// 	"app": name,
-	// 	// }
-	// 	// u.SetLabels(labels)
-
-	// 	ownedRenderedFiles.Items = append(ownedRenderedFiles.Items, *u)
-	// }
+	manifests := releaseutil.SplitManifests(filecontent)
+	for _, manifest := range sortManifests(manifests) {
+		manifestMap := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(manifest), &manifestMap); err != nil {
+			log.Error(err, "error parsing rendered template to add ownerrefs")
+			return ownedRenderedFiles, err
+		}
+
+		// Check if the document is empty
+		if len(manifestMap) == 0 {
+			continue
+		}
+
+		u := &unstructured.Unstructured{Object: manifestMap}
+		if u.GetKind() == "" || u.GetAPIVersion() == "" {
+			return ownedRenderedFiles, fmt.Errorf("document is missing apiVersion or kind")
+		}
+
+		// Init name and namespace
+		if u.GetName() == "" {
+			u.SetName(name + "-" + o.suffix)
+		}
+
+		if u.GetNamespace() == "" {
+			u.SetNamespace(namespace)
+		}
+
+		// Add OwnerReferences
+		u.SetOwnerReferences(o.refs)
+
+		ownedRenderedFiles.Items = append(ownedRenderedFiles.Items, *u)
+	}
 
 	return ownedRenderedFiles, nil
 }
 
-// NewOwnerRefHelmv3Renderer creates a new OwnerRef engine with a set of metav1.OwnerReferences to be added to assets
-func NewOwnerRefHelmv3Renderer(refs []metav1.OwnerReference, suffix string,
+// NewOwnerRefHelmv3Renderer creates a new OwnerRef engine with a set of metav1.OwnerReferences to be added to assets.
+// The capabilities of the cluster are read through the discovery client, which can be nil.
+func NewOwnerRefHelmv3Renderer(dc discovery.DiscoveryInterface, refs []metav1.OwnerReference, suffix string,
 	renderFiles []string, renderValues map[string]interface{}) *OwnerRefHelmv3Renderer {
 	return &OwnerRefHelmv3Renderer{
+		discovery:    dc,
 		refs:         refs,
 		suffix:       suffix,
 		renderFiles:  renderFiles,
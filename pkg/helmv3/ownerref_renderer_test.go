@@ -0,0 +1,229 @@
+// Copyright The Helm Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helmv3
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var testRefs = []metav1.OwnerReference{
+	{APIVersion: "openstacklcm.airshipit.org/v1alpha1", Kind: "InstallPhase", Name: "keystone-install", UID: "1234"},
+}
+
+// writeChart creates a chart in a temporary directory out of its files
+func writeChart(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFromYaml(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "empty",
+			content:   "",
+			wantNames: []string{},
+		},
+		{
+			name: "documents in file order",
+			content: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  namespace: other
+`,
+			wantNames: []string{"b", "a"},
+		},
+		{
+			name: "default name and empty documents",
+			content: `---
+# comment only
+---
+apiVersion: v1
+kind: Service
+`,
+			wantNames: []string{"keystone-osins"},
+		},
+		{
+			name: "missing kind",
+			content: `apiVersion: v1
+metadata:
+  name: a
+`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			content: "a: [",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOwnerRefHelmv3Renderer(nil, testRefs, "osins", nil, nil)
+			got, err := o.fromYaml("keystone", "openstack", tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fromYaml() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got.Items) != len(tt.wantNames) {
+				t.Fatalf("fromYaml() returned %d items, want %d", len(got.Items), len(tt.wantNames))
+			}
+			for i, item := range got.Items {
+				if item.GetName() != tt.wantNames[i] {
+					t.Errorf("item %d name = %q, want %q", i, item.GetName(), tt.wantNames[i])
+				}
+				if item.GetNamespace() == "" {
+					t.Errorf("item %d has no namespace", i)
+				}
+				if refs := item.GetOwnerReferences(); len(refs) != 1 || refs[0].UID != testRefs[0].UID {
+					t.Errorf("item %d owner references = %v", i, refs)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderChart(t *testing.T) {
+	chart := writeChart(t, map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: testchart\nversion: 0.1.0\n",
+		"values.yaml": "replicas: 1\n",
+		"templates/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-config
+data:
+  replicas: {{ .Values.replicas | quote }}
+  kubeVersion: {{ .Capabilities.KubeVersion.Version | quote }}
+  argo: {{ .Capabilities.APIVersions.Has "argoproj.io/v1alpha1/Workflow" | quote }}
+`,
+		"templates/workflow.yaml": `{{- if .Values.workflow }}
+apiVersion: argoproj.io/v1alpha1
+kind: Workflow
+metadata:
+  name: {{ .Release.Name }}
+{{- end }}
+`,
+		"templates/_helpers.tpl": `{{- define "testchart.name" }}testchart{{ end }}`,
+		"templates/NOTES.txt":    "Installed {{ .Release.Name }}",
+	})
+
+	dc := &fakediscovery.FakeDiscovery{
+		Fake: &clienttesting.Fake{
+			Resources: []*metav1.APIResourceList{
+				{GroupVersion: "argoproj.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "workflows", Kind: "Workflow"}}},
+			},
+		},
+		FakedServerVersion: &version.Info{GitVersion: "v1.26.3", Major: "1", Minor: "26"},
+	}
+
+	tests := []struct {
+		name        string
+		discovery   bool
+		values      map[string]interface{}
+		renderFiles []string
+		wantKinds   []string
+		wantData    map[string]string
+		wantErr     bool
+	}{
+		{
+			name:      "default values and capabilities",
+			values:    map[string]interface{}{},
+			wantKinds: []string{"ConfigMap"},
+			wantData:  map[string]string{"replicas": "1", "argo": "false"},
+		},
+		{
+			name:      "values and discovered capabilities",
+			discovery: true,
+			values:    map[string]interface{}{"replicas": 3, "workflow": true},
+			wantKinds: []string{"ConfigMap", "Workflow"},
+			wantData:  map[string]string{"replicas": "3", "kubeVersion": "v1.26.3", "argo": "true"},
+		},
+		{
+			name:        "render files",
+			values:      map[string]interface{}{"workflow": true},
+			renderFiles: []string{"templates/workflow.yaml"},
+			wantKinds:   []string{"Workflow"},
+		},
+		{
+			name:        "missing render file",
+			values:      map[string]interface{}{},
+			renderFiles: []string{"templates/missing.yaml"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOwnerRefHelmv3Renderer(nil, testRefs, "osins", tt.renderFiles, tt.values)
+			if tt.discovery {
+				o.discovery = dc
+			}
+			got, err := o.RenderChart("keystone", "openstack", chart)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderChart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got.Items) != len(tt.wantKinds) {
+				t.Fatalf("RenderChart() returned %d items, want %d", len(got.Items), len(tt.wantKinds))
+			}
+			for i, item := range got.Items {
+				if item.GetKind() != tt.wantKinds[i] {
+					t.Errorf("item %d kind = %q, want %q", i, item.GetKind(), tt.wantKinds[i])
+				}
+				if item.GetNamespace() != "openstack" {
+					t.Errorf("item %d namespace = %q", i, item.GetNamespace())
+				}
+				if item.GetKind() != "ConfigMap" {
+					continue
+				}
+				data := item.Object["data"].(map[string]interface{})
+				for k, v := range tt.wantData {
+					if data[k] != v {
+						t.Errorf("data[%s] = %v, want %v", k, data[k], v)
+					}
+				}
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ package oslc
 
 import (
 	"context"
+	"errors"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
 	lcmif "github.com/keleustes/oslc-operator/pkg/services"
@@ -30,17 +31,33 @@ import (
 
 type basemanager struct {
 	kubeClient     client.Client
-	renderer       lcmif.OwnerRefHelmRenderer
+	newRenderer    func(renderValues map[string]interface{}) lcmif.OwnerRefHelmRenderer
+	renderValues   map[string]interface{}
+	oslc           *av1.Oslc
 	oslcRefs       []metav1.OwnerReference
 	oslcName       string
 	oslcNamespace  string
 	sourceType     string
 	sourceLocation string
 	serviceName    string
+	adoptionPolicy lcmif.AdoptionPolicy
+	retainKinds    []string
+	sorter         lcmif.KindSorter
+	dryRun         bool
+	flowBackend    lcmif.FlowBackend
+	flowRun        *lcmif.FlowRun
+	flowKind       string
+	targetVersion  string
+	slice          *lcmif.Slice
+	revision       lcmif.RevisionSnapshot
+	revisionLimit  *int32
 
 	isInstalled           bool
 	isUpdateRequired      bool
 	deployedLifecycleFlow *av1.LifecycleFlow
+	driftedSubResources   []lcmif.SubResourceDrift
+	inventory             *lcmif.Inventory
+	adoptedSubResources   []unstructured.Unstructured
 }
 
 // ResourceName returns the name of the release.
@@ -56,123 +73,314 @@ func (m basemanager) IsUpdateRequired() bool {
 	return m.isUpdateRequired
 }
 
-// Render a chart or just a file
-func (m basemanager) render(ctx context.Context) (*av1.LifecycleFlow, error) {
+// AdoptedResources returns the existing sub resources adopted during the last SyncResource
+func (m basemanager) AdoptedResources() []unstructured.Unstructured {
+	return m.adoptedSubResources
+}
+
+// FlowStatus returns the progress of the flow read from its backend during the last
+// install, update or reconcile, nil if the flow has not been submitted yet
+func (m basemanager) FlowStatus() *lcmif.FlowStatus {
+	return m.flowRun.Status
+}
+
+// RecordRevision records a ControllerRevision of the spec and render values of the Oslc
+// if they changed since the latest revision
+func (m basemanager) RecordRevision(ctx context.Context) (*lcmif.RevisionHistory, error) {
+	return lcmif.RecordRevision(ctx, m.kubeClient, m.oslc, m.revision, m.revisionLimit)
+}
+
+// runRenderValues returns a copy of the render values of the Oslc completed with the
+// run of the flow. The values of the Oslc are left untouched since render is called
+// several times per reconcile.
+func (m *basemanager) runRenderValues() map[string]interface{} {
+	values := make(map[string]interface{}, len(m.renderValues))
+	for k, v := range m.renderValues {
+		values[k] = v
+	}
+
+	oslcValues := map[string]interface{}{}
+	if base, ok := m.renderValues["oslc"].(map[string]interface{}); ok {
+		for k, v := range base {
+			oslcValues[k] = v
+		}
+	}
+	oslcValues["run"] = m.flowRun.Record.Number
+	oslcValues["run_suffix"] = "-" + m.flowRun.Record.Suffix()
+	oslcValues["previous_target_version"] = lcmif.PreviousTargetVersion(m.inventory, m.targetVersion)
+	values["oslc"] = oslcValues
+	return values
+}
+
+// Render a chart or just a file. The objects describing the flow are handed over
+// to the flow backend instead of being part of the sub resources. The run of the
+// flow is recorded in the shared flowRun.
+func (m *basemanager) render(ctx context.Context) (*av1.LifecycleFlow, error) {
 	var err error
 	var subResourceList *av1.SubResourceList
 
+	// The run is part of the identity of the objects executing the flow
+	m.flowRun.Record = lcmif.NextFlowRun(m.inventory, m.flowKind, m.targetVersion)
+	renderer := m.newRenderer(m.runRenderValues())
+
 	if m.sourceType == "generate" {
 		// In order to use the generic flow, we instantiate on internal chart
-		subResourceList, err = m.renderer.RenderChart(m.oslcName, m.oslcNamespace, m.sourceLocation)
+		subResourceList, err = renderer.RenderChart(m.oslcName, m.oslcNamespace, m.sourceLocation)
 	} else if m.sourceType == "tar" {
-		subResourceList, err = m.renderer.RenderChart(m.oslcName, m.oslcNamespace, m.sourceLocation)
+		subResourceList, err = renderer.RenderChart(m.oslcName, m.oslcNamespace, m.sourceLocation)
 	} else {
-		subResourceList, err = m.renderer.RenderFile(m.oslcName, m.oslcNamespace, m.sourceLocation)
+		subResourceList, err = renderer.RenderFile(m.oslcName, m.oslcNamespace, m.sourceLocation)
+	}
+
+	if err != nil {
+		err = lcmif.NewTypedError(lcmif.ErrorTypeRender, err)
+	} else if subResourceList != nil {
+		err = lcmif.ClassifyError(lcmif.TrackOwnership(m.kubeClient.RESTMapper(), subResourceList.Items, m.oslcRefs, m.oslcNamespace))
 	}
 
 	phaseList := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
+	flowItems := make([]unstructured.Unstructured, 0)
 	if subResourceList != nil {
 		for _, item := range subResourceList.Items {
-			if item.GetAPIVersion() == "openstacklcm.airshipit.org/v1alpha1" {
+			if m.flowBackend.Handles(&item) {
+				m.flowRun.Record.Apply(&item)
+				m.slice.Apply(&item)
+				flowItems = append(flowItems, item)
+			} else if item.GetAPIVersion() == "openstacklcm.airshipit.org/v1alpha1" {
 				// TODO(jeb): We should filter on Phase here.
 				phaseList.Phases[item.GetKind()] = item
-			} else if item.GetAPIVersion() == "argoproj.io/v1alpha1" {
-				// TODO(jeb): We should filter on workflow here.
-				phaseList.Main = &item
 			} else {
 				log.Info("Filtering ", "kind", item.GetKind())
 			}
 		}
 	}
+
+	if err == nil {
+		m.flowRun.Objects, err = m.flowBackend.Render(m.flowRun, flowItems)
+	}
 	return phaseList, err
 }
 
+// runFlow submits the flow to its backend, or makes it progress, then reads its progress.
+// The previous run is archived when a new run starts. The objects the flow acts upon
+// are added to touched, so that they are watched. The approval gates of the flow which
+// have been approved are granted.
+func (m basemanager) runFlow(ctx context.Context, touched *av1.LifecycleFlow) error {
+	if len(m.flowRun.Objects) == 0 {
+		log.Info("No Main Workflow")
+	}
+
+	m.flowRun.Inventory = m.inventory
+	m.flowRun.Touched = nil
+	if err := lcmif.StartFlowRun(ctx, m.flowRun, m.flowBackend); err != nil {
+		return err
+	}
+
+	errs := make([]error, 0)
+	if err := m.flowBackend.Submit(ctx, m.flowRun); err != nil {
+		errs = append(errs, err)
+	}
+	for i := range m.flowRun.Touched {
+		addToFlow(touched, &m.flowRun.Touched[i])
+	}
+
+	status, err := m.flowBackend.Status(ctx, m.flowRun)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		m.flowRun.Status = status
+	}
+
+	approvals, err := lcmif.SyncApprovals(ctx, m.flowRun)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if m.flowRun.Status != nil {
+		m.flowRun.Status.Approvals = approvals
+	}
+	return lcmif.NewMultiError(errs)
+}
+
+// SuspendFlow holds the flow, or releases it, without making it progress
+func (m basemanager) SuspendFlow(ctx context.Context, suspend bool) error {
+	if m.inventory == nil {
+		return nil
+	}
+	if _, err := m.render(ctx); err != nil {
+		return err
+	}
+
+	m.flowRun.Inventory = m.inventory
+	if err := m.flowBackend.Suspend(ctx, m.flowRun, suspend); err != nil {
+		return err
+	}
+	status, err := m.flowBackend.Status(ctx, m.flowRun)
+	if err != nil {
+		return err
+	}
+	m.flowRun.Status = status
+	return m.inventory.Save(ctx, m.kubeClient)
+}
+
+// AbortFlow terminates the flow. The objects the flow acted upon, such as the
+// Phase CRs, are left as they are for inspection.
+func (m basemanager) AbortFlow(ctx context.Context) error {
+	if m.inventory == nil {
+		return nil
+	}
+	if _, err := m.render(ctx); err != nil {
+		return err
+	}
+
+	m.flowRun.Inventory = m.inventory
+	if err := m.flowBackend.Cancel(ctx, m.flowRun); err != nil {
+		return err
+	}
+	status, err := m.flowBackend.Status(ctx, m.flowRun)
+	if err != nil {
+		return err
+	}
+	m.flowRun.Status = status
+	return m.inventory.Save(ctx, m.kubeClient)
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this Oslc CR
 func (m *basemanager) syncResource(ctx context.Context) error {
 	m.deployedLifecycleFlow = av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
 
+	inventory, err := lcmif.LoadInventory(ctx, m.kubeClient, m.oslcNamespace, m.oslcRefs)
+	m.inventory = inventory
+	if err != nil {
+		return err
+	}
+
 	rendered, alreadyDeployed, err := m.sync(ctx)
 	if err != nil {
 		return err
 	}
 
 	m.deployedLifecycleFlow = alreadyDeployed
-	if len(rendered.GetDependentResources()) != len(alreadyDeployed.GetDependentResources()) {
+	m.driftedSubResources = nil
+	if len(alreadyDeployed.GetDependentResources()) == 0 && len(rendered.GetDependentResources()) != 0 {
 		m.isInstalled = false
 		m.isUpdateRequired = false
 	} else {
 		m.isInstalled = true
-		m.isUpdateRequired = false
+		m.driftedSubResources = lcmif.DetectDrifts(rendered.GetDependentResources(), alreadyDeployed.GetDependentResources())
+		orphans := lcmif.FindOrphans(rendered.GetDependentResources(), alreadyDeployed.GetDependentResources())
+		m.driftedSubResources = append(m.driftedSubResources, lcmif.OrphanDrifts(orphans)...)
+		m.isUpdateRequired = len(m.driftedSubResources) != 0
+		for _, drift := range m.driftedSubResources {
+			log.Info("Drift detected", "oslc", m.oslcName, "kind", drift.Kind, "name", drift.Name, "reason", drift.Reason)
+		}
 	}
 
 	return nil
 }
 
-// Attempts to compare the K8s object present with the rendered objects
-func (m basemanager) sync(ctx context.Context) (*av1.LifecycleFlow, *av1.LifecycleFlow, error) {
+// addToFlow stores a sub resource in the Main workflow or the Phases of the flow
+func addToFlow(flow *av1.LifecycleFlow, u *unstructured.Unstructured) {
+	if u.GetAPIVersion() == "argoproj.io/v1alpha1" && u.GetKind() == "Workflow" {
+		flow.Main = u
+	} else {
+		flow.Phases[u.GetKind()] = *u
+	}
+}
+
+// Attempts to compare the K8s object present with the rendered objects.
+// The objects are looked up from the inventory and from the current rendering.
+// The objects which are not owned by the Oslc yet are adopted according to
+// the adoption policy.
+func (m *basemanager) sync(ctx context.Context) (*av1.LifecycleFlow, *av1.LifecycleFlow, error) {
 	deployed := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
+	referenced := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
+	m.adoptedSubResources = make([]unstructured.Unstructured, 0)
 
 	rendered, err := m.render(ctx)
 	if err != nil {
 		return nil, deployed, err
 	}
 
+	renderedResources := rendered.GetDependentResources()
+	candidates := m.inventory.Objects()
+	for _, renderedResource := range renderedResources {
+		if lcmif.FindResource(candidates, &renderedResource) == nil {
+			candidates = append(candidates, renderedResource)
+		}
+	}
+
 	errs := make([]error, 0)
 
-	if rendered.Main != nil {
+	for _, candidate := range candidates {
+		// The objects of the flow are handled by the flow backend
+		if m.flowBackend.Handles(&candidate) {
+			continue
+		}
+
 		existingResource := unstructured.Unstructured{}
-		existingResource.SetAPIVersion(rendered.Main.GetAPIVersion())
-		existingResource.SetKind(rendered.Main.GetKind())
-		existingResource.SetName(rendered.Main.GetName())
-		existingResource.SetNamespace(rendered.Main.GetNamespace())
+		existingResource.SetAPIVersion(candidate.GetAPIVersion())
+		existingResource.SetKind(candidate.GetKind())
+		existingResource.SetName(candidate.GetName())
+		existingResource.SetNamespace(candidate.GetNamespace())
 
 		err := m.kubeClient.Get(context.TODO(), types.NamespacedName{Name: existingResource.GetName(), Namespace: existingResource.GetNamespace()}, &existingResource)
 		if err != nil {
 			if !apierrors.IsNotFound(err) {
-				log.Error(err, "Can't not retrieve main workflow")
-				errs = append(errs, err)
+				log.Error(err, "Can't not retrieve sub resource", "kind", candidate.GetKind())
+				errs = append(errs, lcmif.NewResourceError(lcmif.OperationGet, &candidate, err))
 			}
+			continue
+		}
+
+		// Nothing is persisted in dry run mode, the plan shows the adoption as an update
+		var adopted bool
+		if m.dryRun {
+			_, err = lcmif.CheckAdoption(&existingResource, m.oslcRefs, m.adoptionPolicy)
 		} else {
-			deployed.Main = &existingResource
+			adopted, err = lcmif.Adopt(ctx, m.kubeClient, &existingResource, lcmif.FindResource(renderedResources, &existingResource),
+				m.oslcRefs, m.adoptionPolicy)
+		}
+		if err != nil {
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationAdopt, &existingResource, err))
+			continue
+		}
+		if adopted {
+			m.adoptedSubResources = append(m.adoptedSubResources, existingResource)
+			m.inventory.MarkAdopted(&existingResource)
+		}
+		addToFlow(deployed, &existingResource)
+		if !lcmif.IsTracked(&existingResource) {
+			addToFlow(referenced, &existingResource)
 		}
 	}
 
-	for phaseName, renderedResource := range rendered.Phases {
-		existingResource := unstructured.Unstructured{}
-		existingResource.SetAPIVersion(renderedResource.GetAPIVersion())
-		existingResource.SetKind(renderedResource.GetKind())
-		existingResource.SetName(renderedResource.GetName())
-		existingResource.SetNamespace(renderedResource.GetNamespace())
-
-		err := m.kubeClient.Get(context.TODO(), types.NamespacedName{Name: existingResource.GetName(), Namespace: existingResource.GetNamespace()}, &existingResource)
-		if err != nil {
-			if !apierrors.IsNotFound(err) {
-				log.Error(err, "Can't not retrieve phase")
-				errs = append(errs, err)
-			}
-		} else {
-			deployed.Phases[phaseName] = existingResource
+	if len(m.adoptedSubResources) != 0 {
+		if err := m.inventory.Save(ctx, m.kubeClient); err != nil {
+			return rendered, nil, err
 		}
 	}
 
-	if !deployed.CheckOwnerReference(m.oslcRefs) {
+	if len(errs) != 0 {
+		return rendered, nil, lcmif.NewMultiError(errs)
+	}
+
+	// The sub resources tracked by labels do not carry owner references
+	if !referenced.CheckOwnerReference(m.oslcRefs) {
 		return rendered, nil, lcmif.OwnershipMismatch
 	}
 
-	// TODO(jeb): not sure this is right
-	// if len(errs) != 0 {
-	//	return rendered, deployed, errs[0]
-	// }
 	return rendered, deployed, nil
 }
 
-// InstallResource creates K8s sub resources (Workflow, Job, ....) attached to this Phase CR
+// InstallResource creates K8s sub resources (Workflow, Job, ....) attached to this Oslc CR.
+// The sub resources are created wave by wave. The waves which are not reached yet are
+// created by the next updates.
 func (m basemanager) installResource(ctx context.Context) (*av1.LifecycleFlow, error) {
 
 	errs := make([]error, 0)
 	created := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
 
-	if m.deployedLifecycleFlow == nil {
+	if m.deployedLifecycleFlow == nil || m.inventory == nil {
 		// There was an error during SyncResource
 		return created, lcmif.InstallError
 	}
@@ -182,61 +390,156 @@ func (m basemanager) installResource(ctx context.Context) (*av1.LifecycleFlow, e
 		return m.deployedLifecycleFlow, err
 	}
 
-	for phaseName, toCreate := range rendered.Phases {
-		err := m.kubeClient.Create(context.TODO(), &toCreate)
-		if err != nil {
-			if !apierrors.IsAlreadyExists(err) {
-				log.Error(err, "Can't not create Phase")
-				errs = append(errs, err)
-			} else {
-				// Should consider as just created by us
-				created.Phases[phaseName] = toCreate
+	_, err = lcmif.ApplySyncWaves(context.TODO(), m.kubeClient, m.inventory, rendered.GetDependentResources(), m.sorter,
+		func(toCreate *unstructured.Unstructured) (bool, error) {
+			isNew, err := lcmif.CreateResource(context.TODO(), m.kubeClient, m.inventory, toCreate, m.oslcRefs, m.adoptionPolicy)
+			if err != nil {
+				log.Error(err, "Can't not create sub resource", "kind", toCreate.GetKind(), "name", toCreate.GetName())
+				return false, lcmif.NewResourceError(lcmif.OperationCreate, toCreate, err)
 			}
-		} else {
-			created.Phases[phaseName] = toCreate
-		}
+			addToFlow(created, toCreate.DeepCopy())
+			return isNew, nil
+		})
+	if err != nil {
+		errs = append(errs, err)
 	}
 
-	if rendered.Main != nil {
-		err := m.kubeClient.Create(context.TODO(), rendered.Main)
-		if err != nil {
-			if !apierrors.IsAlreadyExists(err) {
-				log.Error(err, "Could not create Main Workflow")
-				errs = append(errs, err)
-			} else {
-				// Should consider as just created by us
-				created.Main = rendered.Main
-			}
-		} else {
-			created.Main = rendered.Main
-		}
-	} else {
-		log.Info("No Main Workflow")
+	if err := m.runFlow(ctx, created); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := m.inventory.Save(context.TODO(), m.kubeClient); err != nil {
+		log.Error(err, "Can't not save inventory")
+		errs = append(errs, err)
 	}
 
 	if len(errs) != 0 {
-		return created, errs[0]
+		return created, lcmif.NewMultiError(errs)
 	}
 	return created, nil
 }
 
-// InstallResource updates K8s sub resources (Workflow, Job, ....) attached to this Phase CR
+// UpdateResource updates K8s sub resources (Workflow, Job, ....) attached to this Oslc CR.
+// The phases and the main workflow which changed or were newly rendered are applied using
+// server-side apply, wave by wave. Once all the waves are healthy, the objects of the
+// inventory which are not rendered anymore are deleted.
+// The previous flow contains the old version of the modified and deleted objects, the updated
+// flow the new version of the modified and created objects.
 func (m basemanager) updateResource(ctx context.Context) (*av1.LifecycleFlow, *av1.LifecycleFlow, error) {
 
+	errs := make([]error, 0)
+	previous := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
 	updated := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
 
-	if m.deployedLifecycleFlow == nil {
+	if m.deployedLifecycleFlow == nil || m.inventory == nil {
 		// There was an error during SyncResource
-		return m.deployedLifecycleFlow, updated, lcmif.UpdateError
+		return previous, updated, lcmif.UpdateError
 	}
 
-	// TODO(JEB): Big hack. ReconcileResource should do more
-	m.deployedLifecycleFlow.DeepCopyInto(updated)
+	rendered, err := m.render(ctx)
+	if err != nil {
+		return previous, updated, err
+	}
+
+	deployedResources := m.deployedLifecycleFlow.GetDependentResources()
+	completed, err := lcmif.ApplySyncWaves(context.TODO(), m.kubeClient, m.inventory, rendered.GetDependentResources(), m.sorter,
+		func(toApply *unstructured.Unstructured) (bool, error) {
+			existing := lcmif.FindResource(deployedResources, toApply)
+			if existing != nil && lcmif.DetectDrift(toApply, existing) == nil {
+				// Unchanged
+				m.inventory.Add(existing)
+				return false, nil
+			}
+
+			applied, err := lcmif.ApplyOrReplace(context.TODO(), m.kubeClient, toApply, existing)
+			if errors.Is(err, lcmif.ErrReplacePending) {
+				// The sync wave waits for the deletion of the replaced version
+				m.inventory.Add(existing)
+				return false, err
+			}
+			if err != nil {
+				log.Error(err, "Can't not apply sub resource", "kind", toApply.GetKind(), "name", toApply.GetName())
+				return false, lcmif.NewResourceError(lcmif.OperationApply, toApply, err)
+			}
+			if !applied {
+				// The change of immutable fields is ignored
+				m.inventory.Add(existing)
+				return false, nil
+			}
+
+			if existing != nil {
+				addToFlow(previous, existing)
+			}
+			addToFlow(updated, toApply.DeepCopy())
+			m.inventory.Add(toApply)
+			return true, nil
+		})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// The objects which are not rendered anymore are pruned once all the waves are healthy
+	orphans := make([]unstructured.Unstructured, 0)
+	if completed {
+		orphans = m.sorter.SortByUninstallOrder(lcmif.FindOrphans(rendered.GetDependentResources(), deployedResources))
+	}
+	for i := range orphans {
+		toDelete := &orphans[i]
+		retained, err := lcmif.RetainIfRequired(context.TODO(), m.kubeClient, toDelete, m.oslcRefs, m.retainKinds)
+		if err != nil {
+			log.Error(err, "Can't not retain sub resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationRetain, toDelete, err))
+			continue
+		}
+		if retained {
+			m.inventory.Remove(toDelete)
+			continue
+		}
+		err = m.kubeClient.Delete(context.TODO(), toDelete)
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Error(err, "Can't not prune sub resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationPrune, toDelete, err))
+			continue
+		}
+		log.Info("Pruned sub resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+		addToFlow(previous, toDelete)
+		m.inventory.Remove(toDelete)
+	}
 
-	return m.deployedLifecycleFlow, updated, nil
+	if err := m.runFlow(ctx, updated); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := m.inventory.Save(context.TODO(), m.kubeClient); err != nil {
+		log.Error(err, "Can't not save inventory")
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 0 {
+		return previous, updated, lcmif.NewMultiError(errs)
+	}
+	return previous, updated, nil
 }
 
-// ReconcileResource creates or patches resources as necessary to match this Phase CR
+// PlanResource computes the actions the install or update of the sub resources attached
+// to this Oslc CR would perform, using server-side dry run. Nothing is persisted.
+func (m basemanager) PlanResource(ctx context.Context) ([]lcmif.PlanAction, error) {
+	if m.deployedLifecycleFlow == nil || m.inventory == nil {
+		// There was an error during SyncResource
+		return nil, lcmif.SyncError
+	}
+
+	rendered, err := m.render(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return lcmif.PlanResources(ctx, m.kubeClient, rendered.GetDependentResources(),
+		m.deployedLifecycleFlow.GetDependentResources(), m.retainKinds, m.sorter)
+}
+
+// ReconcileResource creates or patches resources as necessary to match this Phase CR.
+// The flow is submitted again if it changed, or makes progress, and its progress is read.
 func (m basemanager) reconcileResource(ctx context.Context) (*av1.LifecycleFlow, error) {
 
 	reconciled := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
@@ -248,43 +551,89 @@ func (m basemanager) reconcileResource(ctx context.Context) (*av1.LifecycleFlow,
 	// TODO(JEB): Big hack. ReconcileResource should do more
 	m.deployedLifecycleFlow.DeepCopyInto(reconciled)
 
-	return reconciled, nil
+	if m.inventory == nil {
+		return reconciled, nil
+	}
+
+	if _, err := m.render(ctx); err != nil {
+		return reconciled, err
+	}
+
+	errs := make([]error, 0)
+	if err := m.runFlow(ctx, reconciled); err != nil {
+		errs = append(errs, err)
+	}
+	if err := m.inventory.Save(ctx, m.kubeClient); err != nil {
+		log.Error(err, "Can't not save inventory")
+		errs = append(errs, err)
+	}
+	return reconciled, lcmif.NewMultiError(errs)
 }
 
-// UninstallResource delete K8s sub resources (Workflow, Job, ....) attached to this Phase CR
+// UninstallResource delete K8s sub resources (Workflow, Job, ....) attached to this Oslc CR.
+// The objects to delete are taken from the inventory, hence the objects which are not
+// rendered anymore are deleted as well.
 func (m basemanager) uninstallResource(ctx context.Context) (*av1.LifecycleFlow, error) {
 	errs := make([]error, 0)
 	notdeleted := av1.NewLifecycleFlow(m.oslcNamespace, m.oslcName)
 
-	if m.deployedLifecycleFlow == nil {
+	if m.deployedLifecycleFlow == nil || m.inventory == nil {
 		// There was an error during SyncResource
 		return notdeleted, lcmif.UninstallError
 	}
 
-	if m.deployedLifecycleFlow.Main != nil {
-		err := m.kubeClient.Delete(context.TODO(), m.deployedLifecycleFlow.Main)
+	m.flowRun.Inventory = m.inventory
+	if err := m.flowBackend.Cleanup(ctx, m.flowRun); err != nil {
+		log.Error(err, "Can't not cleanup flow")
+		errs = append(errs, err)
+	}
+
+	toDeleteList := m.deployedLifecycleFlow.GetDependentResources()
+	if m.inventory.Exists() {
+		toDeleteList = m.inventory.Objects()
+	}
+
+	toDeleteList = m.sorter.SortByUninstallOrder(toDeleteList)
+	for i := range toDeleteList {
+		toDelete := &toDeleteList[i]
+		retained, err := lcmif.RetainIfRequired(context.TODO(), m.kubeClient, toDelete, m.oslcRefs, m.retainKinds)
 		if err != nil {
-			if !apierrors.IsNotFound(err) {
-				log.Error(err, "Can't not delete main flow")
-				errs = append(errs, err)
-				notdeleted.Main = m.deployedLifecycleFlow.Main
-			}
+			log.Error(err, "Can't not retain sub resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationRetain, toDelete, err))
+			addToFlow(notdeleted, toDelete)
+			continue
+		}
+		if retained {
+			m.inventory.Remove(toDelete)
+			continue
 		}
-	}
 
-	for phaseName, toDelete := range m.deployedLifecycleFlow.Phases {
-		err := m.kubeClient.Delete(context.TODO(), &toDelete)
+		opts := []client.DeleteOption{}
+		if uid := toDelete.GetUID(); uid != "" {
+			opts = append(opts, client.Preconditions{UID: &uid})
+		}
+		err = m.kubeClient.Delete(context.TODO(), toDelete, opts...)
 		if err != nil {
-			if !apierrors.IsNotFound(err) {
-				log.Error(err, "Can't not delete phase")
-				errs = append(errs, err)
-				notdeleted.Phases[phaseName] = toDelete
+			if !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				log.Error(err, "Can't not delete sub resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+				errs = append(errs, lcmif.NewResourceError(lcmif.OperationDelete, toDelete, err))
+				addToFlow(notdeleted, toDelete)
+				continue
 			}
 		}
+		m.inventory.Remove(toDelete)
 	}
 
 	if len(errs) != 0 {
-		return notdeleted, errs[0]
+		if err := m.inventory.Save(context.TODO(), m.kubeClient); err != nil {
+			log.Error(err, "Can't not save inventory")
+		}
+		return notdeleted, lcmif.NewMultiError(errs)
+	}
+
+	if err := m.inventory.Delete(context.TODO(), m.kubeClient); err != nil {
+		log.Error(err, "Can't not delete inventory")
+		return notdeleted, err
 	}
 	return notdeleted, nil
 }
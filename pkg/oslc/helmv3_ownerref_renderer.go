@@ -18,10 +18,11 @@ import (
 	helmv3 "github.com/keleustes/oslc-operator/pkg/helmv3"
 	lcmif "github.com/keleustes/oslc-operator/pkg/services"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
 )
 
 // NewOwnerRefHelmRenderer creates a new OwnerRef engine with a set of metav1.OwnerReferences to be added to assets
-func NewOwnerRefHelmRenderer(refs []metav1.OwnerReference, suffix string,
+func NewOwnerRefHelmRenderer(dc discovery.DiscoveryInterface, refs []metav1.OwnerReference, suffix string,
 	renderFiles []string, renderValues map[string]interface{}) lcmif.OwnerRefHelmRenderer {
-	return helmv3.NewOwnerRefHelmv3Renderer(refs, suffix, renderFiles, renderValues)
+	return helmv3.NewOwnerRefHelmv3Renderer(dc, refs, suffix, renderFiles, renderValues)
 }
@@ -21,18 +21,22 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"github.com/keleustes/oslc-operator/pkg/k8sutil"
 	lcmif "github.com/keleustes/oslc-operator/pkg/services"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
 )
 
 type managerFactory struct {
 	kubeClient client.Client
+	discovery  discovery.DiscoveryInterface
+	sorter     lcmif.KindSorter
 }
 
-// NewManagerFactory returns a new factory.
-func NewManagerFactory(mgr manager.Manager) lcmif.OslcManagerFactory {
-	return &managerFactory{kubeClient: mgr.GetClient()}
+// NewManagerFactory returns a new factory. The managers sort the sub resources with sorter.
+func NewManagerFactory(mgr manager.Manager, sorter lcmif.KindSorter) lcmif.OslcManagerFactory {
+	return &managerFactory{kubeClient: mgr.GetClient(), discovery: k8sutil.NewDiscoveryClient(mgr.GetConfig()), sorter: sorter}
 }
 
 // Simple function to init the renderFiles passed to the helm renderer
@@ -42,23 +46,29 @@ func initRenderFiles(stage av1.OslcFlowKind) []string {
 }
 
 // Simple function to init the renderValues passed to the helm renderer
-func initRenderValues(stage av1.OslcFlowKind) map[string]interface{} {
+func initRenderValues(stage av1.OslcFlowKind, targetVersion string, slice *lcmif.Slice) map[string]interface{} {
 	oslcValues := map[string]interface{}{}
 	oslcValues["flow_kind"] = stage.String()
+	oslcValues["target_version"] = targetVersion
+	if slice != nil {
+		oslcValues["slice"] = slice.Values()
+	}
 	renderValues := map[string]interface{}{}
 	renderValues["oslc"] = oslcValues
 	return renderValues
 }
 
 // NewOslcManager returns a new manager capable of controlling Oslc phase of the service lifecyle
-func (f managerFactory) NewOslcManager(r *av1.Oslc) lcmif.OslcManager {
+func (f managerFactory) NewOslcManager(r *av1.Oslc, extension lcmif.OslcSpecExtension) lcmif.OslcManager {
 	controllerRef := metav1.NewControllerRef(r, r.GroupVersionKind())
 	ownerRefs := []metav1.OwnerReference{
 		*controllerRef,
 	}
 
 	renderFiles := initRenderFiles(r.Spec.FlowKind)
-	renderValues := initRenderValues(r.Spec.FlowKind)
+	targetVersion := extension.TargetVersion
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(r.Spec.FlowKind, targetVersion, slice)
 
 	sourceType := r.Spec.Source.Type
 	sourceLocation := r.Spec.Source.Location
@@ -70,21 +80,47 @@ func (f managerFactory) NewOslcManager(r *av1.Oslc) lcmif.OslcManager {
 		renderValues["serviceName"] = serviceName
 	}
 
-	renderer := &oslcrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "oslc", renderFiles, renderValues),
-		spec:         r.Spec,
+	// The rollback and suspend requests are not part of the recorded spec
+	revisionSpec := lcmif.OslcSpecWithExtension{OslcSpec: r.Spec, OslcSpecExtension: extension}
+	revisionSpec.RollbackTo = nil
+	revisionSpec.Suspend = false
+
+	// The renderer is created for each rendering, once the values of the run are known
+	newRenderer := func(values map[string]interface{}) lcmif.OwnerRefHelmRenderer {
+		return &oslcrenderer{
+			helmrenderer: NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "oslc", renderFiles, values),
+			spec:         r.Spec,
+		}
 	}
 
 	return &oslcmanager{
 		basemanager: basemanager{
 			kubeClient:     f.kubeClient,
-			renderer:       renderer,
+			newRenderer:    newRenderer,
+			renderValues:   renderValues,
 			serviceName:    serviceName,
 			sourceType:     sourceType,
 			sourceLocation: sourceLocation,
+			oslc:           r,
 			oslcRefs:       ownerRefs,
 			oslcName:       r.GetName(),
-			oslcNamespace:  r.GetNamespace()},
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			flowBackend:    lcmif.GetFlowBackend(lcmif.GetFlowEngine(r)),
+			flowRun: &lcmif.FlowRun{
+				Client:    f.kubeClient,
+				Owners:    ownerRefs,
+				Name:      r.GetName(),
+				Namespace: r.GetNamespace(),
+			},
+			flowKind:      r.Spec.FlowKind.String(),
+			targetVersion: targetVersion,
+			slice:         slice,
+			revision:      lcmif.NewRevisionSnapshot(r, revisionSpec, renderValues),
+			revisionLimit: r.Spec.RevisionHistoryLimit,
+			retainKinds:   lcmif.GetRetainKinds(r),
+			sorter:        f.sorter,
+			oslcNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
 		status: &r.Status,
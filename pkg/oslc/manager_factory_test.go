@@ -0,0 +1,143 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oslc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	lcmif "github.com/keleustes/oslc-operator/pkg/services"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// flowPhases returns the annotations of the Phase CRs the steps of the Workflow act
+// upon, by name
+func flowPhases(t *testing.T, workflow *unstructured.Unstructured) map[string]map[string]string {
+	templates, _, _ := unstructured.NestedSlice(workflow.Object, "spec", "templates")
+	phases := map[string]map[string]string{}
+	for _, template := range templates {
+		manifest, _, _ := unstructured.NestedString(template.(map[string]interface{}), "resource", "manifest")
+		if manifest == "" {
+			continue
+		}
+		phase := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(manifest), &phase.Object); err != nil {
+			t.Fatalf("invalid manifest %q: %v", manifest, err)
+		}
+		if !strings.HasSuffix(phase.GetKind(), "Phase") {
+			continue
+		}
+		if annotations := phase.GetAnnotations(); annotations != nil || phases[phase.GetName()] == nil {
+			phases[phase.GetName()] = annotations
+		}
+	}
+	return phases
+}
+
+func TestSliceFlowRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		suffix      string
+		label       string
+	}{
+		{
+			name:   "whole service",
+			suffix: "",
+		},
+		{
+			name:        "zone",
+			annotations: map[string]string{lcmif.SliceZoneAnnotation: "az1"},
+			suffix:      "-az1",
+			label:       "az1",
+		},
+		{
+			name: "named slice with node selector",
+			annotations: map[string]string{
+				lcmif.SliceAnnotation:             "blue",
+				lcmif.SliceNodeSelectorAnnotation: "rack=r1",
+			},
+			suffix: "-blue",
+			label:  "blue",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := map[string]string{lcmif.FlowEngineAnnotation: string(lcmif.FlowEngineNative)}
+			for k, v := range tt.annotations {
+				annotations[k] = v
+			}
+			oslc := &av1.Oslc{
+				ObjectMeta: metav1.ObjectMeta{Name: "keystone", Namespace: "openstack", UID: "uid-keystone", Annotations: annotations},
+				Spec: av1.OslcSpec{
+					ServiceName: "keystone",
+					FlowKind:    "upgrade",
+					Source:      &av1.OslcSource{Type: "generate", Location: "../../helm-charts/keystone"},
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+			factory := managerFactory{kubeClient: c, sorter: lcmif.DefaultKindSorter}
+			m := factory.NewOslcManager(oslc, lcmif.OslcSpecExtension{TargetVersion: "stein"}).(*oslcmanager)
+			// The upgrade from rocky follows its install
+			m.inventory = lcmif.NewInventory("openstack", m.oslcRefs)
+			m.inventory.FlowRuns = []lcmif.FlowRunRecord{{Number: 1, FlowKind: "install", TargetVersion: "rocky"}}
+
+			if _, err := m.render(context.TODO()); err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if len(m.flowRun.Objects) != 1 {
+				t.Fatalf("render() rendered %d workflows, want 1", len(m.flowRun.Objects))
+			}
+			workflow := &m.flowRun.Objects[0]
+			if got := workflow.GetLabels()[lcmif.SliceLabel]; got != tt.label {
+				t.Errorf("Workflow %s = %q, want %q", lcmif.SliceLabel, got, tt.label)
+			}
+
+			// The Phase CRs of the slice are suffixed with it and carry its annotations.
+			// The operational Phase is shared by the runs.
+			want := map[string]bool{"keystone-operational" + tt.suffix: true}
+			for _, phase := range []string{"trafficdrain", "upgrade", "test", "rollback", "trafficrollout"} {
+				want["keystone-"+phase+tt.suffix+"-upgrade-2"] = true
+			}
+			phases := flowPhases(t, workflow)
+			for name, phaseAnnotations := range phases {
+				if !want[name] {
+					t.Errorf("unexpected Phase %s, want %v", name, want)
+					continue
+				}
+				if strings.HasPrefix(name, "keystone-operational") {
+					continue
+				}
+				if !reflect.DeepEqual(phaseAnnotations, tt.annotations) {
+					t.Errorf("Phase %s annotations = %v, want %v", name, phaseAnnotations, tt.annotations)
+				}
+			}
+			if len(phases) != len(want) {
+				t.Errorf("Phases = %v, want %v", phases, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,921 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oslc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	lcmif "github.com/keleustes/oslc-operator/pkg/services"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	lcmif.RegisterFlowBackend(nativeBackend{})
+}
+
+// nativeBackend executes the steps of the Workflow rendered out of the flow chart
+// within the operator, instead of submitting it to Argo.
+type nativeBackend struct{}
+
+func (b nativeBackend) Engine() lcmif.FlowEngine {
+	return lcmif.FlowEngineNative
+}
+
+func (b nativeBackend) Handles(u *unstructured.Unstructured) bool {
+	return u.GroupVersionKind().Group == "argoproj.io" && u.GetKind() == "Workflow"
+}
+
+func (b nativeBackend) Render(run *lcmif.FlowRun, rendered []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	if len(rendered) > 1 {
+		return nil, lcmif.NewTypedError(lcmif.ErrorTypeRender, fmt.Errorf("%d workflows rendered, expecting one", len(rendered)))
+	}
+	return rendered, nil
+}
+
+// Submit makes the steps of the flow progress. The Workflows submitted to Argo
+// before the Oslc switched to the native engine are deleted.
+func (b nativeBackend) Submit(ctx context.Context, run *lcmif.FlowRun) error {
+	if err := lcmif.CleanupFlowObjects(ctx, run, b); err != nil {
+		return err
+	}
+	if len(run.Objects) == 0 {
+		return nil
+	}
+
+	flow, err := newNativeFlow(run.Client, run.Owners, run.Name, run.Namespace, &run.Objects[0])
+	if err != nil {
+		return err
+	}
+	run.Inventory.Flow, err = flow.run(ctx, run.Inventory.Flow, run)
+	return err
+}
+
+func (b nativeBackend) Status(ctx context.Context, run *lcmif.FlowRun) (*lcmif.FlowStatus, error) {
+	return run.Inventory.Flow, nil
+}
+
+// Suspend holds the steps of the flow which have not started, or releases them. The
+// running steps keep being checked while the flow is suspended, hence complete.
+func (b nativeBackend) Suspend(ctx context.Context, run *lcmif.FlowRun, suspend bool) error {
+	status := run.Inventory.Flow
+	if status == nil || status.Phase.IsCompleted() {
+		return nil
+	}
+	status.Suspended = suspend
+	if !suspend || len(run.Objects) == 0 {
+		// The steps are started again by the next Submit
+		return nil
+	}
+
+	flow, err := newNativeFlow(run.Client, run.Owners, run.Name, run.Namespace, &run.Objects[0])
+	if err != nil {
+		return err
+	}
+	run.Inventory.Flow, err = flow.run(ctx, status, run)
+	return err
+}
+
+// Cancel fails the steps which are running, which fails the flow
+func (b nativeBackend) Cancel(ctx context.Context, run *lcmif.FlowRun) error {
+	status := run.Inventory.Flow
+	if status == nil || status.Phase.IsCompleted() {
+		return nil
+	}
+	for i := range status.Steps {
+		if status.Steps[i].Phase == lcmif.FlowStepRunning {
+			finishStep(&status.Steps[i], lcmif.FlowStepFailed, "cancelled")
+		}
+	}
+	status.Phase = lcmif.FlowStepFailed
+	return nil
+}
+
+// Cleanup deletes the objects created by the steps of the flow and forgets its progress
+func (b nativeBackend) Cleanup(ctx context.Context, run *lcmif.FlowRun) error {
+	if len(run.Objects) != 0 && run.Inventory.Flow != nil {
+		flow, err := newNativeFlow(run.Client, run.Owners, run.Name, run.Namespace, &run.Objects[0])
+		if err != nil {
+			return err
+		}
+		if err := flow.cleanup(ctx, run.Inventory.Flow); err != nil {
+			return err
+		}
+	}
+	run.Inventory.Flow = nil
+	return nil
+}
+
+// The native flow engine interprets the subset of the Argo Workflow spec used by the
+// flow charts: the steps (or the dag) of the entrypoint, each one running a resource
+// template.
+
+type workflowSpec struct {
+	Entrypoint string             `json:"entrypoint"`
+	Templates  []workflowTemplate `json:"templates"`
+}
+
+type workflowTemplate struct {
+	Name                  string              `json:"name"`
+	Steps                 [][]workflowStep    `json:"steps,omitempty"`
+	DAG                   *workflowDAG        `json:"dag,omitempty"`
+	Resource              *workflowResource   `json:"resource,omitempty"`
+	Outputs               workflowOutputs     `json:"outputs,omitempty"`
+	ActiveDeadlineSeconds *intstr.IntOrString `json:"activeDeadlineSeconds,omitempty"`
+	RetryStrategy         *workflowRetry      `json:"retryStrategy,omitempty"`
+}
+
+// hasOutput returns true if the template declares the output parameter
+func (t *workflowTemplate) hasOutput(name string) bool {
+	for _, parameter := range t.Outputs.Parameters {
+		if parameter.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type workflowDAG struct {
+	Tasks []workflowStep `json:"tasks"`
+}
+
+type workflowStep struct {
+	Name         string              `json:"name"`
+	Template     string              `json:"template"`
+	When         string              `json:"when,omitempty"`
+	Dependencies []string            `json:"dependencies,omitempty"`
+	ContinueOn   *workflowContinueOn `json:"continueOn,omitempty"`
+}
+
+type workflowContinueOn struct {
+	Failed bool `json:"failed,omitempty"`
+}
+
+// workflowRetry is the retryStrategy of a template. Only the limit is supported:
+// a failed step runs again until it has been retried limit times.
+type workflowRetry struct {
+	Limit       *intstr.IntOrString `json:"limit,omitempty"`
+	RetryPolicy string              `json:"retryPolicy,omitempty"`
+	Backoff     interface{}         `json:"backoff,omitempty"`
+	Affinity    interface{}         `json:"affinity,omitempty"`
+	Expression  string              `json:"expression,omitempty"`
+}
+
+type workflowResource struct {
+	Action           string `json:"action"`
+	MergeStrategy    string `json:"mergeStrategy,omitempty"`
+	Manifest         string `json:"manifest"`
+	SuccessCondition string `json:"successCondition,omitempty"`
+	FailureCondition string `json:"failureCondition,omitempty"`
+}
+
+type workflowOutputs struct {
+	Parameters []workflowParameter `json:"parameters,omitempty"`
+}
+
+type workflowParameter struct {
+	Name      string `json:"name"`
+	ValueFrom *struct {
+		JSONPath string `json:"jsonPath"`
+	} `json:"valueFrom,omitempty"`
+}
+
+// flowNode is a step of the flow with the steps it depends on
+type flowNode struct {
+	step         workflowStep
+	template     *workflowTemplate
+	dependencies []string
+	retryLimit   int
+}
+
+// continueOnFailed returns true if the flow goes on when the step failed
+func (n *flowNode) continueOnFailed() bool {
+	return n.step.ContinueOn != nil && n.step.ContinueOn.Failed
+}
+
+// nativeFlow executes the steps of a Workflow within the operator. The flow
+// progresses as far as possible during each reconcile and its progress is
+// recorded in a FlowStatus, hence the execution resumes where it stopped.
+type nativeFlow struct {
+	kubeClient   client.Client
+	owners       []metav1.OwnerReference
+	name         string
+	namespace    string
+	workflowName string
+	nodes        []flowNode
+}
+
+// newNativeFlow parses the entrypoint of the workflow into a list of nodes
+// sorted in execution order.
+func newNativeFlow(c client.Client, owners []metav1.OwnerReference, name string, namespace string,
+	workflow *unstructured.Unstructured) (*nativeFlow, error) {
+	data, err := json.Marshal(workflow.Object["spec"])
+	if err != nil {
+		return nil, lcmif.NewTypedError(lcmif.ErrorTypeRender, err)
+	}
+	spec := workflowSpec{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, lcmif.NewTypedError(lcmif.ErrorTypeRender, err)
+	}
+
+	nodes, err := parseFlowNodes(&spec)
+	if err != nil {
+		return nil, lcmif.NewTypedError(lcmif.ErrorTypeRender, fmt.Errorf("workflow %s: %v", workflow.GetName(), err))
+	}
+	for i := range nodes {
+		nodes[i].retryLimit, err = parseRetryLimit(nodes[i].template.RetryStrategy)
+		if err != nil {
+			return nil, lcmif.NewTypedError(lcmif.ErrorTypeInvalidManifest,
+				fmt.Errorf("workflow %s: retryStrategy of template %q: %v", workflow.GetName(), nodes[i].template.Name, err))
+		}
+	}
+
+	return &nativeFlow{
+		kubeClient:   c,
+		owners:       owners,
+		name:         name,
+		workflowName: workflow.GetName(),
+		namespace:    namespace,
+		nodes:        nodes,
+	}, nil
+}
+
+// parseFlowNodes returns the nodes of the entrypoint of the workflow. Each step of a
+// group of steps depends on all the steps of the previous group. The tasks of a dag
+// are sorted so that a task comes after its dependencies. The variables of the when
+// conditions and of the manifests must be resolvable by the native engine.
+func parseFlowNodes(spec *workflowSpec) ([]flowNode, error) {
+	templates := map[string]*workflowTemplate{}
+	for i := range spec.Templates {
+		templates[spec.Templates[i].Name] = &spec.Templates[i]
+	}
+
+	entrypoint, ok := templates[spec.Entrypoint]
+	if !ok {
+		return nil, fmt.Errorf("entrypoint %q not found", spec.Entrypoint)
+	}
+
+	nodes := make([]flowNode, 0)
+	switch {
+	case entrypoint.DAG != nil:
+		pending := entrypoint.DAG.Tasks
+		sorted := map[string]bool{}
+		for len(pending) != 0 {
+			remaining := make([]workflowStep, 0)
+			for _, task := range pending {
+				ready := true
+				for _, dependency := range task.Dependencies {
+					ready = ready && sorted[dependency]
+				}
+				if !ready {
+					remaining = append(remaining, task)
+					continue
+				}
+				nodes = append(nodes, flowNode{step: task, dependencies: task.Dependencies})
+				sorted[task.Name] = true
+			}
+			if len(remaining) == len(pending) {
+				return nil, fmt.Errorf("task %q has unknown or cyclic dependencies", remaining[0].Name)
+			}
+			pending = remaining
+		}
+	case len(entrypoint.Steps) != 0:
+		var previous []string
+		for _, group := range entrypoint.Steps {
+			current := make([]string, 0, len(group))
+			for _, step := range group {
+				nodes = append(nodes, flowNode{step: step, dependencies: previous})
+				current = append(current, step.Name)
+			}
+			previous = current
+		}
+	default:
+		return nil, fmt.Errorf("entrypoint %q has neither steps nor dag", spec.Entrypoint)
+	}
+
+	for i := range nodes {
+		template, ok := templates[nodes[i].step.Template]
+		if !ok {
+			return nil, fmt.Errorf("template %q of step %q not found", nodes[i].step.Template, nodes[i].step.Name)
+		}
+		if template.Resource == nil {
+			return nil, fmt.Errorf("template %q of step %q is not a resource template", template.Name, nodes[i].step.Name)
+		}
+		nodes[i].template = template
+	}
+
+	byName := map[string]*flowNode{}
+	for i := range nodes {
+		byName[nodes[i].step.Name] = &nodes[i]
+	}
+	for i := range nodes {
+		for _, text := range []string{nodes[i].step.When, nodes[i].template.Resource.Manifest} {
+			for _, match := range variablePattern.FindAllStringSubmatch(text, -1) {
+				if err := checkVariable(match[1], byName); err != nil {
+					return nil, fmt.Errorf("step %q: %v", nodes[i].step.Name, err)
+				}
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// parseRetryLimit returns the number of times a failed step is retried. The retry
+// policies are equivalent since the native engine only reports failures, the
+// errors being retried by the next reconcile anyway.
+func parseRetryLimit(retry *workflowRetry) (int, error) {
+	if retry == nil {
+		return 0, nil
+	}
+	if retry.Backoff != nil || retry.Affinity != nil || retry.Expression != "" {
+		return 0, fmt.Errorf("only the limit and the retryPolicy are supported")
+	}
+	switch retry.RetryPolicy {
+	case "", "Always", "OnFailure", "OnError", "OnTransientError":
+	default:
+		return 0, fmt.Errorf("unsupported retryPolicy %q", retry.RetryPolicy)
+	}
+	if retry.Limit == nil {
+		return 0, nil
+	}
+
+	limit := retry.Limit.IntValue()
+	if retry.Limit.Type == intstr.String {
+		var err error
+		if limit, err = strconv.Atoi(retry.Limit.StrVal); err != nil {
+			return 0, fmt.Errorf("invalid limit %q", retry.Limit.StrVal)
+		}
+	}
+	if limit < 0 {
+		return 0, fmt.Errorf("invalid limit %d", limit)
+	}
+	return limit, nil
+}
+
+// run executes the steps which can progress, in order, and returns the updated progress
+// of the flow. A step starts once all the steps it depends on completed. A failed step
+// stops the flow unless it continues on failure. The objects the steps act upon are
+// added to the touched objects of the run. The steps which have not started are held
+// while the flow is suspended.
+func (f *nativeFlow) run(ctx context.Context, status *lcmif.FlowStatus, run *lcmif.FlowRun) (*lcmif.FlowStatus, error) {
+	status = f.initStatus(status)
+	if status.Phase.IsCompleted() {
+		return status, nil
+	}
+
+	errs := make([]error, 0)
+	for i := range f.nodes {
+		node := &f.nodes[i]
+		step := status.Step(node.step.Name)
+		if step.Phase.IsCompleted() || !f.isReady(node, status) {
+			continue
+		}
+		if status.Suspended && step.Phase == lcmif.FlowStepPending {
+			// Held until the flow is resumed
+			continue
+		}
+
+		if node.step.When != "" {
+			proceed, err := f.evaluateWhen(node.step.When, status)
+			if err != nil {
+				finishStep(step, lcmif.FlowStepFailed, err.Error())
+				continue
+			}
+			if !proceed {
+				finishStep(step, lcmif.FlowStepSkipped, "when "+node.step.When+" is false")
+				continue
+			}
+		}
+
+		if err := f.execute(ctx, node, step, status, run); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	status.Phase = f.phase(status)
+	if status.Phase.IsCompleted() {
+		log.Info("Flow completed", "oslc", f.name, "phase", status.Phase)
+	}
+	return status, lcmif.NewMultiError(errs)
+}
+
+// initStatus returns a progress containing one step per node, in execution order
+func (f *nativeFlow) initStatus(status *lcmif.FlowStatus) *lcmif.FlowStatus {
+	if status == nil {
+		status = &lcmif.FlowStatus{Phase: lcmif.FlowStepPending}
+	}
+
+	steps := make([]lcmif.FlowStep, 0, len(f.nodes))
+	for _, node := range f.nodes {
+		if existing := status.Step(node.step.Name); existing != nil {
+			steps = append(steps, *existing)
+		} else {
+			steps = append(steps, lcmif.FlowStep{Name: node.step.Name, Phase: lcmif.FlowStepPending})
+		}
+	}
+	status.Steps = steps
+	return status
+}
+
+// isReady returns true if all the steps the node depends on completed, and
+// none of them failed unless it continues on failure
+func (f *nativeFlow) isReady(node *flowNode, status *lcmif.FlowStatus) bool {
+	for _, dependency := range node.dependencies {
+		step := status.Step(dependency)
+		if step == nil || !step.Phase.IsCompleted() {
+			return false
+		}
+		if step.Phase == lcmif.FlowStepFailed && !f.node(dependency).continueOnFailed() {
+			return false
+		}
+	}
+	return true
+}
+
+// phase returns Failed if a step which does not continue on failure failed,
+// Succeeded if all the steps completed and Running otherwise
+func (f *nativeFlow) phase(status *lcmif.FlowStatus) lcmif.FlowStepPhase {
+	completed := true
+	for _, step := range status.Steps {
+		if step.Phase == lcmif.FlowStepFailed && !f.node(step.Name).continueOnFailed() {
+			return lcmif.FlowStepFailed
+		}
+		completed = completed && step.Phase.IsCompleted()
+	}
+	if completed {
+		return lcmif.FlowStepSucceeded
+	}
+	return lcmif.FlowStepRunning
+}
+
+func (f *nativeFlow) node(name string) *flowNode {
+	for i := range f.nodes {
+		if f.nodes[i].step.Name == name {
+			return &f.nodes[i]
+		}
+	}
+	return nil
+}
+
+// execute performs the action of the resource template of the node. The step stays
+// Running while its success condition is not met. The errors returned are the ones
+// which may succeed during the next reconcile, the other ones fail the step.
+func (f *nativeFlow) execute(ctx context.Context, node *flowNode, step *lcmif.FlowStep,
+	status *lcmif.FlowStatus, run *lcmif.FlowRun) error {
+	resource := node.template.Resource
+	if step.StartedAt == nil {
+		now := metav1.Now()
+		step.StartedAt = &now
+		step.Phase = lcmif.FlowStepRunning
+		log.Info("Flow step started", "oslc", f.name, "step", step.Name)
+	}
+
+	obj, err := f.manifest(node, status)
+	if err != nil {
+		finishStep(step, lcmif.FlowStepFailed, err.Error())
+		return nil
+	}
+	step.Kind = obj.GetKind()
+	step.ObjectName = obj.GetName()
+
+	if deadline := node.template.ActiveDeadlineSeconds; deadline != nil && deadline.IntValue() > 0 {
+		if time.Since(step.StartedAt.Time) > time.Duration(deadline.IntValue())*time.Second {
+			f.fail(node, step, "active deadline exceeded")
+			return nil
+		}
+	}
+
+	live := obj
+	switch resource.Action {
+	case "create":
+		err = f.create(ctx, obj)
+	case "apply":
+		err = lcmif.ApplyResource(ctx, f.kubeClient, obj)
+	case "patch":
+		err = f.patch(ctx, obj, resource.MergeStrategy)
+	case "get":
+		live, err = f.get(ctx, obj)
+		if apierrors.IsNotFound(err) {
+			step.Message = "waiting for " + obj.GetKind() + " " + obj.GetName()
+			return nil
+		}
+	case "delete":
+		err = f.kubeClient.Delete(ctx, obj)
+		if err == nil || apierrors.IsNotFound(err) {
+			finishStep(step, lcmif.FlowStepSucceeded, "")
+			return nil
+		}
+	default:
+		finishStep(step, lcmif.FlowStepFailed, fmt.Sprintf("unsupported action %q", resource.Action))
+		return nil
+	}
+	if err != nil {
+		if lcmif.ErrorTypeOf(err) == lcmif.ErrorTypeInvalidManifest {
+			f.fail(node, step, err.Error())
+			return nil
+		}
+		return lcmif.NewResourceError(resource.Action, obj, err)
+	}
+	run.Touched = append(run.Touched, *live.DeepCopy())
+
+	outputs := map[string]string{}
+	for _, parameter := range node.template.Outputs.Parameters {
+		if parameter.ValueFrom == nil || parameter.ValueFrom.JSONPath == "" {
+			continue
+		}
+		value, err := jsonPathValue(live, parameter.ValueFrom.JSONPath)
+		if err != nil {
+			f.fail(node, step, err.Error())
+			return nil
+		}
+		outputs[parameter.Name] = value
+	}
+	step.Outputs = outputs
+
+	if resource.FailureCondition != "" {
+		failed, err := matchCondition(live, resource.FailureCondition)
+		if err != nil || failed {
+			message := "failure condition " + resource.FailureCondition + " met"
+			if err != nil {
+				message = err.Error()
+			}
+			f.fail(node, step, message)
+			return nil
+		}
+	}
+	if resource.SuccessCondition != "" {
+		succeeded, err := matchCondition(live, resource.SuccessCondition)
+		if err != nil {
+			f.fail(node, step, err.Error())
+			return nil
+		}
+		if !succeeded {
+			step.Message = "waiting for " + resource.SuccessCondition
+			return nil
+		}
+	}
+	finishStep(step, lcmif.FlowStepSucceeded, "")
+	return nil
+}
+
+// fail records the failure of a step, unless the retryStrategy of its template allows
+// to retry it, in which case the step starts again during the next reconcile.
+func (f *nativeFlow) fail(node *flowNode, step *lcmif.FlowStep, message string) {
+	if step.Retries >= node.retryLimit {
+		finishStep(step, lcmif.FlowStepFailed, message)
+		return
+	}
+
+	step.Retries++
+	now := metav1.Now()
+	step.StartedAt = &now
+	step.Phase = lcmif.FlowStepRunning
+	step.Message = fmt.Sprintf("retry %d/%d: %s", step.Retries, node.retryLimit, message)
+	log.Info("Flow step retried", "oslc", f.name, "step", step.Name, "retries", step.Retries, "message", message)
+}
+
+// manifest returns the object of the resource template of the node
+func (f *nativeFlow) manifest(node *flowNode, status *lcmif.FlowStatus) (*unstructured.Unstructured, error) {
+	manifest, err := f.substitute(node.template.Resource.Manifest, status)
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(manifest), &content); err != nil {
+		return nil, err
+	}
+
+	obj := &unstructured.Unstructured{Object: content}
+	if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+		return nil, fmt.Errorf("manifest of template %q is missing apiVersion or kind", node.template.Name)
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(f.namespace)
+	}
+	return obj, nil
+}
+
+// create creates the object, owned by the Oslc instead of the workflow
+func (f *nativeFlow) create(ctx context.Context, obj *unstructured.Unstructured) error {
+	obj.SetOwnerReferences(f.owners)
+	items := []unstructured.Unstructured{*obj}
+	if err := lcmif.TrackOwnership(f.kubeClient.RESTMapper(), items, f.owners, f.namespace); err != nil {
+		return err
+	}
+	*obj = items[0]
+
+	err := f.kubeClient.Create(ctx, obj)
+	if apierrors.IsAlreadyExists(err) {
+		// Created during a previous reconcile
+		return f.kubeClient.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, obj)
+	}
+	return err
+}
+
+// patch patches the object with the manifest, using the merge strategy of the template.
+// The json strategy is not supported since its manifest is not an object.
+func (f *nativeFlow) patch(ctx context.Context, obj *unstructured.Unstructured, mergeStrategy string) error {
+	var patchType types.PatchType
+	switch mergeStrategy {
+	case "merge":
+		patchType = types.MergePatchType
+	case "", "strategic":
+		patchType = types.StrategicMergePatchType
+	default:
+		return lcmif.NewTypedError(lcmif.ErrorTypeInvalidManifest, fmt.Errorf("unsupported merge strategy %q", mergeStrategy))
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	return f.kubeClient.Patch(ctx, obj, client.RawPatch(patchType, data))
+}
+
+// get retrieves the live version of the object
+func (f *nativeFlow) get(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(obj.GroupVersionKind())
+	err := f.kubeClient.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, live)
+	return live, err
+}
+
+// cleanup deletes the objects created by the steps which started
+func (f *nativeFlow) cleanup(ctx context.Context, status *lcmif.FlowStatus) error {
+	errs := make([]error, 0)
+	for i := range f.nodes {
+		node := &f.nodes[i]
+		step := status.Step(node.step.Name)
+		if node.template.Resource.Action != "create" || step == nil || step.StartedAt == nil {
+			continue
+		}
+		obj, err := f.manifest(node, status)
+		if err != nil {
+			continue
+		}
+		if err := f.kubeClient.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationDelete, obj, err))
+		}
+	}
+	return lcmif.NewMultiError(errs)
+}
+
+// finishStep records the completion of a step
+func finishStep(step *lcmif.FlowStep, phase lcmif.FlowStepPhase, message string) {
+	now := metav1.Now()
+	if step.StartedAt == nil {
+		step.StartedAt = &now
+	}
+	step.Phase = phase
+	step.Message = message
+	step.FinishedAt = &now
+	log.Info("Flow step completed", "step", step.Name, "phase", phase, "message", message)
+}
+
+var variablePattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// substitute resolves the workflow.name, workflow.namespace and workflow.uid variables,
+// the status of the steps or tasks and the references to their output parameters. The
+// other variables, such as the ones of the Workflows created by the steps, are left
+// untouched. It fails if a variable of the native engine can not be resolved.
+func (f *nativeFlow) substitute(text string, status *lcmif.FlowStatus) (string, error) {
+	var err error
+	result := variablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		value, ok, resolveErr := f.resolve(variablePattern.FindStringSubmatch(match)[1], status)
+		if resolveErr != nil && err == nil {
+			err = resolveErr
+		}
+		if !ok || resolveErr != nil {
+			return match
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// resolve returns the value of a variable. ok is false for the variables which are
+// not handled by the native engine.
+func (f *nativeFlow) resolve(variable string, status *lcmif.FlowStatus) (string, bool, error) {
+	switch variable {
+	case "workflow.name":
+		return f.workflowName, true, nil
+	case "workflow.namespace":
+		return f.namespace, true, nil
+	case "workflow.uid":
+		if len(f.owners) == 0 {
+			return "", true, fmt.Errorf("variable %q can not be resolved without owner", variable)
+		}
+		return string(f.owners[0].UID), true, nil
+	}
+
+	name, output, ok := parseStepVariable(variable)
+	if !ok {
+		if isEngineVariable(variable) {
+			return "", true, fmt.Errorf("unsupported variable %q", variable)
+		}
+		return "", false, nil
+	}
+
+	step := status.Step(name)
+	if step == nil || !step.Phase.IsCompleted() {
+		return "", true, fmt.Errorf("variable %q references step %q which did not complete", variable, name)
+	}
+	if output == "" {
+		return string(step.Phase), true, nil
+	}
+	value, found := step.Outputs[output]
+	if !found {
+		return "", true, fmt.Errorf("variable %q references output %q which step %q did not produce", variable, output, name)
+	}
+	return value, true, nil
+}
+
+// checkVariable verifies that a variable of the native engine references a step of the
+// flow, and one of the output parameters declared by its template.
+func checkVariable(variable string, nodes map[string]*flowNode) error {
+	switch variable {
+	case "workflow.name", "workflow.namespace", "workflow.uid":
+		return nil
+	}
+
+	name, output, ok := parseStepVariable(variable)
+	if !ok {
+		if isEngineVariable(variable) {
+			return fmt.Errorf("unsupported variable %q", variable)
+		}
+		return nil
+	}
+	node, found := nodes[name]
+	if !found {
+		return fmt.Errorf("variable %q references unknown step %q", variable, name)
+	}
+	if output != "" && !node.template.hasOutput(output) {
+		return fmt.Errorf("variable %q references unknown output %q", variable, output)
+	}
+	return nil
+}
+
+// isEngineVariable returns true if the variable belongs to the scopes handled by the native engine
+func isEngineVariable(variable string) bool {
+	return strings.HasPrefix(variable, "workflow.") || strings.HasPrefix(variable, "steps.") ||
+		strings.HasPrefix(variable, "tasks.")
+}
+
+// parseStepVariable splits a steps.<name>.status or steps.<name>.outputs.parameters.<output>
+// variable, or its tasks equivalent. The output is empty for the status.
+func parseStepVariable(variable string) (string, string, bool) {
+	for _, scope := range []string{"steps.", "tasks."} {
+		if !strings.HasPrefix(variable, scope) {
+			continue
+		}
+		reference := strings.TrimPrefix(variable, scope)
+		if parts := strings.SplitN(reference, ".outputs.parameters.", 2); len(parts) == 2 {
+			return parts[0], parts[1], true
+		}
+		if name := strings.TrimSuffix(reference, ".status"); name != reference {
+			return name, "", true
+		}
+	}
+	return "", "", false
+}
+
+// evaluateWhen substitutes the variables of the when condition of a step and evaluates it
+func (f *nativeFlow) evaluateWhen(when string, status *lcmif.FlowStatus) (bool, error) {
+	expression, err := f.substitute(when, status)
+	if err != nil {
+		return false, err
+	}
+	return evaluateWhen(expression)
+}
+
+// evaluateWhen evaluates the when expression of a step, once its variables have been
+// substituted. The supported expressions are comparisons using == and != combined
+// with && and ||, as well as true and false.
+func evaluateWhen(expression string) (bool, error) {
+	for _, alternative := range strings.Split(expression, "||") {
+		all := true
+		for _, term := range strings.Split(alternative, "&&") {
+			result, err := evaluateComparison(strings.TrimSpace(term))
+			if err != nil {
+				return false, err
+			}
+			all = all && result
+		}
+		if all {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evaluateComparison(term string) (bool, error) {
+	switch term {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	for _, operator := range []string{"==", "!="} {
+		if i := strings.Index(term, operator); i >= 0 {
+			left := strings.Trim(strings.TrimSpace(term[:i]), `"'`)
+			right := strings.Trim(strings.TrimSpace(term[i+len(operator):]), `"'`)
+			return (left == right) == (operator == "=="), nil
+		}
+	}
+	return false, fmt.Errorf("unsupported expression %q", term)
+}
+
+// matchCondition evaluates a success or failure condition of a resource template on
+// the object. The condition is a comma separated list of requirements, such as
+// "status.actualState == deployed", which must all be met. The supported operators
+// are ==, =, !=, > and <.
+func matchCondition(u *unstructured.Unstructured, condition string) (bool, error) {
+	for _, requirement := range strings.Split(condition, ",") {
+		matched, err := matchRequirement(u, strings.TrimSpace(requirement))
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchRequirement(u *unstructured.Unstructured, requirement string) (bool, error) {
+	for _, operator := range []string{"==", "!=", ">", "<", "="} {
+		i := strings.Index(requirement, operator)
+		if i < 0 {
+			continue
+		}
+		path := strings.TrimSpace(requirement[:i])
+		expected := strings.TrimSpace(requirement[i+len(operator):])
+
+		value, found, err := unstructured.NestedFieldNoCopy(u.Object, strings.Split(path, ".")...)
+		if err != nil {
+			return false, err
+		}
+		actual := fmt.Sprint(value)
+
+		switch operator {
+		case "==", "=":
+			return found && actual == expected, nil
+		case "!=":
+			return !found || actual != expected, nil
+		default:
+			if !found {
+				return false, nil
+			}
+			a, err := strconv.ParseFloat(actual, 64)
+			if err != nil {
+				return false, err
+			}
+			b, err := strconv.ParseFloat(expected, 64)
+			if err != nil {
+				return false, err
+			}
+			return (operator == ">" && a > b) || (operator == "<" && a < b), nil
+		}
+	}
+	return false, fmt.Errorf("unsupported condition %q", requirement)
+}
+
+// jsonPathValue evaluates the jsonPath of an output parameter on the object
+func jsonPathValue(u *unstructured.Unstructured, path string) (string, error) {
+	parser := jsonpath.New("output").AllowMissingKeys(true)
+	if err := parser.Parse(path); err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := parser.Execute(buf, u.Object); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,354 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oslc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lcmif "github.com/keleustes/oslc-operator/pkg/services"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// resourceTemplate returns a get template declaring the outputs
+func resourceTemplate(name string, manifest string, outputs ...string) workflowTemplate {
+	template := workflowTemplate{Name: name, Resource: &workflowResource{Action: "get", Manifest: manifest}}
+	for _, output := range outputs {
+		template.Outputs.Parameters = append(template.Outputs.Parameters, workflowParameter{Name: output})
+	}
+	return template
+}
+
+// nodeNames returns the names of the nodes with their dependencies
+func nodeNames(nodes []flowNode) [][]string {
+	names := make([][]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, append([]string{node.step.Name}, node.dependencies...))
+	}
+	return names
+}
+
+func TestParseFlowNodes(t *testing.T) {
+	templates := []workflowTemplate{
+		resourceTemplate("get", "kind: TestPhase", "test-results"),
+		{Name: "script"},
+	}
+
+	tests := []struct {
+		name    string
+		spec    workflowSpec
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "steps",
+			spec: workflowSpec{Entrypoint: "main", Templates: append([]workflowTemplate{{Name: "main", Steps: [][]workflowStep{
+				{{Name: "a", Template: "get"}},
+				{{Name: "b", Template: "get"}, {Name: "c", Template: "get"}},
+				{{Name: "d", Template: "get", When: "{{steps.a.outputs.parameters.test-results}} == failed"}},
+			}}}, templates...)},
+			want: [][]string{{"a"}, {"b", "a"}, {"c", "a"}, {"d", "b", "c"}},
+		},
+		{
+			name: "dag",
+			spec: workflowSpec{Entrypoint: "main", Templates: append([]workflowTemplate{{Name: "main", DAG: &workflowDAG{Tasks: []workflowStep{
+				{Name: "c", Template: "get", Dependencies: []string{"a", "b"}},
+				{Name: "b", Template: "get", Dependencies: []string{"a"}, When: "{{tasks.a.status}} == Succeeded"},
+				{Name: "a", Template: "get"},
+			}}}}, templates...)},
+			want: [][]string{{"a"}, {"b", "a"}, {"c", "a", "b"}},
+		},
+		{
+			name: "cyclic dependencies",
+			spec: workflowSpec{Entrypoint: "main", Templates: append([]workflowTemplate{{Name: "main", DAG: &workflowDAG{Tasks: []workflowStep{
+				{Name: "a", Template: "get", Dependencies: []string{"b"}},
+				{Name: "b", Template: "get", Dependencies: []string{"a"}},
+			}}}}, templates...)},
+			wantErr: true,
+		},
+		{
+			name:    "missing entrypoint",
+			spec:    workflowSpec{Entrypoint: "main", Templates: templates},
+			wantErr: true,
+		},
+		{
+			name:    "entrypoint without steps",
+			spec:    workflowSpec{Entrypoint: "script", Templates: templates},
+			wantErr: true,
+		},
+		{
+			name: "unknown template",
+			spec: workflowSpec{Entrypoint: "main", Templates: append([]workflowTemplate{{Name: "main", Steps: [][]workflowStep{
+				{{Name: "a", Template: "missing"}},
+			}}}, templates...)},
+			wantErr: true,
+		},
+		{
+			name: "not a resource template",
+			spec: workflowSpec{Entrypoint: "main", Templates: append([]workflowTemplate{{Name: "main", Steps: [][]workflowStep{
+				{{Name: "a", Template: "script"}},
+			}}}, templates...)},
+			wantErr: true,
+		},
+		{
+			name: "unknown step variable",
+			spec: workflowSpec{Entrypoint: "main", Templates: append([]workflowTemplate{{Name: "main", Steps: [][]workflowStep{
+				{{Name: "a", Template: "get", When: "{{steps.missing.status}} == Failed"}},
+			}}}, templates...)},
+			wantErr: true,
+		},
+		{
+			name: "unknown output variable",
+			spec: workflowSpec{Entrypoint: "main", Templates: append([]workflowTemplate{{Name: "main", Steps: [][]workflowStep{
+				{{Name: "a", Template: "get"}},
+				{{Name: "b", Template: "get", When: "{{steps.a.outputs.parameters.missing}} == failed"}},
+			}}}, templates...)},
+			wantErr: true,
+		},
+		{
+			name: "unsupported workflow variable",
+			spec: workflowSpec{Entrypoint: "main", Templates: []workflowTemplate{
+				{Name: "main", Steps: [][]workflowStep{{{Name: "a", Template: "manifest"}}}},
+				resourceTemplate("manifest", "name: {{workflow.parameters.name}}"),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "variables of other scopes",
+			spec: workflowSpec{Entrypoint: "main", Templates: []workflowTemplate{
+				{Name: "main", Steps: [][]workflowStep{{{Name: "a", Template: "manifest"}}}},
+				resourceTemplate("manifest", "name: {{workflow.name}}\nvalue: {{inputs.parameters.service}}"),
+			}},
+			want: [][]string{{"a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := parseFlowNodes(&tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlowNodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := nodeNames(nodes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFlowNodes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryLimit(t *testing.T) {
+	limit := intstr.FromInt(3)
+	stringLimit := intstr.FromString("2")
+	invalidLimit := intstr.FromString("twice")
+
+	tests := []struct {
+		name    string
+		retry   *workflowRetry
+		want    int
+		wantErr bool
+	}{
+		{name: "no retry strategy", retry: nil, want: 0},
+		{name: "no limit", retry: &workflowRetry{}, want: 0},
+		{name: "limit", retry: &workflowRetry{Limit: &limit}, want: 3},
+		{name: "string limit", retry: &workflowRetry{Limit: &stringLimit, RetryPolicy: "Always"}, want: 2},
+		{name: "invalid limit", retry: &workflowRetry{Limit: &invalidLimit}, wantErr: true},
+		{name: "unsupported policy", retry: &workflowRetry{Limit: &limit, RetryPolicy: "Never"}, wantErr: true},
+		{name: "backoff", retry: &workflowRetry{Limit: &limit, Backoff: map[string]interface{}{"duration": "1m"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRetryLimit(tt.retry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRetryLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseRetryLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFail(t *testing.T) {
+	f := &nativeFlow{name: "keystone"}
+	node := &flowNode{step: workflowStep{Name: "a"}, retryLimit: 1}
+	step := &lcmif.FlowStep{Name: "a", Phase: lcmif.FlowStepRunning}
+
+	f.fail(node, step, "failure condition met")
+	if step.Phase != lcmif.FlowStepRunning || step.Retries != 1 || step.FinishedAt != nil {
+		t.Errorf("fail() did not retry the step: %v", step)
+	}
+
+	f.fail(node, step, "failure condition met")
+	if step.Phase != lcmif.FlowStepFailed || step.Retries != 1 || step.FinishedAt == nil {
+		t.Errorf("fail() did not fail the step once the limit is reached: %v", step)
+	}
+}
+
+func TestRunSuspended(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openstack", Name: "keystone"}}
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(cm).Build()
+	template := resourceTemplate("get", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: keystone\n  namespace: openstack\n")
+	f := &nativeFlow{kubeClient: c, name: "keystone", namespace: "openstack", nodes: []flowNode{
+		{step: workflowStep{Name: "a", Template: "get"}, template: &template},
+		{step: workflowStep{Name: "b", Template: "get"}, template: &template, dependencies: []string{"a"}},
+	}}
+
+	// The running step completes, the next one is held
+	now := metav1.Now()
+	status := &lcmif.FlowStatus{Phase: lcmif.FlowStepRunning, Suspended: true, Steps: []lcmif.FlowStep{
+		{Name: "a", Phase: lcmif.FlowStepRunning, StartedAt: &now},
+		{Name: "b", Phase: lcmif.FlowStepPending},
+	}}
+	status, err := f.run(context.TODO(), status, &lcmif.FlowRun{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Step("a").Phase != lcmif.FlowStepSucceeded || status.Step("b").Phase != lcmif.FlowStepPending {
+		t.Fatalf("run() suspended steps = %v, want a succeeded and b held", status.Steps)
+	}
+	if status.Phase != lcmif.FlowStepRunning {
+		t.Errorf("run() suspended phase = %v, want %v", status.Phase, lcmif.FlowStepRunning)
+	}
+
+	// Released once resumed
+	status.Suspended = false
+	status, err = f.run(context.TODO(), status, &lcmif.FlowRun{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Step("b").Phase != lcmif.FlowStepSucceeded || status.Phase != lcmif.FlowStepSucceeded {
+		t.Errorf("run() resumed steps = %v, want all succeeded", status.Steps)
+	}
+}
+
+func TestEvaluateWhen(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{expression: "true", want: true},
+		{expression: "false", want: false},
+		{expression: "failed == failed", want: true},
+		{expression: `"failed" == 'failed'`, want: true},
+		{expression: "deployed == failed", want: false},
+		{expression: "deployed != failed", want: true},
+		{expression: "a == a && b == c", want: false},
+		{expression: "a == b || b == b", want: true},
+		{expression: "a == b && b == b || c == c", want: true},
+		{expression: "a > b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := evaluateWhen(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluateWhen() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("evaluateWhen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	f := &nativeFlow{
+		workflowName: "keystone-upgrade",
+		namespace:    "openstack",
+		owners:       []metav1.OwnerReference{{Name: "keystone", UID: "1234"}},
+	}
+	status := &lcmif.FlowStatus{Steps: []lcmif.FlowStep{
+		{Name: "test", Phase: lcmif.FlowStepFailed, Outputs: map[string]string{"test-results": "failed"}},
+		{Name: "upgrade", Phase: lcmif.FlowStepRunning},
+	}}
+
+	tests := []struct {
+		name    string
+		text    string
+		flow    *nativeFlow
+		want    string
+		wantErr bool
+	}{
+		{name: "workflow", text: "{{workflow.name}}/{{ workflow.namespace }}/{{workflow.uid}}", flow: f, want: "keystone-upgrade/openstack/1234"},
+		{name: "output", text: "{{steps.test.outputs.parameters.test-results}} == failed", flow: f, want: "failed == failed"},
+		{name: "task output", text: "{{tasks.test.outputs.parameters.test-results}}", flow: f, want: "failed"},
+		{name: "status", text: "{{steps.test.status}} == Failed", flow: f, want: "Failed == Failed"},
+		{name: "other scope", text: "{{inputs.parameters.service}}", flow: f, want: "{{inputs.parameters.service}}"},
+		{name: "missing output", text: "{{steps.test.outputs.parameters.missing}}", flow: f, wantErr: true},
+		{name: "running step", text: "{{steps.upgrade.status}}", flow: f, wantErr: true},
+		{name: "unknown step", text: "{{steps.missing.status}}", flow: f, wantErr: true},
+		{name: "unsupported variable", text: "{{workflow.parameters.name}}", flow: f, wantErr: true},
+		{name: "uid without owner", text: "{{workflow.uid}}", flow: &nativeFlow{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.flow.substitute(tt.text, status)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("substitute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("substitute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRequirement(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"actualState": "deployed",
+			"succeeded":   int64(3),
+		},
+	}}
+
+	tests := []struct {
+		requirement string
+		want        bool
+		wantErr     bool
+	}{
+		{requirement: "status.actualState == deployed", want: true},
+		{requirement: "status.actualState = deployed", want: true},
+		{requirement: "status.actualState == failed", want: false},
+		{requirement: "status.actualState != failed", want: true},
+		{requirement: "status.missing != failed", want: true},
+		{requirement: "status.missing == failed", want: false},
+		{requirement: "status.succeeded > 2", want: true},
+		{requirement: "status.succeeded < 2", want: false},
+		{requirement: "status.missing > 2", want: false},
+		{requirement: "status.actualState > 2", wantErr: true},
+		{requirement: "status.actualState", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.requirement, func(t *testing.T) {
+			got, err := matchRequirement(u, tt.requirement)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matchRequirement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("matchRequirement() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -44,6 +44,35 @@ func (o deleterenderer) RenderChart(name string, namespace string, chartLocation
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the DeletePhase spec on top of the initial renderValues
+func (o deleterenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseDelete, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
+// databaseRetainKinds are the sub resources holding the data of the database of the
+// service: the PersistentVolumeClaims, and the credentials Secrets and backup Jobs
+// carrying the DatabaseLabel.
+var databaseRetainKinds = []string{
+	"PersistentVolumeClaim",
+	"Secret:" + lcmif.DatabaseLabel,
+	"Job:" + lcmif.DatabaseLabel,
+}
+
+// deleteRetainKinds returns the kinds of sub resources the DeletePhase retains.
+// Unless the database is purged, the sub resources holding its data are kept on
+// top of the kinds listed in the RetainKindsAnnotation.
+func deleteRetainKinds(r *av1.DeletePhase) []string {
+	retainKinds := lcmif.GetRetainKinds(r)
+	if r.Spec.PurgeDB != "true" {
+		retainKinds = append(retainKinds, databaseRetainKinds...)
+	}
+	return retainKinds
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this DeletePhase CR
 func (m *deletemanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
@@ -0,0 +1,110 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osphases
+
+import (
+	"testing"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	lcmif "github.com/keleustes/oslc-operator/pkg/services"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newSubResource returns a sub resource of the kind carrying the labels
+func newSubResource(apiVersion string, kind string, name string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace("openstack")
+	u.SetName(name)
+	u.SetLabels(labels)
+	return u
+}
+
+// retained returns the names of the sub resources retained with retainKinds
+func retained(items []*unstructured.Unstructured, retainKinds []string) map[string]bool {
+	names := map[string]bool{}
+	for _, u := range items {
+		if lcmif.IsRetained(u, retainKinds) {
+			names[u.GetName()] = true
+		}
+	}
+	return names
+}
+
+func TestDatabaseRetention(t *testing.T) {
+	database := map[string]string{lcmif.DatabaseLabel: ""}
+	items := []*unstructured.Unstructured{
+		newSubResource("v1", "PersistentVolumeClaim", "mariadb-data", nil),
+		newSubResource("v1", "Secret", "keystone-db-admin", database),
+		newSubResource("batch/v1", "Job", "keystone-db-backup", database),
+		newSubResource("v1", "Secret", "keystone-etc", nil),
+		newSubResource("batch/v1", "Job", "keystone-db-sync", nil),
+		newSubResource("v1", "ConfigMap", "keystone-bin", nil),
+	}
+	databaseItems := map[string]bool{"mariadb-data": true, "keystone-db-admin": true, "keystone-db-backup": true}
+
+	tests := []struct {
+		name        string
+		retainKinds []string
+		want        map[string]bool
+	}{
+		{
+			name:        "delete",
+			retainKinds: deleteRetainKinds(&av1.DeletePhase{}),
+			want:        databaseItems,
+		},
+		{
+			name:        "delete purging the database",
+			retainKinds: deleteRetainKinds(&av1.DeletePhase{Spec: av1.DeletePhaseSpec{PurgeDB: "true"}}),
+			want:        map[string]bool{},
+		},
+		{
+			name:        "rollback",
+			retainKinds: rollbackRetainKinds(&av1.RollbackPhase{}),
+			want:        databaseItems,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retained(items, tt.retainKinds)
+			if len(got) != len(tt.want) {
+				t.Errorf("retained %v, want %v", got, tt.want)
+			}
+			for name := range tt.want {
+				if !got[name] {
+					t.Errorf("%s is not retained", name)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabaseRetentionAnnotation(t *testing.T) {
+	phase := &av1.DeletePhase{}
+	phase.SetAnnotations(map[string]string{lcmif.RetainKindsAnnotation: "ConfigMap"})
+	phase.Spec.PurgeDB = "true"
+
+	items := []*unstructured.Unstructured{
+		newSubResource("v1", "PersistentVolumeClaim", "mariadb-data", nil),
+		newSubResource("v1", "ConfigMap", "keystone-bin", nil),
+	}
+	got := retained(items, deleteRetainKinds(phase))
+	if len(got) != 1 || !got["keystone-bin"] {
+		t.Errorf("retained %v, want only keystone-bin", got)
+	}
+}
@@ -44,6 +44,15 @@ func (o installrenderer) RenderChart(name string, namespace string, chartLocatio
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the InstallPhase spec on top of the initial renderValues
+func (o installrenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseInstall, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this InstallPhase CR
 func (m *installmanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
@@ -19,13 +19,17 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"github.com/keleustes/oslc-operator/pkg/k8sutil"
 	lcmif "github.com/keleustes/oslc-operator/pkg/services"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
 )
 
 type managerFactory struct {
 	kubeClient client.Client
+	discovery  discovery.DiscoveryInterface
+	sorter     lcmif.KindSorter
 }
 
 // Simple function to init the renderFiles passed to the helm renderer
@@ -35,18 +39,21 @@ func initRenderFiles(stage av1.OslcPhase) []string {
 }
 
 // Simple function to init the renderValues passed to the helm renderer
-func initRenderValues(stage av1.OslcPhase) map[string]interface{} {
+func initRenderValues(stage av1.OslcPhase, slice *lcmif.Slice) map[string]interface{} {
 	oslcValues := map[string]interface{}{}
 	oslcValues["stage"] = stage.String()
+	if slice != nil {
+		oslcValues["slice"] = slice.Values()
+	}
 	renderValues := map[string]interface{}{}
 	renderValues["oslc"] = oslcValues
 	renderValues["lifecycle"] = stage.String()
 	return renderValues
 }
 
-// NewManagerFactory returns a new factory.
-func NewManagerFactory(mgr manager.Manager) lcmif.PhaseManagerFactory {
-	return &managerFactory{kubeClient: mgr.GetClient()}
+// NewManagerFactory returns a new factory. The managers sort the sub resources with sorter.
+func NewManagerFactory(mgr manager.Manager, sorter lcmif.KindSorter) lcmif.PhaseManagerFactory {
+	return &managerFactory{kubeClient: mgr.GetClient(), discovery: k8sutil.NewDiscoveryClient(mgr.GetConfig()), sorter: sorter}
 }
 
 // NewPlanningPhaseManager returns a new manager capable of controlling PlanningPhase phase of the service lifecyle
@@ -57,11 +64,13 @@ func (f managerFactory) NewPlanningPhaseManager(r *av1.PlanningPhase) lcmif.Plan
 	}
 
 	renderFiles := initRenderFiles(av1.PhasePlanning)
-	renderValues := initRenderValues(av1.PhasePlanning)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhasePlanning, slice)
 	renderer := &planningrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osplan", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osplan", renderFiles, values)
 
 	return &planningmanager{
 		phasemanager: phasemanager{
@@ -69,8 +78,16 @@ func (f managerFactory) NewPlanningPhaseManager(r *av1.PlanningPhase) lcmif.Plan
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    lcmif.GetRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -86,11 +103,13 @@ func (f managerFactory) NewInstallPhaseManager(r *av1.InstallPhase) lcmif.Instal
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseInstall)
-	renderValues := initRenderValues(av1.PhaseInstall)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseInstall, slice)
 	renderer := &installrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osins", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osins", renderFiles, values)
 
 	return &installmanager{
 		phasemanager: phasemanager{
@@ -98,8 +117,16 @@ func (f managerFactory) NewInstallPhaseManager(r *av1.InstallPhase) lcmif.Instal
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    lcmif.GetRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -115,11 +142,13 @@ func (f managerFactory) NewTestPhaseManager(r *av1.TestPhase) lcmif.TestPhaseMan
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseTest)
-	renderValues := initRenderValues(av1.PhaseTest)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseTest, slice)
 	renderer := &testrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "ostest", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "ostest", renderFiles, values)
 
 	return &testmanager{
 		phasemanager: phasemanager{
@@ -127,8 +156,16 @@ func (f managerFactory) NewTestPhaseManager(r *av1.TestPhase) lcmif.TestPhaseMan
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    lcmif.GetRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -144,11 +181,13 @@ func (f managerFactory) NewTrafficRolloutPhaseManager(r *av1.TrafficRolloutPhase
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseTrafficRollout)
-	renderValues := initRenderValues(av1.PhaseTrafficRollout)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseTrafficRollout, slice)
 	renderer := &trafficrolloutrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osroll", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osroll", renderFiles, values)
 
 	return &trafficrolloutmanager{
 		phasemanager: phasemanager{
@@ -156,8 +195,16 @@ func (f managerFactory) NewTrafficRolloutPhaseManager(r *av1.TrafficRolloutPhase
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    lcmif.GetRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -173,11 +220,13 @@ func (f managerFactory) NewOperationalPhaseManager(r *av1.OperationalPhase) lcmi
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseOperational)
-	renderValues := initRenderValues(av1.PhaseOperational)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseOperational, slice)
 	renderer := &operationalrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osops", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osops", renderFiles, values)
 
 	return &operationalmanager{
 		phasemanager: phasemanager{
@@ -185,8 +234,16 @@ func (f managerFactory) NewOperationalPhaseManager(r *av1.OperationalPhase) lcmi
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    lcmif.GetRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -202,11 +259,13 @@ func (f managerFactory) NewTrafficDrainPhaseManager(r *av1.TrafficDrainPhase) lc
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseTrafficDrain)
-	renderValues := initRenderValues(av1.PhaseTrafficDrain)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseTrafficDrain, slice)
 	renderer := &trafficdrainrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osdrain", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osdrain", renderFiles, values)
 
 	return &trafficdrainmanager{
 		phasemanager: phasemanager{
@@ -214,8 +273,16 @@ func (f managerFactory) NewTrafficDrainPhaseManager(r *av1.TrafficDrainPhase) lc
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    lcmif.GetRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -231,11 +298,13 @@ func (f managerFactory) NewUpgradePhaseManager(r *av1.UpgradePhase) lcmif.Upgrad
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseUpgrade)
-	renderValues := initRenderValues(av1.PhaseUpgrade)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseUpgrade, slice)
 	renderer := &upgraderenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osupg", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osupg", renderFiles, values)
 
 	return &upgrademanager{
 		phasemanager: phasemanager{
@@ -243,8 +312,16 @@ func (f managerFactory) NewUpgradePhaseManager(r *av1.UpgradePhase) lcmif.Upgrad
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    lcmif.GetRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -260,11 +337,13 @@ func (f managerFactory) NewRollbackPhaseManager(r *av1.RollbackPhase) lcmif.Roll
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseRollback)
-	renderValues := initRenderValues(av1.PhaseRollback)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseRollback, slice)
 	renderer := &rollbackrenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osrbck", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osrbck", renderFiles, values)
 
 	return &rollbackmanager{
 		phasemanager: phasemanager{
@@ -272,8 +351,16 @@ func (f managerFactory) NewRollbackPhaseManager(r *av1.RollbackPhase) lcmif.Roll
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    rollbackRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -289,11 +376,13 @@ func (f managerFactory) NewDeletePhaseManager(r *av1.DeletePhase) lcmif.DeletePh
 	}
 
 	renderFiles := initRenderFiles(av1.PhaseDelete)
-	renderValues := initRenderValues(av1.PhaseDelete)
+	slice := lcmif.GetSlice(r)
+	renderValues := initRenderValues(av1.PhaseDelete, slice)
 	renderer := &deleterenderer{
-		helmrenderer: NewOwnerRefHelmRenderer(ownerRefs, "osdlt", renderFiles, renderValues),
-		spec:         r.Spec,
+		spec: r.Spec,
 	}
+	values, renderErr := renderer.renderValues(renderValues)
+	renderer.helmrenderer = NewOwnerRefHelmRenderer(f.discovery, ownerRefs, "osdlt", renderFiles, values)
 
 	return &deletemanager{
 		phasemanager: phasemanager{
@@ -301,8 +390,16 @@ func (f managerFactory) NewDeletePhaseManager(r *av1.DeletePhase) lcmif.DeletePh
 			renderer:       renderer,
 			source:         r.Spec.Source,
 			serviceName:    r.Spec.OpenstackServiceName,
+			phase:          r,
 			phaseRefs:      ownerRefs,
 			phaseName:      r.GetName(),
+			adoptionPolicy: lcmif.GetAdoptionPolicy(r),
+			dryRun:         lcmif.IsDryRun(r),
+			revision:       lcmif.NewRevisionSnapshot(r, r.Spec, values),
+			retainKinds:    deleteRetainKinds(r),
+			sorter:         f.sorter,
+			slice:          slice,
+			renderErr:      renderErr,
 			phaseNamespace: r.GetNamespace()},
 
 		spec:   r.Spec,
@@ -44,6 +44,15 @@ func (o operationalrenderer) RenderChart(name string, namespace string, chartLoc
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the OperationalPhase spec on top of the initial renderValues
+func (o operationalrenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseOperational, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this OperationalPhase CR
 func (m *operationalmanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
@@ -16,6 +16,7 @@ package osphases
 
 import (
 	"context"
+	"errors"
 
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
 	lcmif "github.com/keleustes/oslc-operator/pkg/services"
@@ -32,14 +33,25 @@ type phasemanager struct {
 	kubeClient     client.Client
 	renderer       lcmif.OwnerRefHelmRenderer
 	serviceName    string
+	phase          client.Object
 	phaseRefs      []metav1.OwnerReference
 	phaseName      string
 	phaseNamespace string
 	source         *av1.PhaseSource
+	adoptionPolicy lcmif.AdoptionPolicy
+	retainKinds    []string
+	sorter         lcmif.KindSorter
+	dryRun         bool
+	revision       lcmif.RevisionSnapshot
+	slice          *lcmif.Slice
+	renderErr      error
 
 	isInstalled             bool
 	isUpdateRequired        bool
 	deployedSubResourceList *av1.SubResourceList
+	driftedSubResources     []lcmif.SubResourceDrift
+	inventory               *lcmif.Inventory
+	adoptedSubResources     []unstructured.Unstructured
 }
 
 // ResourceName returns the name of the release.
@@ -55,13 +67,40 @@ func (m phasemanager) IsUpdateRequired() bool {
 	return m.isUpdateRequired
 }
 
+// AdoptedResources returns the existing sub resources adopted during the last SyncResource
+func (m phasemanager) AdoptedResources() []unstructured.Unstructured {
+	return m.adoptedSubResources
+}
+
+// RecordRevision records a ControllerRevision of the spec and render values of the Phase
+// if they changed since the latest revision
+func (m phasemanager) RecordRevision(ctx context.Context) (*lcmif.RevisionHistory, error) {
+	return lcmif.RecordRevision(ctx, m.kubeClient, m.phase, m.revision, nil)
+}
+
 // Render a chart or just a file
 func (m phasemanager) render(ctx context.Context) (*av1.SubResourceList, error) {
+	var rendered *av1.SubResourceList
+	var err error
+	if m.renderErr != nil {
+		return av1.NewSubResourceList(m.phaseNamespace, m.phaseName), lcmif.NewTypedError(lcmif.ErrorTypeRender, m.renderErr)
+	}
+
 	if m.source.Type == "tar" {
-		return m.renderer.RenderChart(m.phaseName, m.phaseNamespace, m.source.Location)
+		rendered, err = m.renderer.RenderChart(m.phaseName, m.phaseNamespace, m.source.Location)
 	} else {
-		return m.renderer.RenderFile(m.phaseName, m.phaseNamespace, m.source.Location)
+		rendered, err = m.renderer.RenderFile(m.phaseName, m.phaseNamespace, m.source.Location)
 	}
+	if err != nil {
+		return rendered, lcmif.NewTypedError(lcmif.ErrorTypeRender, err)
+	}
+
+	for i := range rendered.Items {
+		m.slice.Apply(&rendered.Items[i])
+	}
+
+	err = lcmif.TrackOwnership(m.kubeClient.RESTMapper(), rendered.Items, m.phaseRefs, m.phaseNamespace)
+	return rendered, lcmif.ClassifyError(err)
 }
 
 // Try to compare the resource in the CRD and the resources in Kubernetes
@@ -69,71 +108,124 @@ func (m *phasemanager) syncResource(ctx context.Context) error {
 
 	m.deployedSubResourceList = av1.NewSubResourceList(m.phaseNamespace, m.phaseName)
 
+	inventory, err := lcmif.LoadInventory(ctx, m.kubeClient, m.phaseNamespace, m.phaseRefs)
+	m.inventory = inventory
+	if err != nil {
+		return err
+	}
+
 	rendered, deployed, err := m.sync(ctx)
 	if err != nil {
 		return err
 	}
 
 	m.deployedSubResourceList = deployed
-	if len(rendered.Items) != len(deployed.Items) {
+	m.driftedSubResources = nil
+	if len(deployed.Items) == 0 && len(rendered.Items) != 0 {
 		m.isInstalled = false
 		m.isUpdateRequired = false
 	} else {
 		m.isInstalled = true
-		m.isUpdateRequired = false
+		m.driftedSubResources = lcmif.DetectDrifts(rendered.Items, deployed.Items)
+		m.driftedSubResources = append(m.driftedSubResources, lcmif.OrphanDrifts(lcmif.FindOrphans(rendered.Items, deployed.Items))...)
+		m.isUpdateRequired = len(m.driftedSubResources) != 0
+		for _, drift := range m.driftedSubResources {
+			log.Info("Drift detected", "phase", m.phaseName, "kind", drift.Kind, "name", drift.Name, "reason", drift.Reason)
+		}
 	}
 
 	return nil
 }
 
-// Attempts to compare the K8s object present with the rendered objects
-func (m phasemanager) sync(ctx context.Context) (*av1.SubResourceList, *av1.SubResourceList, error) {
+// Attempts to compare the K8s object present with the rendered objects.
+// The objects are looked up from the inventory and from the current rendering.
+// The objects which are not owned by the Phase yet are adopted according to
+// the adoption policy.
+func (m *phasemanager) sync(ctx context.Context) (*av1.SubResourceList, *av1.SubResourceList, error) {
 	alreadyDeployed := av1.NewSubResourceList(m.phaseNamespace, m.phaseName)
+	referenced := av1.NewSubResourceList(m.phaseNamespace, m.phaseName)
+	m.adoptedSubResources = make([]unstructured.Unstructured, 0)
 
 	rendered, err := m.render(ctx)
 	if err != nil {
 		return nil, alreadyDeployed, err
 	}
 
-	errs := make([]error, 0)
+	candidates := m.inventory.Objects()
 	for _, renderedResource := range rendered.Items {
+		if lcmif.FindResource(candidates, &renderedResource) == nil {
+			candidates = append(candidates, renderedResource)
+		}
+	}
+
+	errs := make([]error, 0)
+	for _, candidate := range candidates {
 		// TODO(jeb): Don't undestand why need to code such a klduge
 		existingResource := unstructured.Unstructured{}
-		existingResource.SetAPIVersion(renderedResource.GetAPIVersion())
-		existingResource.SetKind(renderedResource.GetKind())
-		existingResource.SetName(renderedResource.GetName())
-		existingResource.SetNamespace(renderedResource.GetNamespace())
+		existingResource.SetAPIVersion(candidate.GetAPIVersion())
+		existingResource.SetKind(candidate.GetKind())
+		existingResource.SetName(candidate.GetName())
+		existingResource.SetNamespace(candidate.GetNamespace())
 
 		err := m.kubeClient.Get(context.TODO(), types.NamespacedName{Name: existingResource.GetName(), Namespace: existingResource.GetNamespace()}, &existingResource)
 		if err != nil {
 			if !apierrors.IsNotFound(err) {
 				// Don't want to trace is the error is not a NotFound.
 				log.Error(err, "Can't not retrieve Resource")
-				errs = append(errs, err)
+				errs = append(errs, lcmif.NewResourceError(lcmif.OperationGet, &candidate, err))
 			}
+			continue
+		}
+
+		// Nothing is persisted in dry run mode, the plan shows the adoption as an update
+		var adopted bool
+		if m.dryRun {
+			_, err = lcmif.CheckAdoption(&existingResource, m.phaseRefs, m.adoptionPolicy)
 		} else {
-			alreadyDeployed.Items = append(alreadyDeployed.Items, existingResource)
+			adopted, err = lcmif.Adopt(ctx, m.kubeClient, &existingResource, lcmif.FindResource(rendered.Items, &existingResource),
+				m.phaseRefs, m.adoptionPolicy)
+		}
+		if err != nil {
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationAdopt, &existingResource, err))
+			continue
+		}
+		if adopted {
+			m.adoptedSubResources = append(m.adoptedSubResources, existingResource)
+			m.inventory.MarkAdopted(&existingResource)
+		}
+		alreadyDeployed.Items = append(alreadyDeployed.Items, existingResource)
+		if !lcmif.IsTracked(&existingResource) {
+			referenced.Items = append(referenced.Items, existingResource)
+		}
+	}
+
+	if len(m.adoptedSubResources) != 0 {
+		if err := m.inventory.Save(ctx, m.kubeClient); err != nil {
+			return rendered, nil, err
 		}
 	}
 
-	if !alreadyDeployed.CheckOwnerReference(m.phaseRefs) {
+	if len(errs) != 0 {
+		return rendered, nil, lcmif.NewMultiError(errs)
+	}
+
+	// The sub resources tracked by labels do not carry owner references
+	if !referenced.CheckOwnerReference(m.phaseRefs) {
 		return rendered, nil, lcmif.OwnershipMismatch
 	}
 
-	// TODO(jeb): not sure this is right
-	// if len(errs) != 0 {
-	//	return rendered, alreadyDeployed, errs[0]
-	// }
 	return rendered, alreadyDeployed, nil
 }
 
-// InstallResource creates K8s sub resources (Workflow, Job, ....) attached to this Phase CR
+// InstallResource creates K8s sub resources (Workflow, Job, ....) attached to this Phase CR.
+// The sub resources are created wave by wave. The waves which are not reached yet are
+// created by the next updates.
 func (m phasemanager) installResource(ctx context.Context) (*av1.SubResourceList, error) {
 
 	errs := make([]error, 0)
 	created := av1.NewSubResourceList(m.phaseNamespace, m.phaseName)
 
-	if m.deployedSubResourceList == nil {
+	if m.deployedSubResourceList == nil || m.inventory == nil {
 		// There was an error during SyncResource
 		return created, lcmif.InstallError
 	}
@@ -143,43 +235,148 @@ func (m phasemanager) installResource(ctx context.Context) (*av1.SubResourceList
 		return created, err
 	}
 
-	rendered.Items = lcmif.SortByInstallOrder(rendered.Items)
-	for _, toCreate := range rendered.Items {
-		err := m.kubeClient.Create(context.TODO(), &toCreate)
-		if err != nil {
-			if !apierrors.IsAlreadyExists(err) {
+	_, err = lcmif.ApplySyncWaves(context.TODO(), m.kubeClient, m.inventory, rendered.Items, m.sorter,
+		func(toCreate *unstructured.Unstructured) (bool, error) {
+			isNew, err := lcmif.CreateResource(context.TODO(), m.kubeClient, m.inventory, toCreate, m.phaseRefs, m.adoptionPolicy)
+			if err != nil {
 				log.Error(err, "Can't not Create Resource", "kind", toCreate.GetKind(), "name", toCreate.GetName())
-				errs = append(errs, err)
-			} else {
-				// Should consider as just created by us ?
-				// created.Items = append(created.Items, toCreate)
+				return false, lcmif.NewResourceError(lcmif.OperationCreate, toCreate, err)
+			}
+			if !isNew {
+				return false, nil
 			}
-		} else {
 			log.Info("Created Resource", "kind", toCreate.GetKind(), "name", toCreate.GetName())
-			created.Items = append(created.Items, toCreate)
-		}
+			created.Items = append(created.Items, *toCreate)
+			return true, nil
+		})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := m.inventory.Save(context.TODO(), m.kubeClient); err != nil {
+		log.Error(err, "Can't not save inventory")
+		errs = append(errs, err)
 	}
 
 	if len(errs) != 0 {
-		return created, errs[0]
+		return created, lcmif.NewMultiError(errs)
 	}
 	return created, nil
 }
 
-// InstallResource updates K8s sub resources (Workflow, Job, ....) attached to this Phase CR
+// UpdateResource updates K8s sub resources (Workflow, Job, ....) attached to this Phase CR.
+// The objects which changed or were newly rendered are applied using server-side apply,
+// wave by wave. Once all the waves are healthy, the objects of the inventory which are not
+// rendered anymore are deleted. The previous
+// list contains the old version of the modified and deleted objects, the updated list
+// the new version of the modified and created objects.
 func (m phasemanager) updateResource(ctx context.Context) (*av1.SubResourceList, *av1.SubResourceList, error) {
 
+	errs := make([]error, 0)
+	previous := av1.NewSubResourceList(m.phaseNamespace, m.phaseName)
 	updated := av1.NewSubResourceList(m.phaseNamespace, m.phaseName)
 
-	if m.deployedSubResourceList == nil {
+	if m.deployedSubResourceList == nil || m.inventory == nil {
 		// There was an error during SyncResource
-		return m.deployedSubResourceList, updated, lcmif.UpdateError
+		return previous, updated, lcmif.UpdateError
 	}
 
-	// TODO(JEB): Big hack. ReconcileResource should do more
-	m.deployedSubResourceList.DeepCopyInto(updated)
+	rendered, err := m.render(ctx)
+	if err != nil {
+		return previous, updated, err
+	}
+
+	completed, err := lcmif.ApplySyncWaves(context.TODO(), m.kubeClient, m.inventory, rendered.Items, m.sorter,
+		func(toApply *unstructured.Unstructured) (bool, error) {
+			existing := lcmif.FindResource(m.deployedSubResourceList.Items, toApply)
+			if existing != nil && lcmif.DetectDrift(toApply, existing) == nil {
+				// Unchanged
+				m.inventory.Add(existing)
+				return false, nil
+			}
+
+			applied, err := lcmif.ApplyOrReplace(context.TODO(), m.kubeClient, toApply, existing)
+			if errors.Is(err, lcmif.ErrReplacePending) {
+				// The sync wave waits for the deletion of the replaced version
+				m.inventory.Add(existing)
+				return false, err
+			}
+			if err != nil {
+				log.Error(err, "Can't not Apply Resource", "kind", toApply.GetKind(), "name", toApply.GetName())
+				return false, lcmif.NewResourceError(lcmif.OperationApply, toApply, err)
+			}
+			if !applied {
+				// The change of immutable fields is ignored
+				m.inventory.Add(existing)
+				return false, nil
+			}
+
+			if existing != nil {
+				log.Info("Updated Resource", "kind", toApply.GetKind(), "name", toApply.GetName())
+				previous.Items = append(previous.Items, *existing)
+			} else {
+				log.Info("Created Resource", "kind", toApply.GetKind(), "name", toApply.GetName())
+			}
+			updated.Items = append(updated.Items, *toApply)
+			m.inventory.Add(toApply)
+			return true, nil
+		})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// The objects which are not rendered anymore are pruned once all the waves are healthy
+	orphans := make([]unstructured.Unstructured, 0)
+	if completed {
+		orphans = m.sorter.SortByUninstallOrder(lcmif.FindOrphans(rendered.Items, m.deployedSubResourceList.Items))
+	}
+	for _, toDelete := range orphans {
+		retained, err := lcmif.RetainIfRequired(context.TODO(), m.kubeClient, &toDelete, m.phaseRefs, m.retainKinds)
+		if err != nil {
+			log.Error(err, "Can't not retain Resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationRetain, &toDelete, err))
+			continue
+		}
+		if retained {
+			m.inventory.Remove(&toDelete)
+			continue
+		}
+		err = m.kubeClient.Delete(context.TODO(), &toDelete)
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Error(err, "Can't not prune Resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationPrune, &toDelete, err))
+			continue
+		}
+		log.Info("Pruned Resource", "kind", toDelete.GetKind(), "name", toDelete.GetName())
+		previous.Items = append(previous.Items, toDelete)
+		m.inventory.Remove(&toDelete)
+	}
+
+	if err := m.inventory.Save(context.TODO(), m.kubeClient); err != nil {
+		log.Error(err, "Can't not save inventory")
+		errs = append(errs, err)
+	}
 
-	return m.deployedSubResourceList, updated, nil
+	if len(errs) != 0 {
+		return previous, updated, lcmif.NewMultiError(errs)
+	}
+	return previous, updated, nil
+}
+
+// PlanResource computes the actions the install or update of the sub resources attached
+// to this Phase CR would perform, using server-side dry run. Nothing is persisted.
+func (m phasemanager) PlanResource(ctx context.Context) ([]lcmif.PlanAction, error) {
+	if m.deployedSubResourceList == nil || m.inventory == nil {
+		// There was an error during SyncResource
+		return nil, lcmif.SyncError
+	}
+
+	rendered, err := m.render(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return lcmif.PlanResources(ctx, m.kubeClient, rendered.Items, m.deployedSubResourceList.Items, m.retainKinds, m.sorter)
 }
 
 // ReconcileResource creates or patches resources as necessary to match this Phase CR
@@ -198,30 +395,63 @@ func (m phasemanager) reconcileResource(ctx context.Context) (*av1.SubResourceLi
 	return reconciled, nil
 }
 
-// UninstallResource delete K8s sub resources (Workflow, Job, ....) attached to this Phase CR
+// UninstallResource delete K8s sub resources (Workflow, Job, ....) attached to this Phase CR.
+// The objects to delete are taken from the inventory, hence the objects which are not
+// rendered anymore are deleted as well.
 func (m phasemanager) uninstallResource(ctx context.Context) (*av1.SubResourceList, error) {
 	errs := make([]error, 0)
 	notdeleted := av1.NewSubResourceList(m.phaseNamespace, m.phaseName)
 
-	if m.deployedSubResourceList == nil {
+	if m.deployedSubResourceList == nil || m.inventory == nil {
 		// There was an error during SyncResource
 		return notdeleted, lcmif.UninstallError
 	}
 
-	m.deployedSubResourceList.Items = lcmif.SortByUninstallOrder(m.deployedSubResourceList.Items)
-	for _, toDelete := range m.deployedSubResourceList.Items {
-		err := m.kubeClient.Delete(context.TODO(), &toDelete)
+	toDeleteList := m.deployedSubResourceList.Items
+	if m.inventory.Exists() {
+		toDeleteList = m.inventory.Objects()
+	}
+
+	toDeleteList = m.sorter.SortByUninstallOrder(toDeleteList)
+	for _, toDelete := range toDeleteList {
+		retained, err := lcmif.RetainIfRequired(context.TODO(), m.kubeClient, &toDelete, m.phaseRefs, m.retainKinds)
 		if err != nil {
-			if !apierrors.IsNotFound(err) {
+			log.Error(err, "Can't not retain Resource")
+			errs = append(errs, lcmif.NewResourceError(lcmif.OperationRetain, &toDelete, err))
+			notdeleted.Items = append(notdeleted.Items, toDelete)
+			continue
+		}
+		if retained {
+			m.inventory.Remove(&toDelete)
+			continue
+		}
+
+		opts := []client.DeleteOption{}
+		if uid := toDelete.GetUID(); uid != "" {
+			opts = append(opts, client.Preconditions{UID: &uid})
+		}
+		err = m.kubeClient.Delete(context.TODO(), &toDelete, opts...)
+		if err != nil {
+			if !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
 				log.Error(err, "Can't not delete Resource")
-				errs = append(errs, err)
+				errs = append(errs, lcmif.NewResourceError(lcmif.OperationDelete, &toDelete, err))
 				notdeleted.Items = append(notdeleted.Items, toDelete)
+				continue
 			}
 		}
+		m.inventory.Remove(&toDelete)
 	}
 
 	if len(errs) != 0 {
-		return notdeleted, errs[0]
+		if err := m.inventory.Save(context.TODO(), m.kubeClient); err != nil {
+			log.Error(err, "Can't not save inventory")
+		}
+		return notdeleted, lcmif.NewMultiError(errs)
+	}
+
+	if err := m.inventory.Delete(context.TODO(), m.kubeClient); err != nil {
+		log.Error(err, "Can't not delete inventory")
+		return notdeleted, err
 	}
 	return notdeleted, nil
 }
@@ -0,0 +1,111 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osphases
+
+import (
+	"context"
+	"testing"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	lcmif "github.com/keleustes/oslc-operator/pkg/services"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUninstallTrackedResources(t *testing.T) {
+	ctx := context.TODO()
+	controller := true
+	owner := metav1.OwnerReference{
+		APIVersion: "openstacklcm.airshipit.org/v1alpha1",
+		Kind:       "DeletePhase",
+		Name:       "keystone",
+		UID:        "uid-keystone",
+		Controller: &controller,
+	}
+	owners := []metav1.OwnerReference{owner}
+
+	// The ClusterRole can not carry an owner reference and is tracked by labels
+	clusterRole := newSubResource("rbac.authorization.k8s.io/v1", "ClusterRole", "keystone", map[string]string{
+		lcmif.OwnerUIDLabel:  string(owner.UID),
+		lcmif.OwnerKindLabel: owner.Kind,
+	})
+	clusterRole.SetNamespace("")
+	clusterRole.SetAnnotations(map[string]string{
+		lcmif.OwnerNameAnnotation:      owner.Name,
+		lcmif.OwnerNamespaceAnnotation: "openstack",
+	})
+	configMap := newSubResource("v1", "ConfigMap", "keystone-etc", nil)
+	configMap.SetOwnerReferences(owners)
+	volume := newSubResource("v1", "PersistentVolumeClaim", "mariadb-data", nil)
+	volume.SetOwnerReferences(owners)
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).
+		WithObjects(clusterRole.DeepCopy(), configMap.DeepCopy(), volume.DeepCopy()).Build()
+
+	inventory := lcmif.NewInventory("openstack", owners)
+	for _, u := range []*unstructured.Unstructured{clusterRole, configMap, volume} {
+		inventory.Add(u)
+	}
+	if err := inventory.Save(ctx, c); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	m := phasemanager{
+		kubeClient:              c,
+		phaseRefs:               owners,
+		phaseName:               owner.Name,
+		phaseNamespace:          "openstack",
+		retainKinds:             deleteRetainKinds(&av1.DeletePhase{}),
+		sorter:                  lcmif.DefaultKindSorter,
+		deployedSubResourceList: av1.NewSubResourceList("openstack", owner.Name),
+		inventory:               inventory,
+	}
+	notdeleted, err := m.uninstallResource(ctx)
+	if err != nil {
+		t.Fatalf("uninstallResource() error = %v", err)
+	}
+	if len(notdeleted.Items) != 0 {
+		t.Errorf("uninstallResource() did not delete %v", notdeleted.Items)
+	}
+
+	for _, u := range []*unstructured.Unstructured{clusterRole, configMap} {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(u), u.DeepCopy()); !apierrors.IsNotFound(err) {
+			t.Errorf("%s %s still exists: %v", u.GetKind(), u.GetName(), err)
+		}
+	}
+
+	// The retained PersistentVolumeClaim is released
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(volume.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKeyFromObject(volume), live); err != nil {
+		t.Fatalf("retained %s has been deleted: %v", volume.GetName(), err)
+	}
+	if len(live.GetOwnerReferences()) != 0 {
+		t.Errorf("retained %s still has owner references %v", volume.GetName(), live.GetOwnerReferences())
+	}
+
+	inventoryKey := types.NamespacedName{Namespace: "openstack", Name: lcmif.InventoryName(owner)}
+	if err := c.Get(ctx, inventoryKey, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "ConfigMap"}}); !apierrors.IsNotFound(err) {
+		t.Errorf("inventory still exists: %v", err)
+	}
+}
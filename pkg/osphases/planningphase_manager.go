@@ -44,6 +44,15 @@ func (o planningrenderer) RenderChart(name string, namespace string, chartLocati
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the PlanningPhase spec on top of the initial renderValues
+func (o planningrenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhasePlanning, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this PlanningPhase CR
 func (m *planningmanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
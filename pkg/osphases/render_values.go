@@ -0,0 +1,87 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osphases
+
+import (
+	"fmt"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// phaseValuesKey is the top level key under which the phase spec is
+	// exposed to the templates (.Values.phase)
+	phaseValuesKey = "phase"
+
+	// phaseConfigKey is the spec field containing extra values which are
+	// merged at the top level of the values.
+	phaseConfigKey = "config"
+)
+
+// phaseRenderValues builds the .Values.phase tree out of a phase spec.
+// The tree mirrors the content of the CR spec (same field names as in the
+// yaml of the CR) and adds the kind of the phase:
+//
+//	phase:
+//	  kind: install
+//	  openstackServiceName: keystone
+//	  targetOpenstackServiceVersion: ...
+//	  initDB: "true"
+//	  ...
+//
+// The content of spec.config, when present, is also merged at the top level
+// of the values so that it can override the values.yaml of the chart.
+func phaseRenderValues(stage av1.OslcPhase, spec interface{}) (map[string]interface{}, error) {
+	phaseValues := map[string]interface{}{}
+
+	specValues, err := runtime.DefaultUnstructuredConverter.ToUnstructured(spec)
+	if err != nil {
+		return nil, fmt.Errorf("can not convert the %s phase spec to render values: %s", stage.String(), err)
+	}
+	for k, v := range specValues {
+		phaseValues[k] = v
+	}
+	phaseValues["kind"] = stage.String()
+
+	renderValues := map[string]interface{}{}
+	if config, ok := phaseValues[phaseConfigKey].(map[string]interface{}); ok {
+		renderValues = mergeRenderValues(renderValues, config)
+	}
+	renderValues[phaseValuesKey] = phaseValues
+	return renderValues, nil
+}
+
+// mergeRenderValues returns a new map containing base with override merged
+// on top of it. Nested maps are merged recursively, other values of override
+// replace the ones of base.
+func mergeRenderValues(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	for k, v := range override {
+		overrideMap, isOverrideMap := v.(map[string]interface{})
+		baseMap, isBaseMap := merged[k].(map[string]interface{})
+		if isOverrideMap && isBaseMap {
+			merged[k] = mergeRenderValues(baseMap, overrideMap)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
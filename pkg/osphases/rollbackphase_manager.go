@@ -44,6 +44,22 @@ func (o rollbackrenderer) RenderChart(name string, namespace string, chartLocati
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the RollbackPhase spec on top of the initial renderValues
+func (o rollbackrenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseRollback, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
+// rollbackRetainKinds returns the kinds of sub resources the RollbackPhase retains.
+// The sub resources holding the data of the database, which the rollback may restore,
+// are always kept on top of the kinds listed in the RetainKindsAnnotation.
+func rollbackRetainKinds(r *av1.RollbackPhase) []string {
+	return append(lcmif.GetRetainKinds(r), databaseRetainKinds...)
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this RollbackPhase CR
 func (m *rollbackmanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
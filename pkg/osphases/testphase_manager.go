@@ -44,6 +44,15 @@ func (o testrenderer) RenderChart(name string, namespace string, chartLocation s
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the TestPhase spec on top of the initial renderValues
+func (o testrenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseTest, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this TestPhase CR
 func (m *testmanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
@@ -44,6 +44,15 @@ func (o trafficdrainrenderer) RenderChart(name string, namespace string, chartLo
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the TrafficDrainPhase spec on top of the initial renderValues
+func (o trafficdrainrenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseTrafficDrain, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this TrafficDrainPhase CR
 func (m *trafficdrainmanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
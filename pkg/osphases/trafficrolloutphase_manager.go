@@ -44,6 +44,15 @@ func (o trafficrolloutrenderer) RenderChart(name string, namespace string, chart
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the TrafficRolloutPhase spec on top of the initial renderValues
+func (o trafficrolloutrenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseTrafficRollout, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this TrafficRolloutPhase CR
 func (m *trafficrolloutmanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
@@ -44,6 +44,15 @@ func (o upgraderenderer) RenderChart(name string, namespace string, chartLocatio
 	return o.helmrenderer.RenderChart(name, namespace, chartLocation)
 }
 
+// renderValues merges the UpgradePhase spec on top of the initial renderValues
+func (o upgraderenderer) renderValues(initValues map[string]interface{}) (map[string]interface{}, error) {
+	phaseValues, err := phaseRenderValues(av1.PhaseUpgrade, &o.spec)
+	if err != nil {
+		return initValues, err
+	}
+	return mergeRenderValues(initValues, phaseValues), nil
+}
+
 // SyncResource retrieves from K8s the sub resources (Workflow, Job, ....) attached to this UpgradePhase CR
 func (m *upgrademanager) SyncResource(ctx context.Context) error {
 	return m.syncResource(ctx)
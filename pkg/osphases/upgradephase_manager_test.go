@@ -0,0 +1,151 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osphases
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	lcmif "github.com/keleustes/oslc-operator/pkg/services"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// stepsTemplates and stepsValues define the volumes and images of the steps the generic
+// phases take out of the openstack service charts
+const stepsTemplates = `
+{{- define "openstackservice.templates.steps._db_init.volumes" }}- name: db-init-sh
+  emptyDir: {}{{ end }}
+{{- define "openstackservice.templates.steps._db_sync.volumes" }}- name: db-sync-sh
+  emptyDir: {}{{ end }}
+{{- define "openstackservice.templates.steps._rabbit_init.volumes" }}- name: rabbit-init-sh
+  emptyDir: {}{{ end }}
+`
+
+const stepsValues = `
+images:
+  tags:
+    dep_check: quay.io/stackanetes/kubernetes-entrypoint:v0.3.1
+`
+
+// genericPhasesChart returns a copy of the genericphases chart limited to the template
+// of the phase, completed with the templates and values of the steps
+func genericPhasesChart(t *testing.T, template string) string {
+	source := filepath.Join("..", "..", "helm-charts", lcmif.GenericPhases.String())
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Chart.yaml", "values.yaml", filepath.Join("templates", template)} {
+		content, err := ioutil.ReadFile(filepath.Join(source, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "templates", "_steps.tpl"), []byte(stepsTemplates), 0644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := os.OpenFile(filepath.Join(dir, "values.yaml"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer values.Close()
+	if _, err := values.WriteString(stepsValues); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSlicePhaseRender(t *testing.T) {
+	chart := genericPhasesChart(t, "lifecycle-upgrade.yaml")
+
+	tests := []struct {
+		name         string
+		phaseName    string
+		annotations  map[string]string
+		nodeSelector map[string]interface{}
+		label        string
+	}{
+		{
+			name:      "whole service",
+			phaseName: "keystone-upgrade-upgrade-2",
+		},
+		{
+			name:         "zone",
+			phaseName:    "keystone-upgrade-az1-upgrade-2",
+			annotations:  map[string]string{lcmif.SliceZoneAnnotation: "az1"},
+			nodeSelector: map[string]interface{}{lcmif.ZoneLabel: "az1"},
+			label:        "az1",
+		},
+		{
+			name:      "named slice with node selector",
+			phaseName: "keystone-upgrade-blue-upgrade-2",
+			annotations: map[string]string{
+				lcmif.SliceAnnotation:             "blue",
+				lcmif.SliceNodeSelectorAnnotation: "rack=r1",
+				lcmif.SliceZoneAnnotation:         "az2",
+			},
+			nodeSelector: map[string]interface{}{"rack": "r1", lcmif.ZoneLabel: "az2"},
+			label:        "blue",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phase := &av1.UpgradePhase{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.phaseName, Namespace: "openstack", UID: "uid-upgrade", Annotations: tt.annotations},
+			}
+			phase.Spec.OpenstackServiceName = "keystone"
+			phase.Spec.Source = &av1.PhaseSource{Type: "tar", Location: chart}
+
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+			factory := managerFactory{kubeClient: c, sorter: lcmif.DefaultKindSorter}
+			m := factory.NewUpgradePhaseManager(phase).(*upgrademanager)
+
+			rendered, err := m.render(context.TODO())
+			if err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if len(rendered.Items) != 1 {
+				t.Fatalf("render() rendered %d sub resources, want 1", len(rendered.Items))
+			}
+
+			// The Workflow is named after the Phase, which carries the suffix of the slice
+			workflow := rendered.Items[0]
+			if workflow.GetKind() != "Workflow" || workflow.GetName() != tt.phaseName {
+				t.Errorf("render() rendered %s %s, want Workflow %s", workflow.GetKind(), workflow.GetName(), tt.phaseName)
+			}
+			if got := workflow.GetLabels()[lcmif.SliceLabel]; got != tt.label {
+				t.Errorf("Workflow %s = %q, want %q", lcmif.SliceLabel, got, tt.label)
+			}
+			nodeSelector, _, _ := unstructured.NestedMap(workflow.Object, "spec", "nodeSelector")
+			if !reflect.DeepEqual(nodeSelector, tt.nodeSelector) {
+				t.Errorf("Workflow nodeSelector = %v, want %v", nodeSelector, tt.nodeSelector)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AdoptionPolicy defines what the operator does with an already existing
+// sub resource which is not owned by the Oslc or Phase CR rendering it.
+type AdoptionPolicy string
+
+const (
+	// AdoptionPolicyFail leaves the sub resource untouched and the CR Irreconcilable
+	AdoptionPolicyFail AdoptionPolicy = "Fail"
+
+	// AdoptionPolicyAdoptIfUnowned adopts the sub resource if it has no controller
+	AdoptionPolicyAdoptIfUnowned AdoptionPolicy = "AdoptIfUnowned"
+
+	// AdoptionPolicyForceAdopt adopts the sub resource, replacing its controller if any
+	AdoptionPolicyForceAdopt AdoptionPolicy = "ForceAdopt"
+)
+
+// GetAdoptionPolicy returns the adoption policy of an Oslc or Phase CR. Defaults to Fail.
+func GetAdoptionPolicy(obj metav1.Object) AdoptionPolicy {
+	value, ok := obj.GetAnnotations()[AdoptionPolicyAnnotation]
+	if !ok {
+		return AdoptionPolicyFail
+	}
+
+	switch policy := AdoptionPolicy(value); policy {
+	case AdoptionPolicyFail, AdoptionPolicyAdoptIfUnowned, AdoptionPolicyForceAdopt:
+		return policy
+	default:
+		log.Info("Invalid adoption policy, using Fail", "name", obj.GetName(), "policy", value)
+		return AdoptionPolicyFail
+	}
+}
+
+// IsOwnedBy returns true if one of the owner references of the object, or its
+// OwnerUIDLabel, points to one of the owners.
+func IsOwnedBy(u *unstructured.Unstructured, owners []metav1.OwnerReference) bool {
+	if uid, ok := u.GetLabels()[OwnerUIDLabel]; ok {
+		for _, owner := range owners {
+			if uid == string(owner.UID) {
+				return true
+			}
+		}
+	}
+	for _, ref := range u.GetOwnerReferences() {
+		for _, owner := range owners {
+			if ref.UID == owner.UID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckAdoption returns true if an existing sub resource needs to be adopted by the
+// owners and an OwnershipMismatch error if the policy does not allow the adoption.
+func CheckAdoption(live *unstructured.Unstructured, owners []metav1.OwnerReference, policy AdoptionPolicy) (bool, error) {
+	if IsOwnedBy(live, owners) {
+		return false, nil
+	}
+
+	_, tracked := live.GetLabels()[OwnerUIDLabel]
+	unowned := metav1.GetControllerOf(live) == nil && !tracked
+	switch {
+	case policy == AdoptionPolicyAdoptIfUnowned && unowned:
+	case policy == AdoptionPolicyForceAdopt:
+	default:
+		return false, fmt.Errorf("%w: %s %s/%s is not owned by %s (adoption policy %s)",
+			OwnershipMismatch, live.GetKind(), live.GetNamespace(), live.GetName(), owners[0].Name, policy)
+	}
+	return true, nil
+}
+
+// Adopt makes the owners the owners of an existing sub resource, according to the
+// policy. The owner references and the labels of the rendered version are patched
+// onto the live object, and the tracking labels and annotations of a previous owner
+// are removed from it when the rendered version carries owner references. It returns true if the object has been adopted and an
+// OwnershipMismatch error if the policy does not allow the adoption.
+func Adopt(ctx context.Context, c client.Client, live *unstructured.Unstructured, rendered *unstructured.Unstructured,
+	owners []metav1.OwnerReference, policy AdoptionPolicy) (bool, error) {
+
+	if needed, err := CheckAdoption(live, owners, policy); !needed || err != nil {
+		return false, err
+	}
+
+	before := live.DeepCopy()
+
+	if rendered != nil && IsTracked(rendered) {
+		// The ownership is carried by the labels and annotations of the rendered version
+		annotations := live.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[OwnerNameAnnotation] = rendered.GetAnnotations()[OwnerNameAnnotation]
+		annotations[OwnerNamespaceAnnotation] = rendered.GetAnnotations()[OwnerNamespaceAnnotation]
+		live.SetAnnotations(annotations)
+	} else {
+		refs := make([]metav1.OwnerReference, 0)
+		for _, ref := range live.GetOwnerReferences() {
+			if ref.Controller != nil && *ref.Controller {
+				// Only one controller is allowed
+				continue
+			}
+			refs = append(refs, ref)
+		}
+		live.SetOwnerReferences(append(refs, owners...))
+
+		// The labels and annotations of a previous owner tracking the sub resource
+		// would still map it to that owner
+		Untrack(live)
+	}
+
+	labels := live.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	if rendered != nil {
+		for k, v := range rendered.GetLabels() {
+			labels[k] = v
+		}
+	}
+	labels[ManagedByLabel] = ManagedByValue
+	live.SetLabels(labels)
+
+	if err := c.Patch(ctx, live, client.MergeFromWithOptions(before, client.MergeFromWithOptimisticLock{})); err != nil {
+		return false, err
+	}
+
+	log.Info("Adopted sub resource", "kind", live.GetKind(), "namespace", live.GetNamespace(), "name", live.GetName(),
+		"owner", owners[0].Name, "policy", policy)
+	return true, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newOwnerRef returns the controller reference of an Oslc CR
+func newOwnerRef(name string, uid string) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: "openstacklcm.airshipit.org/v1alpha1",
+		Kind:       "Oslc",
+		Name:       name,
+		UID:        types.UID(uid),
+		Controller: &controller,
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	owner := newOwnerRef("keystone", "uid-keystone")
+	previous := newOwnerRef("glance", "uid-glance")
+
+	unowned := func() *unstructured.Unstructured {
+		return newObject("v1", "ConfigMap", "openstack", "config", nil)
+	}
+	ownerRefOwned := func() *unstructured.Unstructured {
+		u := unowned()
+		u.SetOwnerReferences([]metav1.OwnerReference{previous})
+		return u
+	}
+	labelTracked := func() *unstructured.Unstructured {
+		u := unowned()
+		u.SetLabels(map[string]string{OwnerUIDLabel: string(previous.UID), OwnerKindLabel: previous.Kind, "app": "glance"})
+		u.SetAnnotations(map[string]string{OwnerNameAnnotation: previous.Name, OwnerNamespaceAnnotation: "openstack"})
+		return u
+	}
+
+	tests := []struct {
+		name     string
+		live     func() *unstructured.Unstructured
+		policy   AdoptionPolicy
+		adopted  bool
+		mismatch bool
+	}{
+		{name: "fail unowned", live: unowned, policy: AdoptionPolicyFail, mismatch: true},
+		{name: "fail owner ref owned", live: ownerRefOwned, policy: AdoptionPolicyFail, mismatch: true},
+		{name: "fail label tracked", live: labelTracked, policy: AdoptionPolicyFail, mismatch: true},
+		{name: "adopt if unowned unowned", live: unowned, policy: AdoptionPolicyAdoptIfUnowned, adopted: true},
+		{name: "adopt if unowned owner ref owned", live: ownerRefOwned, policy: AdoptionPolicyAdoptIfUnowned, mismatch: true},
+		{name: "adopt if unowned label tracked", live: labelTracked, policy: AdoptionPolicyAdoptIfUnowned, mismatch: true},
+		{name: "force adopt unowned", live: unowned, policy: AdoptionPolicyForceAdopt, adopted: true},
+		{name: "force adopt owner ref owned", live: ownerRefOwned, policy: AdoptionPolicyForceAdopt, adopted: true},
+		{name: "force adopt label tracked", live: labelTracked, policy: AdoptionPolicyForceAdopt, adopted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(tt.live()).Build()
+
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(unowned().GroupVersionKind())
+			key := types.NamespacedName{Namespace: "openstack", Name: "config"}
+			if err := c.Get(ctx, key, live); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			rendered := unowned()
+			rendered.SetLabels(map[string]string{"app": "keystone"})
+			rendered.SetOwnerReferences([]metav1.OwnerReference{owner})
+
+			adopted, err := Adopt(ctx, c, live, rendered, []metav1.OwnerReference{owner}, tt.policy)
+			if tt.mismatch != errors.Is(err, OwnershipMismatch) {
+				t.Fatalf("Adopt() error = %v, want OwnershipMismatch %v", err, tt.mismatch)
+			}
+			if tt.mismatch {
+				return
+			}
+			if err != nil {
+				t.Fatalf("Adopt() error = %v", err)
+			}
+			if adopted != tt.adopted {
+				t.Errorf("Adopt() = %v, want %v", adopted, tt.adopted)
+			}
+
+			got := &unstructured.Unstructured{}
+			got.SetGroupVersionKind(live.GroupVersionKind())
+			if err := c.Get(ctx, key, got); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if !IsOwnedBy(got, []metav1.OwnerReference{owner}) {
+				t.Errorf("adopted object is not owned by %s", owner.Name)
+			}
+			if IsOwnedBy(got, []metav1.OwnerReference{previous}) {
+				t.Errorf("adopted object is still owned by %s: labels %v, owner references %v",
+					previous.Name, got.GetLabels(), got.GetOwnerReferences())
+			}
+			if controller := metav1.GetControllerOf(got); controller == nil || controller.UID != owner.UID {
+				t.Errorf("controller = %v, want %s", controller, owner.Name)
+			}
+			if IsTracked(got) {
+				t.Errorf("adopted object still carries the tracking labels %v", got.GetLabels())
+			}
+			if requests := OwnerRequest(got); len(requests) != 0 {
+				t.Errorf("adopted object is still mapped to %v", requests)
+			}
+			if got.GetLabels()["app"] != "keystone" || got.GetLabels()[ManagedByLabel] != ManagedByValue {
+				t.Errorf("labels = %v, want the rendered ones", got.GetLabels())
+			}
+		})
+	}
+}
+
+func TestAdoptOwned(t *testing.T) {
+	owner := newOwnerRef("keystone", "uid-keystone")
+	live := newObject("v1", "ConfigMap", "openstack", "config", nil)
+	live.SetOwnerReferences([]metav1.OwnerReference{owner})
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(live.DeepCopy()).Build()
+
+	for _, policy := range []AdoptionPolicy{AdoptionPolicyFail, AdoptionPolicyAdoptIfUnowned, AdoptionPolicyForceAdopt} {
+		adopted, err := Adopt(context.TODO(), c, live.DeepCopy(), live, []metav1.OwnerReference{owner}, policy)
+		if err != nil || adopted {
+			t.Errorf("Adopt() with policy %s = %v, %v, want false, nil", policy, adopted, err)
+		}
+	}
+}
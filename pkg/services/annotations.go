@@ -0,0 +1,135 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+// Annotations set or interpreted by the operator on the sub resources
+// and on the Oslc and Phase CRs.
+const (
+	// LastAppliedHashAnnotation contains the hash of the rendered version
+	// of a sub resource the last time the operator applied it.
+	LastAppliedHashAnnotation = "openstacklcm.airshipit.org/last-applied-hash"
+
+	// SyncWaveAnnotation contains the sync wave of a sub resource. The
+	// sub resources of a wave are applied only once the sub resources
+	// of the previous waves are healthy. Defaults to 0.
+	SyncWaveAnnotation = "openstacklcm.airshipit.org/sync-wave"
+
+	// SortAsAnnotation contains the kind a sub resource is ordered as
+	// in the install and uninstall orders, instead of its own kind.
+	SortAsAnnotation = "openstacklcm.airshipit.org/sort-as"
+
+	// AdoptionPolicyAnnotation contains the AdoptionPolicy of an Oslc or Phase CR
+	AdoptionPolicyAnnotation = "openstacklcm.airshipit.org/adoption-policy"
+
+	// ResourcePolicyAnnotation set to ResourcePolicyKeep prevents the deletion
+	// of a sub resource when it is pruned or uninstalled.
+	ResourcePolicyAnnotation = "openstacklcm.airshipit.org/resource-policy"
+
+	// RetainKindsAnnotation contains the comma separated list of kinds of sub
+	// resources an Oslc or Phase CR does not delete when uninstalled.
+	RetainKindsAnnotation = "openstacklcm.airshipit.org/retain-kinds"
+
+	// ReplacePolicyAnnotation contains the ReplacePolicy of a sub resource whose
+	// update is rejected because it modifies immutable fields.
+	ReplacePolicyAnnotation = "openstacklcm.airshipit.org/replace-policy"
+
+	// FlowEngineAnnotation contains the FlowEngine of an Oslc CR
+	FlowEngineAnnotation = "openstacklcm.airshipit.org/flow-engine"
+
+	// RollbackToAnnotation contains the revision an Oslc CR is rolled back to. The
+	// operator restores the spec of the revision and removes the annotation.
+	RollbackToAnnotation = "openstacklcm.airshipit.org/rollback-to"
+
+	// SuspendAnnotation set to "true" on an Oslc CR holds its flow until it is removed
+	// or the ResumeAnnotation is set.
+	SuspendAnnotation = "openstacklcm.airshipit.org/suspend"
+
+	// ResumeAnnotation set to "true" on an Oslc CR releases its suspended flow. The
+	// operator removes it along with the SuspendAnnotation.
+	ResumeAnnotation = "openstacklcm.airshipit.org/resume"
+
+	// AbortAnnotation set to "true" on an Oslc CR terminates its running flow. The
+	// operator removes it once the flow is terminated.
+	AbortAnnotation = "openstacklcm.airshipit.org/abort"
+
+	// SliceAnnotation contains the name of the slice of the service an Oslc or Phase CR
+	// applies its lifecycle to. Defaults to the SliceZoneAnnotation.
+	SliceAnnotation = "openstacklcm.airshipit.org/slice"
+
+	// SliceNodeSelectorAnnotation contains the comma separated key=value node labels
+	// selecting the nodes of the slice.
+	SliceNodeSelectorAnnotation = "openstacklcm.airshipit.org/slice-node-selector"
+
+	// SliceZoneAnnotation contains the availability zone of the nodes of the slice
+	SliceZoneAnnotation = "openstacklcm.airshipit.org/slice-zone"
+
+	// SliceReplicasAnnotation contains the number of replicas of the service running
+	// in the slice.
+	SliceReplicasAnnotation = "openstacklcm.airshipit.org/slice-replicas"
+
+	// DryRunAnnotation set to "true" on an Oslc or Phase CR makes the operator
+	// compute the plan of the actions it would perform without persisting them.
+	DryRunAnnotation = "openstacklcm.airshipit.org/dry-run"
+
+	// OwnerNameAnnotation contains the name of the Oslc or Phase CR owning a
+	// sub resource tracked by labels.
+	OwnerNameAnnotation = "openstacklcm.airshipit.org/owner-name"
+
+	// OwnerNamespaceAnnotation contains the namespace of the Oslc or Phase CR
+	// owning a sub resource tracked by labels.
+	OwnerNamespaceAnnotation = "openstacklcm.airshipit.org/owner-namespace"
+)
+
+// Labels set by the operator on the sub resources.
+const (
+	// ManagedByLabel identifies the sub resources managed by the operator
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+
+	// ManagedByValue is the value of the ManagedByLabel
+	ManagedByValue = "openstacklcm-operator"
+
+	// FlowKindLabel contains the flow kind of the objects executing the flow of an Oslc CR
+	FlowKindLabel = "openstacklcm.airshipit.org/flow-kind"
+
+	// FlowRunLabel contains the number of the run of the objects executing the flow of an Oslc CR
+	FlowRunLabel = "openstacklcm.airshipit.org/flow-run"
+
+	// SliceLabel contains the name of the slice the sub resources were rendered for
+	SliceLabel = "openstacklcm.airshipit.org/slice"
+
+	// RevisionOwnerLabel contains the UID of the Oslc or Phase CR a ControllerRevision
+	// records a snapshot of.
+	RevisionOwnerLabel = "openstacklcm.airshipit.org/revision-owner"
+
+	// RevisionHashLabel contains the hash of the snapshot recorded by a ControllerRevision
+	RevisionHashLabel = "openstacklcm.airshipit.org/revision-hash"
+
+	// ApprovalGateLabel contains the name of the gate a ConfigMap created by a flow
+	// controls, such as trafficdrain. The flow waits until the operator granted it.
+	ApprovalGateLabel = "openstacklcm.airshipit.org/approval-gate"
+
+	// DatabaseLabel marks the sub resources holding the data of the database of the
+	// service, such as its credentials Secrets and its backup Jobs. They are retained
+	// by the DeletePhase unless the database is purged, and by the RollbackPhase.
+	DatabaseLabel = "openstacklcm.airshipit.org/database"
+
+	// OwnerUIDLabel contains the UID of the Oslc or Phase CR owning a sub resource
+	// which can not carry an owner reference (cluster-scoped or in another namespace).
+	OwnerUIDLabel = "openstacklcm.airshipit.org/owner-uid"
+
+	// OwnerKindLabel contains the kind of the Oslc or Phase CR owning a sub resource
+	// tracked by labels.
+	OwnerKindLabel = "openstacklcm.airshipit.org/owner-kind"
+)
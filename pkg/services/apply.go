@@ -0,0 +1,109 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FieldManager is the name of the field manager used by the operator
+// when applying the sub resources with server-side apply.
+const FieldManager = "oslc-operator"
+
+// ApplyResource stamps the rendered version of a sub resource with its hash
+// and applies it using server-side apply. The operator forces the ownership
+// of the fields it renders. On success the object contains the live version.
+func ApplyResource(ctx context.Context, c client.Client, rendered *unstructured.Unstructured, opts ...client.PatchOption) error {
+	if err := SetLastAppliedHash(rendered); err != nil {
+		return err
+	}
+	return applyPatch(ctx, c, rendered, opts...)
+}
+
+// applyPatch sends a sub resource to the API server using server-side apply
+func applyPatch(ctx context.Context, c client.Client, rendered *unstructured.Unstructured, opts ...client.PatchOption) error {
+	// Server-side apply rejects the server populated metadata
+	rendered.SetResourceVersion("")
+	rendered.SetManagedFields(nil)
+
+	opts = append([]client.PatchOption{client.FieldOwner(FieldManager), client.ForceOwnership}, opts...)
+	return c.Patch(ctx, rendered, client.Apply, opts...)
+}
+
+// CreateResource creates a rendered sub resource using server-side apply, so that the
+// fields it renders are owned by the FieldManager from the start and pruned once they
+// are not rendered anymore. An object created meanwhile by someone else is adopted first,
+// according to the policy, and left untouched if the policy does not allow it. The object
+// is recorded in the inventory only if it is owned by the owners. It returns true if the
+// object did not exist.
+func CreateResource(ctx context.Context, c client.Client, inv *Inventory, rendered *unstructured.Unstructured,
+	owners []metav1.OwnerReference, policy AdoptionPolicy) (bool, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(rendered.GroupVersionKind())
+	err := c.Get(ctx, types.NamespacedName{Name: rendered.GetName(), Namespace: rendered.GetNamespace()}, live)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+
+	if err != nil {
+		if err := ApplyResource(ctx, c, rendered); err != nil {
+			return false, err
+		}
+		inv.Add(rendered)
+		return true, nil
+	}
+
+	adopted, err := Adopt(ctx, c, live, rendered, owners, policy)
+	if err != nil {
+		return false, err
+	}
+	if err := ApplyResource(ctx, c, rendered); err != nil {
+		return false, err
+	}
+	if adopted {
+		inv.MarkAdopted(rendered)
+	} else {
+		inv.Add(rendered)
+	}
+	return false, nil
+}
+
+// FindResource returns the object with the same kind, namespace and name in the list
+func FindResource(items []unstructured.Unstructured, u *unstructured.Unstructured) *unstructured.Unstructured {
+	for i := range items {
+		if IsSameResource(&items[i], u) {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// FindOrphans returns the deployed objects which are not in the rendered list anymore
+func FindOrphans(rendered []unstructured.Unstructured, deployed []unstructured.Unstructured) []unstructured.Unstructured {
+	orphans := make([]unstructured.Unstructured, 0)
+	for i := range deployed {
+		if FindResource(rendered, &deployed[i]) == nil {
+			orphans = append(orphans, deployed[i])
+		}
+	}
+	return orphans
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Keys of the data of the ConfigMap of an approval gate. The approver sets approved and
+// optionally approvedBy, expiresAt or expiresIn. The operator sets the other keys.
+// approvedBy is self-declared: the operator does not verify it. It defaults to the field
+// manager of the approval, such as kubectl-patch, which names the client and not the user.
+const (
+	approvalApprovedKey   = "approved"
+	approvalApprovedByKey = "approvedBy"
+	approvalExpiresAtKey  = "expiresAt"
+	approvalExpiresInKey  = "expiresIn"
+	approvalApprovedAtKey = "approvedAt"
+	approvalGrantedKey    = "granted"
+	approvalExpiredKey    = "expired"
+)
+
+// Approval is the state of an approval gate of the flow. A gate is a ConfigMap created
+// by the flow, labelled with the ApprovalGateLabel and named after the Workflow. The
+// step waiting for the approval succeeds once the operator granted it. An expired
+// approval stays expired until it is withdrawn, after which the gate can be approved
+// again.
+type Approval struct {
+	Gate       string       `json:"gate"`
+	Name       string       `json:"name"`
+	Granted    bool         `json:"granted"`
+	Expired    bool         `json:"expired,omitempty"`
+	ApprovedBy string       `json:"approvedBy,omitempty"`
+	ApprovedAt *metav1.Time `json:"approvedAt,omitempty"`
+	ExpiresAt  *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Changed is true when the approval has just been granted or has just expired
+	Changed bool `json:"-"`
+}
+
+// String returns a printable version of the approval
+func (a Approval) String() string {
+	switch {
+	case a.Expired:
+		return fmt.Sprintf("%s: expired at %s", a.Gate, a.ExpiresAt.UTC().Format(time.RFC3339))
+	case !a.Granted:
+		return fmt.Sprintf("%s: waiting for approval (configmap %s)", a.Gate, a.Name)
+	}
+	line := fmt.Sprintf("%s: approved by %s at %s", a.Gate, a.ApprovedBy, a.ApprovedAt.UTC().Format(time.RFC3339))
+	if a.ExpiresAt != nil {
+		line += ", expires at " + a.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return line
+}
+
+// SyncApprovals grants the approvals of the gates of the flow which have been approved and
+// records who approved them and when. The approvals which expired are revoked, unless the
+// flow completed. The gates belong to the flow when their name starts with the name of
+// its Workflow. The ConfigMaps are merge patched, so that the keys set concurrently by
+// the approver are preserved.
+func SyncApprovals(ctx context.Context, run *FlowRun) ([]Approval, error) {
+	prefixes := make([]string, 0)
+	for i := range run.Objects {
+		if run.Objects[i].GetKind() == argoWorkflowKind {
+			prefixes = append(prefixes, run.Objects[i].GetName()+"-")
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+
+	list := &corev1.ConfigMapList{}
+	if err := run.Client.List(ctx, list, client.InNamespace(run.Namespace), client.HasLabels{ApprovalGateLabel}); err != nil {
+		return nil, err
+	}
+
+	approvals := make([]Approval, 0)
+	errs := make([]error, 0)
+	for i := range list.Items {
+		cm := &list.Items[i]
+		if !hasAnyPrefix(cm.GetName(), prefixes) {
+			continue
+		}
+		patch := client.MergeFrom(cm.DeepCopy())
+		approval, changed := syncApproval(cm, run.Status)
+		if changed {
+			if err := run.Client.Patch(ctx, cm, patch); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			approval.Changed = true
+			log.Info("Approval changed", "gate", approval.Gate, "name", cm.GetName(), "granted", approval.Granted)
+		}
+		approvals = append(approvals, approval)
+	}
+
+	sort.SliceStable(approvals, func(i, j int) bool {
+		return approvals[i].Name < approvals[j].Name
+	})
+	return approvals, NewMultiError(errs)
+}
+
+// syncApproval computes the approval of a gate and updates its ConfigMap accordingly.
+// Returns true if the ConfigMap has to be updated.
+func syncApproval(cm *corev1.ConfigMap, flow *FlowStatus) (Approval, bool) {
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	data := cm.Data
+	approval := Approval{
+		Gate:       cm.GetLabels()[ApprovalGateLabel],
+		Name:       cm.GetName(),
+		Granted:    data[approvalGrantedKey] == "true",
+		Expired:    data[approvalExpiredKey] == "true",
+		ApprovedBy: data[approvalApprovedByKey],
+		ApprovedAt: parseApprovalTime(data[approvalApprovedAtKey]),
+		ExpiresAt:  parseApprovalTime(data[approvalExpiresAtKey]),
+	}
+	now := metav1.Now()
+	changed := false
+
+	if data[approvalApprovedKey] != "true" {
+		// Not approved yet, or the approval has been withdrawn. The withdrawal resets
+		// the expiry, so that the gate can be approved again.
+		if approval.Granted || approval.Expired {
+			data[approvalGrantedKey] = "false"
+			delete(data, approvalExpiredKey)
+			delete(data, approvalApprovedAtKey)
+			if _, ok := data[approvalExpiresInKey]; ok {
+				// Computed out of expiresIn by the operator
+				delete(data, approvalExpiresAtKey)
+				approval.ExpiresAt = nil
+			}
+			approval.Granted = false
+			approval.Expired = false
+			approval.ApprovedAt = nil
+			changed = true
+		}
+		return approval, changed
+	}
+
+	if !approval.Granted && !approval.Expired {
+		if approval.ApprovedBy == "" {
+			approval.ApprovedBy = approvalManager(cm)
+			data[approvalApprovedByKey] = approval.ApprovedBy
+		}
+		approval.ApprovedAt = &now
+		data[approvalApprovedAtKey] = now.UTC().Format(time.RFC3339)
+		if expiresIn, err := time.ParseDuration(data[approvalExpiresInKey]); err == nil && approval.ExpiresAt == nil {
+			expiresAt := metav1.NewTime(now.Add(expiresIn))
+			approval.ExpiresAt = &expiresAt
+			data[approvalExpiresAtKey] = expiresAt.UTC().Format(time.RFC3339)
+		}
+		approval.Granted = true
+		data[approvalGrantedKey] = "true"
+		changed = true
+	}
+
+	flowCompleted := flow != nil && flow.Phase.IsCompleted()
+	if approval.Granted && approval.ExpiresAt != nil && approval.ExpiresAt.Before(&now) && !flowCompleted {
+		approval.Granted = false
+		approval.Expired = true
+		data[approvalGrantedKey] = "false"
+		data[approvalExpiredKey] = "true"
+		changed = true
+	}
+	return approval, changed
+}
+
+// approvalManager returns the field manager which set the approval, such as kubectl-patch
+func approvalManager(cm *corev1.ConfigMap) string {
+	manager := "unknown"
+	for _, entry := range cm.GetManagedFields() {
+		if entry.FieldsV1 != nil && strings.Contains(string(entry.FieldsV1.Raw), `"f:`+approvalApprovedKey+`"`) {
+			manager = entry.Manager
+		}
+	}
+	return manager
+}
+
+// parseApprovalTime parses a RFC3339 timestamp, nil if not set or invalid
+func parseApprovalTime(value string) *metav1.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	t := metav1.NewTime(parsed)
+	return &t
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
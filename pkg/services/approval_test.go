@@ -0,0 +1,157 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newApprovalGate(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "openstack",
+			Name:      "keystone-upgrade-approval-trafficdrain",
+			Labels:    map[string]string{ApprovalGateLabel: "trafficdrain"},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{Manager: "kubectl-patch", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:approved":{}}}`)}},
+			},
+		},
+		Data: data,
+	}
+}
+
+func TestSyncApproval(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name          string
+		data          map[string]string
+		flowCompleted bool
+		wantGranted   bool
+		wantExpired   bool
+		wantChanged   bool
+		wantBy        string
+		wantExpiresAt bool
+	}{
+		{name: "not approved", data: nil},
+		{name: "approved", data: map[string]string{"approved": "true"},
+			wantGranted: true, wantChanged: true, wantBy: "kubectl-patch"},
+		{name: "approved by", data: map[string]string{"approved": "true", "approvedBy": "alice", "expiresIn": "2h"},
+			wantGranted: true, wantChanged: true, wantBy: "alice", wantExpiresAt: true},
+		{name: "granted", data: map[string]string{"approved": "true", "approvedBy": "alice", "granted": "true", "expiresAt": future},
+			wantGranted: true, wantBy: "alice", wantExpiresAt: true},
+		{name: "expires", data: map[string]string{"approved": "true", "approvedBy": "alice", "granted": "true", "expiresAt": past},
+			wantExpired: true, wantChanged: true, wantBy: "alice", wantExpiresAt: true},
+		{name: "expires after the flow completed", data: map[string]string{"approved": "true", "granted": "true", "expiresAt": past},
+			flowCompleted: true, wantGranted: true, wantExpiresAt: true},
+		{name: "expired stays expired", data: map[string]string{"approved": "true", "approvedBy": "alice", "expired": "true", "expiresAt": past},
+			wantExpired: true, wantBy: "alice", wantExpiresAt: true},
+		{name: "withdrawn", data: map[string]string{"approved": "false", "granted": "true"}, wantChanged: true},
+		{name: "withdrawn after expiry", data: map[string]string{"approved": "false", "expired": "true", "expiresIn": "2h", "expiresAt": past},
+			wantChanged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := newApprovalGate(tt.data)
+			flow := &FlowStatus{Phase: FlowStepRunning}
+			if tt.flowCompleted {
+				flow.Phase = FlowStepSucceeded
+			}
+
+			approval, changed := syncApproval(cm, flow)
+			if approval.Granted != tt.wantGranted || approval.Expired != tt.wantExpired || changed != tt.wantChanged {
+				t.Errorf("syncApproval() = granted %v, expired %v, changed %v, want %v, %v, %v",
+					approval.Granted, approval.Expired, changed, tt.wantGranted, tt.wantExpired, tt.wantChanged)
+			}
+			if approval.ApprovedBy != tt.wantBy {
+				t.Errorf("syncApproval() approvedBy = %v, want %v", approval.ApprovedBy, tt.wantBy)
+			}
+			if (approval.ExpiresAt != nil) != tt.wantExpiresAt {
+				t.Errorf("syncApproval() expiresAt = %v, want set %v", approval.ExpiresAt, tt.wantExpiresAt)
+			}
+
+			// The data of the ConfigMap matches the approval
+			if got := cm.Data["granted"] == "true"; got != approval.Granted {
+				t.Errorf("syncApproval() granted key = %q, want %v", cm.Data["granted"], approval.Granted)
+			}
+			if got := cm.Data["expired"] == "true"; got != approval.Expired {
+				t.Errorf("syncApproval() expired key = %q, want %v", cm.Data["expired"], approval.Expired)
+			}
+			if _, got := cm.Data["expiresAt"]; got != tt.wantExpiresAt {
+				t.Errorf("syncApproval() expiresAt key = %q, want set %v", cm.Data["expiresAt"], tt.wantExpiresAt)
+			}
+		})
+	}
+}
+
+func TestSyncApprovalReapproved(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	cm := newApprovalGate(map[string]string{"approved": "true", "expired": "true", "expiresIn": "2h", "expiresAt": past})
+
+	cm.Data["approved"] = "false"
+	syncApproval(cm, nil)
+	cm.Data["approved"] = "true"
+	approval, changed := syncApproval(cm, nil)
+	if !approval.Granted || approval.Expired || !changed {
+		t.Errorf("syncApproval() = granted %v, expired %v, changed %v, want granted again", approval.Granted, approval.Expired, changed)
+	}
+	if approval.ExpiresAt == nil || !approval.ExpiresAt.After(time.Now()) {
+		t.Errorf("syncApproval() expiresAt = %v, want computed again out of expiresIn", approval.ExpiresAt)
+	}
+}
+
+func TestSyncApprovals(t *testing.T) {
+	gate := newApprovalGate(map[string]string{"approved": "true", "approvedBy": "alice"})
+	gate.ManagedFields = nil
+	other := newApprovalGate(map[string]string{"approved": "true"})
+	other.Name = "glance-upgrade-approval-trafficdrain"
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(gate, other).Build()
+
+	workflow := newObject("argoproj.io/v1alpha1", "Workflow", "openstack", "keystone-upgrade", nil)
+	run := &FlowRun{Client: c, Namespace: "openstack", Objects: []unstructured.Unstructured{*workflow}}
+	approvals, err := SyncApprovals(context.TODO(), run)
+	if err != nil {
+		t.Fatalf("SyncApprovals() error = %v", err)
+	}
+	if len(approvals) != 1 || !approvals[0].Granted || !approvals[0].Changed || approvals[0].ApprovedBy != "alice" {
+		t.Fatalf("SyncApprovals() = %+v, want the gate of the flow granted", approvals)
+	}
+
+	live := &corev1.ConfigMap{}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(gate), live); err != nil {
+		t.Fatal(err)
+	}
+	if live.Data["granted"] != "true" || live.Data["approvedAt"] == "" || live.Data["approvedBy"] != "alice" {
+		t.Errorf("SyncApprovals() live data = %v, want the approval granted", live.Data)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(other), live); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := live.Data["granted"]; found {
+		t.Errorf("SyncApprovals() granted the gate of another flow: %v", live.Data)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	argoGroup                = "argoproj.io"
+	argoWorkflowKind         = "Workflow"
+	argoWorkflowTemplateKind = "WorkflowTemplate"
+)
+
+// argoWorkflowBackend submits the Workflow rendered out of the flow chart to Argo
+type argoWorkflowBackend struct{}
+
+func (b argoWorkflowBackend) Engine() FlowEngine {
+	return FlowEngineArgo
+}
+
+func (b argoWorkflowBackend) Handles(u *unstructured.Unstructured) bool {
+	return isArgoKind(u, argoWorkflowKind)
+}
+
+func (b argoWorkflowBackend) Render(run *FlowRun, rendered []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	if len(rendered) > 1 {
+		return nil, NewTypedError(ErrorTypeRender, fmt.Errorf("%d workflows rendered, expecting one", len(rendered)))
+	}
+	return rendered, nil
+}
+
+func (b argoWorkflowBackend) Submit(ctx context.Context, run *FlowRun) error {
+	return SubmitFlowObjects(ctx, run, b)
+}
+
+func (b argoWorkflowBackend) Status(ctx context.Context, run *FlowRun) (*FlowStatus, error) {
+	return argoWorkflowStatus(ctx, run)
+}
+
+func (b argoWorkflowBackend) Suspend(ctx context.Context, run *FlowRun, suspend bool) error {
+	return suspendArgoWorkflow(ctx, run, suspend)
+}
+
+func (b argoWorkflowBackend) Cancel(ctx context.Context, run *FlowRun) error {
+	return cancelArgoWorkflow(ctx, run)
+}
+
+func (b argoWorkflowBackend) Cleanup(ctx context.Context, run *FlowRun) error {
+	return CleanupFlowObjects(ctx, run, b)
+}
+
+// argoWorkflowTemplateBackend submits the flow to Argo as a WorkflowTemplate and a
+// Workflow referencing it. The WorkflowTemplate can be updated without disturbing the
+// Workflow which is running.
+type argoWorkflowTemplateBackend struct{}
+
+func (b argoWorkflowTemplateBackend) Engine() FlowEngine {
+	return FlowEngineArgoTemplate
+}
+
+func (b argoWorkflowTemplateBackend) Handles(u *unstructured.Unstructured) bool {
+	return isArgoKind(u, argoWorkflowKind) || isArgoKind(u, argoWorkflowTemplateKind)
+}
+
+// Render uses the rendered WorkflowTemplate, or builds it out of the spec of the rendered
+// Workflow. The Workflow is replaced by a Workflow referencing the WorkflowTemplate.
+func (b argoWorkflowTemplateBackend) Render(run *FlowRun, rendered []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	var template, workflow *unstructured.Unstructured
+	for i := range rendered {
+		switch rendered[i].GetKind() {
+		case argoWorkflowTemplateKind:
+			template = &rendered[i]
+		case argoWorkflowKind:
+			workflow = &rendered[i]
+		}
+	}
+	if workflow == nil {
+		if template == nil {
+			return nil, nil
+		}
+		workflow = template
+	}
+
+	if template == nil {
+		template = workflow.DeepCopy()
+		template.SetKind(argoWorkflowTemplateKind)
+	}
+
+	ref := &unstructured.Unstructured{}
+	ref.SetAPIVersion(workflow.GetAPIVersion())
+	ref.SetKind(argoWorkflowKind)
+	ref.SetNamespace(workflow.GetNamespace())
+	ref.SetName(workflow.GetName())
+	ref.SetLabels(workflow.GetLabels())
+	ref.SetOwnerReferences(workflow.GetOwnerReferences())
+	if err := unstructured.SetNestedField(ref.Object, template.GetName(), "spec", "workflowTemplateRef", "name"); err != nil {
+		return nil, NewTypedError(ErrorTypeRender, err)
+	}
+	if workflow != template {
+		if arguments, found, _ := unstructured.NestedMap(workflow.Object, "spec", "arguments"); found {
+			if err := unstructured.SetNestedMap(ref.Object, arguments, "spec", "arguments"); err != nil {
+				return nil, NewTypedError(ErrorTypeRender, err)
+			}
+		}
+	}
+
+	return []unstructured.Unstructured{*template, *ref}, nil
+}
+
+func (b argoWorkflowTemplateBackend) Submit(ctx context.Context, run *FlowRun) error {
+	return SubmitFlowObjects(ctx, run, b)
+}
+
+func (b argoWorkflowTemplateBackend) Status(ctx context.Context, run *FlowRun) (*FlowStatus, error) {
+	return argoWorkflowStatus(ctx, run)
+}
+
+func (b argoWorkflowTemplateBackend) Suspend(ctx context.Context, run *FlowRun, suspend bool) error {
+	return suspendArgoWorkflow(ctx, run, suspend)
+}
+
+func (b argoWorkflowTemplateBackend) Cancel(ctx context.Context, run *FlowRun) error {
+	return cancelArgoWorkflow(ctx, run)
+}
+
+func (b argoWorkflowTemplateBackend) Cleanup(ctx context.Context, run *FlowRun) error {
+	return CleanupFlowObjects(ctx, run, b)
+}
+
+func isArgoKind(u *unstructured.Unstructured, kind string) bool {
+	return u.GroupVersionKind().Group == argoGroup && u.GetKind() == kind
+}
+
+// argoWorkflow returns the live version of the Workflow of the flow, nil if it has not
+// been submitted yet
+func argoWorkflow(ctx context.Context, run *FlowRun) (*unstructured.Unstructured, error) {
+	for i := range run.Objects {
+		if !isArgoKind(&run.Objects[i], argoWorkflowKind) {
+			continue
+		}
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(run.Objects[i].GroupVersionKind())
+		err := run.Client.Get(ctx, types.NamespacedName{Namespace: run.Objects[i].GetNamespace(), Name: run.Objects[i].GetName()}, live)
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return live, err
+	}
+	return nil, nil
+}
+
+// argoWorkflowStatus returns the progress of the Workflow of the flow out of its phase
+// and the status of its nodes
+func argoWorkflowStatus(ctx context.Context, run *FlowRun) (*FlowStatus, error) {
+	workflow, err := argoWorkflow(ctx, run)
+	if err != nil || workflow == nil {
+		return nil, err
+	}
+
+	phase, _, _ := unstructured.NestedString(workflow.Object, "status", "phase")
+	return &FlowStatus{Phase: argoPhase(phase), Steps: argoSteps(run, workflow)}, nil
+}
+
+// argoPhase converts the phase of a Workflow or of one of its nodes
+func argoPhase(phase string) FlowStepPhase {
+	switch phase {
+	case "", "Pending":
+		return FlowStepPending
+	case "Succeeded":
+		return FlowStepSucceeded
+	case "Failed", "Error":
+		return FlowStepFailed
+	case "Skipped", "Omitted":
+		return FlowStepSkipped
+	default:
+		return FlowStepRunning
+	}
+}
+
+// argoSteps returns the steps of a Workflow out of the nodes of its status, ordered by
+// start time. Only the nodes executing a template are steps: the nodes grouping steps
+// are ignored, as well as the attempts of a step which is retried, which are counted
+// as its retries.
+func argoSteps(run *FlowRun, workflow *unstructured.Unstructured) []FlowStep {
+	steps := make([]FlowStep, 0)
+	nodes, _, _ := unstructured.NestedMap(workflow.Object, "status", "nodes")
+
+	attempts := map[string]bool{}
+	for _, value := range nodes {
+		node, _ := value.(map[string]interface{})
+		if nodeType, _, _ := unstructured.NestedString(node, "type"); nodeType != "Retry" {
+			continue
+		}
+		children, _, _ := unstructured.NestedStringSlice(node, "children")
+		for _, child := range children {
+			attempts[child] = true
+		}
+	}
+
+	templates := argoTemplates(run)
+	for id, value := range nodes {
+		node, _ := value.(map[string]interface{})
+		nodeType, _, _ := unstructured.NestedString(node, "type")
+		if attempts[id] {
+			continue
+		}
+		switch nodeType {
+		case "Pod", "Retry", "Skipped", "Suspend":
+		default:
+			continue
+		}
+
+		step := FlowStep{}
+		step.Name, _, _ = unstructured.NestedString(node, "displayName")
+		phase, _, _ := unstructured.NestedString(node, "phase")
+		step.Phase = argoPhase(phase)
+		step.Message, _, _ = unstructured.NestedString(node, "message")
+		step.StartedAt = argoTime(node, "startedAt")
+		step.FinishedAt = argoTime(node, "finishedAt")
+		templateName, _, _ := unstructured.NestedString(node, "templateName")
+		if target, ok := templates[templateName]; ok {
+			step.Kind = target.GetKind()
+			step.ObjectName = target.GetName()
+		}
+		if nodeType == "Retry" {
+			if children, _, _ := unstructured.NestedStringSlice(node, "children"); len(children) > 1 {
+				step.Retries = len(children) - 1
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		if steps[i].StartedAt == nil || steps[j].StartedAt == nil {
+			if steps[i].StartedAt != nil || steps[j].StartedAt != nil {
+				return steps[i].StartedAt != nil
+			}
+			return steps[i].Name < steps[j].Name
+		}
+		if !steps[i].StartedAt.Equal(steps[j].StartedAt) {
+			return steps[i].StartedAt.Before(steps[j].StartedAt)
+		}
+		return steps[i].Name < steps[j].Name
+	})
+	return steps
+}
+
+// argoTemplates returns the objects the resource templates of the flow act upon, indexed
+// by template name. The name of the object is left empty when it is set by a parameter.
+func argoTemplates(run *FlowRun) map[string]*unstructured.Unstructured {
+	targets := map[string]*unstructured.Unstructured{}
+	for i := range run.Objects {
+		templates, _, _ := unstructured.NestedSlice(run.Objects[i].Object, "spec", "templates")
+		for _, value := range templates {
+			template, _ := value.(map[string]interface{})
+			name, _, _ := unstructured.NestedString(template, "name")
+			manifest, found, _ := unstructured.NestedString(template, "resource", "manifest")
+			if !found {
+				continue
+			}
+			target := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(manifest), &target.Object); err != nil || target.Object == nil {
+				continue
+			}
+			if strings.Contains(target.GetName(), "{{") {
+				target.SetName("")
+			}
+			targets[name] = target
+		}
+	}
+	return targets
+}
+
+// argoTime parses a timestamp of a node, nil if not set
+func argoTime(node map[string]interface{}, field string) *metav1.Time {
+	value, _, _ := unstructured.NestedString(node, field)
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	t := metav1.NewTime(parsed)
+	return &t
+}
+
+// suspendArgoWorkflow requests Argo to suspend or resume the Workflow of the flow
+func suspendArgoWorkflow(ctx context.Context, run *FlowRun, suspend bool) error {
+	workflow, err := argoWorkflow(ctx, run)
+	if err != nil || workflow == nil {
+		return err
+	}
+	if suspended, _, _ := unstructured.NestedBool(workflow.Object, "spec", "suspend"); suspended == suspend {
+		return nil
+	}
+	patch := []byte(`{"spec":{"suspend":null}}`)
+	if suspend {
+		patch = []byte(`{"spec":{"suspend":true}}`)
+	}
+	if err := run.Client.Patch(ctx, workflow, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return NewResourceError(OperationApply, workflow, err)
+	}
+	log.Info("Suspended flow", "kind", workflow.GetKind(), "name", workflow.GetName(), "suspend", suspend)
+	return nil
+}
+
+// cancelArgoWorkflow requests Argo to terminate the Workflow of the flow
+func cancelArgoWorkflow(ctx context.Context, run *FlowRun) error {
+	workflow, err := argoWorkflow(ctx, run)
+	if err != nil || workflow == nil {
+		return err
+	}
+	patch := []byte(`{"spec":{"shutdown":"Terminate"}}`)
+	if err := run.Client.Patch(ctx, workflow, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return NewResourceError(OperationApply, workflow, err)
+	}
+	log.Info("Cancelled flow", "kind", workflow.GetKind(), "name", workflow.GetName())
+	return nil
+}
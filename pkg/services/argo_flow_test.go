@@ -0,0 +1,536 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newWorkflow returns an Argo Workflow, or WorkflowTemplate, of the keystone flow
+func newWorkflow(kind string, name string) *unstructured.Unstructured {
+	return newObject("argoproj.io/v1alpha1", kind, "openstack", name, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"entrypoint": "keystone-install",
+			"arguments": map[string]interface{}{
+				"parameters": []interface{}{map[string]interface{}{"name": "version", "value": "train"}},
+			},
+			"templates": []interface{}{
+				map[string]interface{}{
+					"name": "create-install",
+					"resource": map[string]interface{}{
+						"action":   "create",
+						"manifest": "apiVersion: openstacklcm.airshipit.org/v1alpha1\nkind: InstallPhase\nmetadata:\n  name: keystone-install\n",
+					},
+				},
+			},
+		},
+	})
+}
+
+// newFlowRun returns the run of the keystone flow
+func newFlowRun(c client.Client) *FlowRun {
+	owners := []metav1.OwnerReference{newOwnerRef("keystone", "uid-keystone")}
+	return &FlowRun{
+		Client:    c,
+		Owners:    owners,
+		Name:      "keystone",
+		Namespace: "openstack",
+		Inventory: NewInventory("openstack", owners),
+	}
+}
+
+// liveWorkflow returns the live version of the Workflow of the flow
+func liveWorkflow(t *testing.T, c client.Client) *unstructured.Unstructured {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(newWorkflow(argoWorkflowKind, "").GroupVersionKind())
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "openstack", Name: "keystone-install"}, live); err != nil {
+		t.Fatalf("Get() Workflow error = %v", err)
+	}
+	return live
+}
+
+func TestArgoWorkflowRender(t *testing.T) {
+	backend := argoWorkflowBackend{}
+	workflow := newWorkflow(argoWorkflowKind, "keystone-install")
+
+	objects, err := backend.Render(newFlowRun(nil), []unstructured.Unstructured{*workflow})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if len(objects) != 1 || !reflect.DeepEqual(objects[0].Object, workflow.Object) {
+		t.Errorf("Render() = %v, want the rendered Workflow", objects)
+	}
+
+	_, err = backend.Render(newFlowRun(nil), []unstructured.Unstructured{*workflow, *newWorkflow(argoWorkflowKind, "keystone-test")})
+	if !errors.Is(err, ErrRender) {
+		t.Errorf("Render() of two Workflows error = %v, want a RenderError", err)
+	}
+
+	if !backend.Handles(workflow) || backend.Handles(newWorkflow(argoWorkflowTemplateKind, "keystone-install")) {
+		t.Errorf("Handles() does not handle only the Workflows")
+	}
+}
+
+func TestArgoWorkflowTemplateRender(t *testing.T) {
+	workflow := newWorkflow(argoWorkflowKind, "keystone-install")
+	template := newWorkflow(argoWorkflowTemplateKind, "keystone-install-template")
+	arguments, _, _ := unstructured.NestedMap(workflow.Object, "spec", "arguments")
+
+	tests := []struct {
+		name          string
+		rendered      []unstructured.Unstructured
+		wantTemplate  string
+		wantArguments bool
+	}{
+		{name: "workflow", rendered: []unstructured.Unstructured{*workflow},
+			wantTemplate: "keystone-install", wantArguments: true},
+		{name: "workflow and template", rendered: []unstructured.Unstructured{*template, *workflow},
+			wantTemplate: "keystone-install-template", wantArguments: true},
+		{name: "template", rendered: []unstructured.Unstructured{*template},
+			wantTemplate: "keystone-install-template", wantArguments: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := argoWorkflowTemplateBackend{}.Render(newFlowRun(nil), tt.rendered)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if len(objects) != 2 {
+				t.Fatalf("Render() = %d objects, want a WorkflowTemplate and a Workflow", len(objects))
+			}
+
+			rendered, ref := objects[0], objects[1]
+			if rendered.GetKind() != argoWorkflowTemplateKind || rendered.GetName() != tt.wantTemplate {
+				t.Errorf("Render() template = %s %s, want %s %s", rendered.GetKind(), rendered.GetName(),
+					argoWorkflowTemplateKind, tt.wantTemplate)
+			}
+			templates, _, _ := unstructured.NestedSlice(rendered.Object, "spec", "templates")
+			if len(templates) != 1 {
+				t.Errorf("Render() template lost the templates of the flow: %v", rendered.Object["spec"])
+			}
+
+			if ref.GetKind() != argoWorkflowKind || ref.GetNamespace() != "openstack" {
+				t.Errorf("Render() workflow = %s %s/%s", ref.GetKind(), ref.GetNamespace(), ref.GetName())
+			}
+			if name, _, _ := unstructured.NestedString(ref.Object, "spec", "workflowTemplateRef", "name"); name != tt.wantTemplate {
+				t.Errorf("Render() workflowTemplateRef = %q, want %q", name, tt.wantTemplate)
+			}
+			if _, found, _ := unstructured.NestedSlice(ref.Object, "spec", "templates"); found {
+				t.Errorf("Render() workflow still contains the templates")
+			}
+			gotArguments, found, _ := unstructured.NestedMap(ref.Object, "spec", "arguments")
+			if found != tt.wantArguments || (found && !reflect.DeepEqual(gotArguments, arguments)) {
+				t.Errorf("Render() workflow arguments = %v, want %v", gotArguments, tt.wantArguments)
+			}
+		})
+	}
+
+	objects, err := argoWorkflowTemplateBackend{}.Render(newFlowRun(nil), nil)
+	if err != nil || len(objects) != 0 {
+		t.Errorf("Render() of nothing = %v, %v", objects, err)
+	}
+}
+
+func TestArgoFlowBackends(t *testing.T) {
+	tests := []struct {
+		name      string
+		backend   FlowBackend
+		wantKinds []string
+	}{
+		{name: "argo", backend: argoWorkflowBackend{}, wantKinds: []string{argoWorkflowKind}},
+		{name: "argo-template", backend: argoWorkflowTemplateBackend{},
+			wantKinds: []string{argoWorkflowKind, argoWorkflowTemplateKind}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			if got := GetFlowBackend(tt.backend.Engine()); got != tt.backend {
+				t.Errorf("GetFlowBackend(%s) = %v", tt.backend.Engine(), got)
+			}
+
+			c := &writeRecorder{Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()}
+			run := newFlowRun(c)
+			objects, err := tt.backend.Render(run, []unstructured.Unstructured{*newWorkflow(argoWorkflowKind, "keystone-install")})
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			run.Objects = objects
+
+			// Nothing has been submitted yet
+			status, err := tt.backend.Status(ctx, run)
+			if err != nil || status != nil {
+				t.Errorf("Status() before Submit = %v, %v, want nil", status, err)
+			}
+
+			if err := tt.backend.Submit(ctx, run); err != nil {
+				t.Fatalf("Submit() error = %v", err)
+			}
+			kinds := make([]string, 0)
+			for _, u := range run.Inventory.Objects() {
+				kinds = append(kinds, u.GetKind())
+			}
+			sort.Strings(kinds)
+			if !reflect.DeepEqual(kinds, tt.wantKinds) || len(run.Touched) != len(tt.wantKinds) {
+				t.Errorf("Submit() recorded %v and touched %d objects, want %v", kinds, len(run.Touched), tt.wantKinds)
+			}
+			for _, u := range objects {
+				if FindResource(run.Inventory.Objects(), &u) == nil {
+					t.Errorf("%s %s is not recorded in the inventory", u.GetKind(), u.GetName())
+				}
+			}
+
+			// Submitting again the unchanged flow sends no write
+			writes := len(c.writes)
+			if err := tt.backend.Submit(ctx, run); err != nil {
+				t.Fatalf("Submit() again error = %v", err)
+			}
+			if len(c.writes) != writes {
+				t.Errorf("Submit() again sent writes %v", c.writes[writes:])
+			}
+
+			// The status of the Workflow is mirrored
+			live := liveWorkflow(t, c)
+			if err := unstructured.SetNestedField(live.Object, "Running", "status", "phase"); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Update(ctx, live); err != nil {
+				t.Fatal(err)
+			}
+			status, err = tt.backend.Status(ctx, run)
+			if err != nil || status == nil || status.Phase != FlowStepRunning {
+				t.Errorf("Status() = %v, %v, want %s", status, err, FlowStepRunning)
+			}
+
+			// Suspend and resume patch spec.suspend, only when it changes
+			for _, suspend := range []bool{true, true, false} {
+				if err := tt.backend.Suspend(ctx, run, suspend); err != nil {
+					t.Fatalf("Suspend(%v) error = %v", suspend, err)
+				}
+				got, found, _ := unstructured.NestedBool(liveWorkflow(t, c).Object, "spec", "suspend")
+				if got != suspend || found != suspend {
+					t.Errorf("Suspend(%v) spec.suspend = %v (found %v)", suspend, got, found)
+				}
+			}
+			if got := countWrites(c.writes, "patch"); got != 2 {
+				t.Errorf("Suspend() sent %d patches, want 2", got)
+			}
+
+			// Cancel terminates the Workflow
+			if err := tt.backend.Cancel(ctx, run); err != nil {
+				t.Fatalf("Cancel() error = %v", err)
+			}
+			if shutdown, _, _ := unstructured.NestedString(liveWorkflow(t, c).Object, "spec", "shutdown"); shutdown != "Terminate" {
+				t.Errorf("Cancel() spec.shutdown = %q, want Terminate", shutdown)
+			}
+
+			// Cleanup deletes the objects of the flow and only them
+			configMap := newObject("v1", "ConfigMap", "openstack", "keystone-etc", nil)
+			if err := c.Create(ctx, configMap); err != nil {
+				t.Fatal(err)
+			}
+			run.Inventory.Add(configMap)
+			if err := tt.backend.Cleanup(ctx, run); err != nil {
+				t.Fatalf("Cleanup() error = %v", err)
+			}
+			for _, u := range objects {
+				live := &unstructured.Unstructured{}
+				live.SetGroupVersionKind(u.GroupVersionKind())
+				if err := c.Get(ctx, client.ObjectKeyFromObject(&u), live); !apierrors.IsNotFound(err) {
+					t.Errorf("%s %s still exists: %v", u.GetKind(), u.GetName(), err)
+				}
+			}
+			if remaining := run.Inventory.Objects(); len(remaining) != 1 || remaining[0].GetKind() != "ConfigMap" {
+				t.Errorf("Cleanup() left %v in the inventory, want the ConfigMap", remaining)
+			}
+		})
+	}
+}
+
+// countWrites counts the writes of a verb
+func countWrites(writes []recordedWrite, verb string) int {
+	count := 0
+	for _, w := range writes {
+		if w.verb == verb {
+			count++
+		}
+	}
+	return count
+}
+
+// argoUpgradeNodes are the nodes of the status of the keystone upgrade Workflow whose
+// tests failed and which is rolling back
+const argoUpgradeNodes = `
+keystone-upgrade:
+  id: keystone-upgrade
+  displayName: keystone-upgrade
+  templateName: keystone-upgrade
+  type: Steps
+  phase: Running
+  startedAt: "2019-10-01T10:00:00Z"
+  children: [keystone-upgrade-1]
+keystone-upgrade-1:
+  id: keystone-upgrade-1
+  displayName: "[0]"
+  type: StepGroup
+  phase: Succeeded
+  startedAt: "2019-10-01T10:00:00Z"
+  children: [keystone-upgrade-2]
+keystone-upgrade-2:
+  id: keystone-upgrade-2
+  displayName: keystone-check-flow-startpoint
+  templateName: check-flow-startpoint
+  type: Pod
+  phase: Succeeded
+  startedAt: "2019-10-01T10:00:01Z"
+  finishedAt: "2019-10-01T10:00:05Z"
+keystone-upgrade-3:
+  id: keystone-upgrade-3
+  displayName: keystone-wait-trafficdrain-approval
+  templateName: wait-trafficdrain-approval
+  type: Suspend
+  phase: Succeeded
+  startedAt: "2019-10-01T10:00:06Z"
+  finishedAt: "2019-10-01T10:05:00Z"
+keystone-upgrade-4:
+  id: keystone-upgrade-4
+  displayName: keystone-start-upgrade
+  templateName: create-upgrade
+  type: Pod
+  phase: Succeeded
+  startedAt: "2019-10-01T10:05:01Z"
+  finishedAt: "2019-10-01T10:05:03Z"
+keystone-upgrade-5:
+  id: keystone-upgrade-5
+  displayName: keystone-wait-upgrade-completion
+  templateName: wait-upgrade-completion
+  type: Retry
+  phase: Succeeded
+  startedAt: "2019-10-01T10:05:04Z"
+  finishedAt: "2019-10-01T10:09:00Z"
+  children: [keystone-upgrade-6, keystone-upgrade-7]
+keystone-upgrade-6:
+  id: keystone-upgrade-6
+  displayName: keystone-wait-upgrade-completion(0)
+  templateName: wait-upgrade-completion
+  type: Pod
+  phase: Failed
+  message: "timeout"
+  startedAt: "2019-10-01T10:05:04Z"
+  finishedAt: "2019-10-01T10:07:00Z"
+keystone-upgrade-7:
+  id: keystone-upgrade-7
+  displayName: keystone-wait-upgrade-completion(1)
+  templateName: wait-upgrade-completion
+  type: Pod
+  phase: Succeeded
+  startedAt: "2019-10-01T10:07:01Z"
+  finishedAt: "2019-10-01T10:09:00Z"
+keystone-upgrade-8:
+  id: keystone-upgrade-8
+  displayName: keystone-wait-test-completion
+  templateName: wait-test-completion
+  type: Retry
+  phase: Failed
+  message: "No more retries left"
+  startedAt: "2019-10-01T10:09:01Z"
+  finishedAt: "2019-10-01T10:12:00Z"
+  children: [keystone-upgrade-9, keystone-upgrade-10, keystone-upgrade-11]
+keystone-upgrade-9:
+  id: keystone-upgrade-9
+  displayName: keystone-wait-test-completion(0)
+  templateName: wait-test-completion
+  type: Pod
+  phase: Failed
+  startedAt: "2019-10-01T10:09:01Z"
+keystone-upgrade-10:
+  id: keystone-upgrade-10
+  displayName: keystone-wait-test-completion(1)
+  templateName: wait-test-completion
+  type: Pod
+  phase: Failed
+  startedAt: "2019-10-01T10:10:01Z"
+keystone-upgrade-11:
+  id: keystone-upgrade-11
+  displayName: keystone-wait-test-completion(2)
+  templateName: wait-test-completion
+  type: Pod
+  phase: Failed
+  startedAt: "2019-10-01T10:11:01Z"
+keystone-upgrade-12:
+  id: keystone-upgrade-12
+  displayName: keystone-start-trafficrollout
+  templateName: create-trafficrollout
+  type: Skipped
+  phase: Skipped
+  message: "when 'failed == passed' evaluated false"
+  startedAt: "2019-10-01T10:12:01Z"
+  finishedAt: "2019-10-01T10:12:01Z"
+keystone-upgrade-13:
+  id: keystone-upgrade-13
+  displayName: keystone-start-rollback
+  templateName: create-rollback
+  type: Pod
+  phase: Running
+  startedAt: "2019-10-01T10:12:02Z"
+`
+
+// newUpgradeWorkflow returns the keystone upgrade Workflow, whose resource templates act upon
+// the Phase CRs of the kinds
+func newUpgradeWorkflow(t *testing.T, phases map[string]string) *unstructured.Unstructured {
+	templates := make([]interface{}, 0, len(phases))
+	for template, kind := range phases {
+		templates = append(templates, map[string]interface{}{
+			"name": template,
+			"resource": map[string]interface{}{
+				"action": "get",
+				"manifest": "apiVersion: openstacklcm.airshipit.org/v1alpha1\nkind: " + kind +
+					"\nmetadata:\n  name: keystone-" + strings.ToLower(strings.TrimSuffix(kind, "Phase")) + "\n",
+			},
+		})
+	}
+	templates = append(templates, map[string]interface{}{"name": "wait-trafficdrain-approval", "suspend": map[string]interface{}{}})
+
+	nodes := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(argoUpgradeNodes), &nodes); err != nil {
+		t.Fatalf("invalid nodes fixture: %v", err)
+	}
+	return newObject("argoproj.io/v1alpha1", argoWorkflowKind, "openstack", "keystone-upgrade", map[string]interface{}{
+		"spec":   map[string]interface{}{"entrypoint": "keystone-upgrade", "templates": templates},
+		"status": map[string]interface{}{"phase": "Running", "nodes": nodes},
+	})
+}
+
+func TestArgoSteps(t *testing.T) {
+	workflow := newUpgradeWorkflow(t, map[string]string{
+		"check-flow-startpoint":   "OperationalPhase",
+		"create-upgrade":          "UpgradePhase",
+		"wait-upgrade-completion": "UpgradePhase",
+		"wait-test-completion":    "TestPhase",
+		"create-trafficrollout":   "TrafficRolloutPhase",
+		"create-rollback":         "RollbackPhase",
+	})
+	run := newFlowRun(nil)
+	run.Objects = []unstructured.Unstructured{*workflow}
+
+	steps := argoSteps(run, workflow)
+
+	want := []struct {
+		name    string
+		phase   FlowStepPhase
+		kind    string
+		object  string
+		retries int
+	}{
+		{name: "keystone-check-flow-startpoint", phase: FlowStepSucceeded, kind: "OperationalPhase", object: "keystone-operational"},
+		{name: "keystone-wait-trafficdrain-approval", phase: FlowStepSucceeded},
+		{name: "keystone-start-upgrade", phase: FlowStepSucceeded, kind: "UpgradePhase", object: "keystone-upgrade"},
+		{name: "keystone-wait-upgrade-completion", phase: FlowStepSucceeded, kind: "UpgradePhase", object: "keystone-upgrade", retries: 1},
+		{name: "keystone-wait-test-completion", phase: FlowStepFailed, kind: "TestPhase", object: "keystone-test", retries: 2},
+		{name: "keystone-start-trafficrollout", phase: FlowStepSkipped, kind: "TrafficRolloutPhase", object: "keystone-trafficrollout"},
+		{name: "keystone-start-rollback", phase: FlowStepRunning, kind: "RollbackPhase", object: "keystone-rollback"},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("argoSteps() = %d steps, want %d:\n%s", len(steps), len(want), (&FlowStatus{Steps: steps}).Format())
+	}
+	for i, w := range want {
+		got := steps[i]
+		if got.Name != w.name || got.Phase != w.phase || got.Kind != w.kind || got.ObjectName != w.object || got.Retries != w.retries {
+			t.Errorf("step %d = %s %s %s/%s retries %d, want %s %s %s/%s retries %d", i,
+				got.Name, got.Phase, got.Kind, got.ObjectName, got.Retries, w.name, w.phase, w.kind, w.object, w.retries)
+		}
+		if got.StartedAt == nil {
+			t.Errorf("step %s has no start time", got.Name)
+		}
+	}
+	if got := steps[4].Message; got != "No more retries left" {
+		t.Errorf("failed step message = %q", got)
+	}
+	if steps[6].FinishedAt != nil {
+		t.Errorf("running step has a finish time %v", steps[6].FinishedAt)
+	}
+
+	flow := &FlowStatus{Phase: FlowStepRunning, Steps: steps}
+	if got := flow.CurrentPhase(); got != "rollback" {
+		t.Errorf("CurrentPhase() = %q, want rollback", got)
+	}
+	if failed := flow.FailedStep(); failed == nil || failed.Name != "keystone-wait-test-completion" {
+		t.Errorf("FailedStep() = %v, want keystone-wait-test-completion", failed)
+	}
+	wantSummary := "4/7 steps succeeded, 1 running, 1 failed, 1 skipped, current: keystone-start-rollback"
+	if got := flow.Summary(); got != wantSummary {
+		t.Errorf("Summary() = %q, want %q", got, wantSummary)
+	}
+}
+
+func TestArgoWorkflowStatus(t *testing.T) {
+	workflow := newUpgradeWorkflow(t, map[string]string{"create-rollback": "RollbackPhase"})
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(workflow.DeepCopy()).Build()
+	run := newFlowRun(c)
+	run.Objects = []unstructured.Unstructured{*workflow}
+
+	tests := []struct {
+		phase string
+		want  FlowStepPhase
+	}{
+		{phase: "", want: FlowStepPending},
+		{phase: "Pending", want: FlowStepPending},
+		{phase: "Running", want: FlowStepRunning},
+		{phase: "Succeeded", want: FlowStepSucceeded},
+		{phase: "Failed", want: FlowStepFailed},
+		{phase: "Error", want: FlowStepFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phase, func(t *testing.T) {
+			live := workflow.DeepCopy()
+			if err := c.Get(context.TODO(), client.ObjectKeyFromObject(workflow), live); err != nil {
+				t.Fatal(err)
+			}
+			if err := unstructured.SetNestedField(live.Object, tt.phase, "status", "phase"); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Update(context.TODO(), live); err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := argoWorkflowStatus(context.TODO(), run)
+			if err != nil {
+				t.Fatalf("argoWorkflowStatus() error = %v", err)
+			}
+			if status.Phase != tt.want {
+				t.Errorf("argoWorkflowStatus() phase = %s, want %s", status.Phase, tt.want)
+			}
+			if len(status.Steps) != 7 || status.CurrentPhase() != "rollback" {
+				t.Errorf("argoWorkflowStatus() steps:\n%s", status.Format())
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"errors"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+)
+
+// Condition reasons used by the operator on top of the ones defined
+// alongside the CRDs.
+const (
+	// ReasonUnderlyingResourcesProgressing indicates that the sub resources
+	// are neither ready nor failed yet.
+	ReasonUnderlyingResourcesProgressing = "UnderlyingResourcesProgressing"
+
+	// ReasonAdopted is the reason of the event emitted when an existing
+	// sub resource is adopted.
+	ReasonAdopted = "Adopted"
+
+	// ReasonDryRunSuccessful indicates that the plan of a dry run has been computed
+	ReasonDryRunSuccessful = "DryRunSuccessful"
+
+	// ReasonDryRunError indicates that the plan of a dry run could not be computed
+	ReasonDryRunError = "DryRunError"
+
+	// ReasonFlowRunning indicates that the steps of the flow are being executed
+	ReasonFlowRunning = "FlowRunning"
+
+	// ReasonFlowSucceeded indicates that all the steps of the flow completed
+	ReasonFlowSucceeded = "FlowSucceeded"
+
+	// ReasonFlowFailed indicates that a step of the flow failed
+	ReasonFlowFailed = "FlowFailed"
+
+	// ReasonRevisionRecorded indicates that a ControllerRevision records the current spec
+	ReasonRevisionRecorded = "RevisionRecorded"
+
+	// ReasonRevisionError indicates that the current spec could not be recorded
+	ReasonRevisionError = "RevisionError"
+
+	// ReasonRollbackStarted indicates that the spec of a previous revision has been restored
+	ReasonRollbackStarted = "RollbackStarted"
+
+	// ReasonRollbackError indicates that the revision to roll back to could not be restored
+	ReasonRollbackError = "RollbackError"
+
+	// ReasonFlowSuspended indicates that the flow is held by spec.suspend or the SuspendAnnotation
+	ReasonFlowSuspended = "FlowSuspended"
+
+	// ReasonFlowResumed indicates that the flow has been released by the ResumeAnnotation
+	ReasonFlowResumed = "FlowResumed"
+
+	// ReasonFlowAborted indicates that the flow has been terminated by the AbortAnnotation
+	ReasonFlowAborted = "FlowAborted"
+
+	// ReasonApprovalPending indicates that an approval gate of the flow waits for an approval
+	ReasonApprovalPending = "ApprovalPending"
+
+	// ReasonApprovalGranted indicates that the approval gates of the flow have been granted
+	ReasonApprovalGranted = "ApprovalGranted"
+
+	// ReasonApprovalExpired is the reason of the event emitted when an approval expires
+	ReasonApprovalExpired = "ApprovalExpired"
+)
+
+// Condition types used by the operator on top of the ones defined
+// alongside the CRDs.
+const (
+	// ConditionDryRun is set on the CRs in dry run mode. Its message contains the plan.
+	ConditionDryRun = "DryRun"
+
+	// ConditionFlow is set on the Oslc CRs whose flow is executed by the operator.
+	// Its message contains the progress of each step.
+	ConditionFlow = "Flow"
+
+	// ConditionRevision contains the current and previous revision numbers of the CR
+	ConditionRevision = "Revision"
+
+	// ConditionSuspended is true while the flow of an Oslc CR is held
+	ConditionSuspended = "Suspended"
+
+	// ConditionAborted is set on the Oslc CRs whose flow has been terminated
+	ConditionAborted = "Aborted"
+
+	// ConditionApproval is set on the Oslc CRs whose flow has approval gates. Its
+	// message contains who approved each gate and when.
+	ConditionApproval = "Approval"
+)
+
+// ConditionReason returns the reason of the condition reporting err. The reason
+// is the type of the error if it has been classified, defaultReason otherwise.
+func ConditionReason(err error, defaultReason av1.LcmResourceConditionReason) av1.LcmResourceConditionReason {
+	var typed *TypedError
+	if errors.As(err, &typed) {
+		return av1.LcmResourceConditionReason(ErrorTypeOf(err))
+	}
+	return defaultReason
+}
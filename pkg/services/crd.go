@@ -0,0 +1,59 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+
+	"github.com/keleustes/oslc-operator/pkg/health"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefiningCRD returns the CustomResourceDefinition of the list defining the kind of u, if any
+func DefiningCRD(items []unstructured.Unstructured, u *unstructured.Unstructured) *unstructured.Unstructured {
+	gk := u.GroupVersionKind().GroupKind()
+	for i := range items {
+		crd := &items[i]
+		if crd.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		if group == gk.Group && kind == gk.Kind {
+			return crd
+		}
+	}
+	return nil
+}
+
+// IsCRDEstablished returns true once the CustomResourceDefinition is Established
+// and instances of it can be created.
+func IsCRDEstablished(ctx context.Context, c client.Client, crd *unstructured.Unstructured) (bool, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(crd.GroupVersionKind())
+	if err := c.Get(ctx, types.NamespacedName{Name: crd.GetName()}, live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return health.Check(live).IsReady(), nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SubResourceDrift describes a sub resource whose live version does not
+// match its rendered version.
+type SubResourceDrift struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Reason    string
+}
+
+// String returns a printable version of the drift
+func (d SubResourceDrift) String() string {
+	return fmt.Sprintf("%s %s/%s: %s", d.Kind, d.Namespace, d.Name, d.Reason)
+}
+
+// ComputeHash returns the hash of the rendered version of a sub resource.
+// Only the fields provided by the rendering are taken into account: the
+// annotation containing the hash itself as well as the fields populated
+// by the API server are ignored.
+func ComputeHash(rendered *unstructured.Unstructured) (string, error) {
+	// encoding/json sorts the keys of the maps, which makes the
+	// serialization, and hence the hash, deterministic.
+	data, err := json.Marshal(withoutServerFields(rendered).Object)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// withoutServerFields returns a copy of the object without the annotation
+// containing the hash and without the fields populated by the API server.
+func withoutServerFields(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	u := obj.DeepCopy()
+
+	annotations := u.GetAnnotations()
+	if annotations != nil {
+		delete(annotations, LastAppliedHashAnnotation)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		u.SetAnnotations(annotations)
+	}
+
+	u.SetResourceVersion("")
+	u.SetUID("")
+	u.SetGeneration(0)
+	u.SetSelfLink("")
+	u.SetManagedFields(nil)
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u
+}
+
+// SetLastAppliedHash stamps the rendered version of a sub resource with
+// its hash before it gets applied.
+func SetLastAppliedHash(rendered *unstructured.Unstructured) error {
+	hash, err := ComputeHash(rendered)
+	if err != nil {
+		return err
+	}
+
+	annotations := rendered.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedHashAnnotation] = hash
+	rendered.SetAnnotations(annotations)
+	return nil
+}
+
+// DetectDrift compares the rendered version of a sub resource with its
+// live version. It returns nil if the live version is in sync.
+func DetectDrift(rendered *unstructured.Unstructured, deployed *unstructured.Unstructured) *SubResourceDrift {
+	drift := &SubResourceDrift{
+		Kind:      rendered.GetKind(),
+		Namespace: rendered.GetNamespace(),
+		Name:      rendered.GetName(),
+	}
+
+	if deployed == nil {
+		drift.Reason = "not deployed"
+		return drift
+	}
+
+	expected, err := ComputeHash(rendered)
+	if err != nil {
+		drift.Reason = fmt.Sprintf("can not compute hash: %s", err)
+		return drift
+	}
+
+	actual, found := deployed.GetAnnotations()[LastAppliedHashAnnotation]
+	if !found {
+		drift.Reason = "never applied by the operator"
+		return drift
+	}
+
+	if actual != expected {
+		drift.Reason = "rendered content changed"
+		return drift
+	}
+
+	return nil
+}
+
+// DetectDrifts compares a list of rendered sub resources with their live
+// versions and returns the ones which have drifted.
+func DetectDrifts(rendered []unstructured.Unstructured, deployed []unstructured.Unstructured) []SubResourceDrift {
+	drifts := make([]SubResourceDrift, 0)
+
+	for i := range rendered {
+		live := FindResource(deployed, &rendered[i])
+		if drift := DetectDrift(&rendered[i], live); drift != nil {
+			drifts = append(drifts, *drift)
+		}
+	}
+
+	return drifts
+}
+
+// OrphanDrifts reports the sub resources which are not rendered anymore
+func OrphanDrifts(orphans []unstructured.Unstructured) []SubResourceDrift {
+	drifts := make([]SubResourceDrift, 0, len(orphans))
+	for _, orphan := range orphans {
+		drifts = append(drifts, SubResourceDrift{
+			Kind:      orphan.GetKind(),
+			Namespace: orphan.GetNamespace(),
+			Name:      orphan.GetName(),
+			Reason:    "not rendered anymore",
+		})
+	}
+	return drifts
+}
+
+// IsSameResource returns true if both objects have the same kind, namespace and name
+func IsSameResource(a *unstructured.Unstructured, b *unstructured.Unstructured) bool {
+	return a.GroupVersionKind().GroupKind() == b.GroupVersionKind().GroupKind() &&
+		a.GetNamespace() == b.GetNamespace() &&
+		a.GetName() == b.GetName()
+}
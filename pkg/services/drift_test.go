@@ -0,0 +1,145 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newObject returns an unstructured object out of its kind, name and extra fields
+func newObject(apiVersion string, kind string, namespace string, name string, fields map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	for k, v := range fields {
+		u.Object[k] = v
+	}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+func TestComputeHash(t *testing.T) {
+	base := newObject("v1", "ConfigMap", "openstack", "keystone", map[string]interface{}{
+		"data": map[string]interface{}{"a": "1", "b": "2"},
+	})
+
+	tests := []struct {
+		name   string
+		mutate func(u *unstructured.Unstructured)
+		same   bool
+	}{
+		{
+			name:   "identical",
+			mutate: func(u *unstructured.Unstructured) {},
+			same:   true,
+		},
+		{
+			name: "server fields",
+			mutate: func(u *unstructured.Unstructured) {
+				u.SetResourceVersion("42")
+				u.SetUID("1234")
+				u.SetGeneration(3)
+				u.Object["status"] = map[string]interface{}{"phase": "Active"}
+				_ = unstructured.SetNestedField(u.Object, "2019-01-01T00:00:00Z", "metadata", "creationTimestamp")
+			},
+			same: true,
+		},
+		{
+			name: "hash annotation",
+			mutate: func(u *unstructured.Unstructured) {
+				u.SetAnnotations(map[string]string{LastAppliedHashAnnotation: "abc"})
+			},
+			same: true,
+		},
+		{
+			name: "other annotation",
+			mutate: func(u *unstructured.Unstructured) {
+				u.SetAnnotations(map[string]string{"foo": "bar"})
+			},
+			same: false,
+		},
+		{
+			name: "data",
+			mutate: func(u *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(u.Object, "3", "data", "b")
+			},
+			same: false,
+		},
+	}
+
+	expected, err := ComputeHash(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := base.DeepCopy()
+			tt.mutate(u)
+			got, err := ComputeHash(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == expected) != tt.same {
+				t.Errorf("ComputeHash() = %s, base hash %s, want same %v", got, expected, tt.same)
+			}
+		})
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	rendered := newObject("v1", "ConfigMap", "openstack", "keystone", map[string]interface{}{
+		"data": map[string]interface{}{"a": "1"},
+	})
+	applied := rendered.DeepCopy()
+	if err := SetLastAppliedHash(applied); err != nil {
+		t.Fatal(err)
+	}
+	edited := applied.DeepCopy()
+	_ = unstructured.SetNestedField(edited.Object, "2", "data", "a")
+	changed := rendered.DeepCopy()
+	_ = unstructured.SetNestedField(changed.Object, "2", "data", "a")
+
+	tests := []struct {
+		name       string
+		rendered   *unstructured.Unstructured
+		deployed   *unstructured.Unstructured
+		wantReason string
+	}{
+		{"in sync", rendered, applied, ""},
+		{"not deployed", rendered, nil, "not deployed"},
+		{"never applied", rendered, rendered.DeepCopy(), "never applied by the operator"},
+		// Only the rendered content is compared, not the live content
+		{"edited live", rendered, edited, ""},
+		{"rendered changed", changed, applied, "rendered content changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drift := DetectDrift(tt.rendered, tt.deployed)
+			if tt.wantReason == "" {
+				if drift != nil {
+					t.Errorf("DetectDrift() = %v, want nil", drift)
+				}
+				return
+			}
+			if drift == nil || drift.Reason != tt.wantReason {
+				t.Errorf("DetectDrift() = %v, want reason %q", drift, tt.wantReason)
+			}
+		})
+	}
+}
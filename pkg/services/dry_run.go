@@ -0,0 +1,185 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PlanActionType is the action the operator would perform on a sub resource
+type PlanActionType string
+
+const (
+	PlanActionCreate PlanActionType = "create"
+	PlanActionUpdate PlanActionType = "update"
+	PlanActionDelete PlanActionType = "delete"
+	PlanActionNoop   PlanActionType = "no-op"
+)
+
+// PlanAction is one entry of the plan computed in dry run mode
+type PlanAction struct {
+	Action    PlanActionType `json:"action"`
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace,omitempty"`
+	Name      string         `json:"name"`
+
+	// Diff contains the paths of the fields an update modifies
+	Diff []string `json:"diff,omitempty"`
+}
+
+// String returns a printable version of the action
+func (a PlanAction) String() string {
+	name := a.Name
+	if a.Namespace != "" {
+		name = a.Namespace + "/" + a.Name
+	}
+	if len(a.Diff) != 0 {
+		return fmt.Sprintf("%s %s %s (%s)", a.Action, a.Kind, name, strings.Join(a.Diff, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", a.Action, a.Kind, name)
+}
+
+// IsDryRun returns true if the DryRunAnnotation of an Oslc or Phase CR is set
+func IsDryRun(obj metav1.Object) bool {
+	return obj.GetAnnotations()[DryRunAnnotation] == "true"
+}
+
+// PlanResources computes the actions the next install or update would perform to go from
+// the deployed to the rendered sub resources. Every create, patch and delete is sent to
+// the API server in dry run mode, hence validated and defaulted, but nothing is persisted.
+// Unlike the install and update, all the sync waves are planned at once.
+func PlanResources(ctx context.Context, c client.Client, rendered []unstructured.Unstructured,
+	deployed []unstructured.Unstructured, retainKinds []string, sorter KindSorter) ([]PlanAction, error) {
+
+	plan := make([]PlanAction, 0)
+	errs := make([]error, 0)
+
+	for _, wave := range SplitSyncWaves(rendered, sorter) {
+		for i := range wave.Items {
+			desired := wave.Items[i].DeepCopy()
+			action := PlanAction{Kind: desired.GetKind(), Namespace: desired.GetNamespace(), Name: desired.GetName()}
+
+			existing := FindResource(deployed, desired)
+			switch {
+			case existing == nil:
+				action.Action = PlanActionCreate
+				// The instances of a CRD which does not exist yet can not be validated
+				if crd := DefiningCRD(rendered, desired); crd != nil && FindResource(deployed, crd) == nil {
+					break
+				}
+				err := SetLastAppliedHash(desired)
+				if err == nil {
+					err = c.Create(ctx, desired, client.DryRunAll)
+				}
+				if err != nil {
+					errs = append(errs, NewResourceError(OperationCreate, desired, err))
+					continue
+				}
+			case DetectDrift(desired, existing) == nil:
+				action.Action = PlanActionNoop
+			default:
+				action.Action = PlanActionUpdate
+				if err := ApplyResource(ctx, c, desired, client.DryRunAll); err != nil {
+					errs = append(errs, NewResourceError(OperationApply, desired, err))
+					continue
+				}
+				action.Diff = DiffSummary(existing, desired)
+			}
+			plan = append(plan, action)
+		}
+	}
+
+	for _, orphan := range sorter.SortByUninstallOrder(FindOrphans(rendered, deployed)) {
+		action := PlanAction{Kind: orphan.GetKind(), Namespace: orphan.GetNamespace(), Name: orphan.GetName()}
+		if IsRetained(&orphan, retainKinds) {
+			action.Action = PlanActionNoop
+			plan = append(plan, action)
+			continue
+		}
+
+		action.Action = PlanActionDelete
+		if err := c.Delete(ctx, &orphan, client.DryRunAll); err != nil {
+			errs = append(errs, NewResourceError(OperationPrune, &orphan, err))
+			continue
+		}
+		plan = append(plan, action)
+	}
+
+	return plan, NewMultiError(errs)
+}
+
+// DiffSummary returns the paths of the fields which differ between the live version
+// of a sub resource and its desired version. The fields populated by the API server
+// are ignored.
+func DiffSummary(live *unstructured.Unstructured, desired *unstructured.Unstructured) []string {
+	paths := make([]string, 0)
+	diffFields("", withoutServerFields(live).Object, withoutServerFields(desired).Object, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+// diffFields appends to paths the paths of the fields which differ between a and b
+func diffFields(prefix string, a map[string]interface{}, b map[string]interface{}, paths *[]string) {
+	keys := map[string]struct{}{}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+
+	for k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		aMap, aIsMap := a[k].(map[string]interface{})
+		bMap, bIsMap := b[k].(map[string]interface{})
+		if aIsMap && bIsMap {
+			diffFields(path, aMap, bMap, paths)
+		} else if !reflect.DeepEqual(a[k], b[k]) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+// PlanSummary counts the actions of the plan by type
+func PlanSummary(plan []PlanAction) string {
+	counts := map[PlanActionType]int{}
+	for _, action := range plan {
+		counts[action.Action]++
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to delete, %d unchanged",
+		counts[PlanActionCreate], counts[PlanActionUpdate], counts[PlanActionDelete], counts[PlanActionNoop])
+}
+
+// FormatPlan returns a printable version of the plan, one action per line
+func FormatPlan(plan []PlanAction) string {
+	lines := make([]string, 0, len(plan)+1)
+	lines = append(lines, PlanSummary(plan))
+	for _, action := range plan {
+		lines = append(lines, action.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// recordedWrite is a write sent to a writeRecorder
+type recordedWrite struct {
+	verb   string
+	kind   string
+	name   string
+	dryRun []string
+}
+
+// writeRecorder records the writes sent to the client
+type writeRecorder struct {
+	client.Client
+	writes []recordedWrite
+}
+
+func (c *writeRecorder) record(verb string, obj client.Object, dryRun []string) {
+	c.writes = append(c.writes, recordedWrite{
+		verb:   verb,
+		kind:   obj.GetObjectKind().GroupVersionKind().Kind,
+		name:   obj.GetName(),
+		dryRun: dryRun,
+	})
+}
+
+func (c *writeRecorder) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.record("create", obj, (&client.CreateOptions{}).ApplyOptions(opts).DryRun)
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *writeRecorder) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.record("update", obj, (&client.UpdateOptions{}).ApplyOptions(opts).DryRun)
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *writeRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.record("patch", obj, (&client.PatchOptions{}).ApplyOptions(opts).DryRun)
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *writeRecorder) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.record("delete", obj, (&client.DeleteOptions{}).ApplyOptions(opts).DryRun)
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *writeRecorder) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	c.record("deleteallof", obj, (&client.DeleteAllOfOptions{}).ApplyOptions(opts).DryRun)
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+// applied returns the deployed version of u, as last applied by the operator
+func applied(t *testing.T, u *unstructured.Unstructured) *unstructured.Unstructured {
+	deployed := u.DeepCopy()
+	if err := SetLastAppliedHash(deployed); err != nil {
+		t.Fatalf("SetLastAppliedHash() error = %v", err)
+	}
+	return deployed
+}
+
+func TestPlanResources(t *testing.T) {
+	data := func(values map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"data": values}
+	}
+	unchanged := newObject("v1", "ConfigMap", "openstack", "keystone-bin", data(map[string]interface{}{"a": "1"}))
+	before := newObject("v1", "ConfigMap", "openstack", "keystone-etc", data(map[string]interface{}{"a": "1", "b": "2"}))
+	after := newObject("v1", "ConfigMap", "openstack", "keystone-etc", data(map[string]interface{}{"a": "1", "b": "3", "c": "4"}))
+	created := newObject("v1", "Service", "openstack", "keystone-api", nil)
+	pruned := newObject("v1", "Secret", "openstack", "keystone-fernet", nil)
+	retained := newObject("v1", "PersistentVolumeClaim", "openstack", "keystone-data", nil)
+
+	deployed := []unstructured.Unstructured{*applied(t, unchanged), *applied(t, before), *applied(t, pruned), *applied(t, retained)}
+	rendered := []unstructured.Unstructured{*unchanged, *after, *created}
+
+	objects := make([]client.Object, 0, len(deployed))
+	for i := range deployed {
+		objects = append(objects, deployed[i].DeepCopy())
+	}
+	c := &writeRecorder{Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objects...).Build()}
+
+	plan, err := PlanResources(context.TODO(), c, rendered, deployed, []string{"PersistentVolumeClaim"}, DefaultKindSorter)
+	if err != nil {
+		t.Fatalf("PlanResources() error = %v", err)
+	}
+
+	want := []PlanAction{
+		{Action: PlanActionNoop, Kind: "ConfigMap", Namespace: "openstack", Name: "keystone-bin"},
+		{Action: PlanActionUpdate, Kind: "ConfigMap", Namespace: "openstack", Name: "keystone-etc",
+			Diff: []string{"data.b", "data.c"}},
+		{Action: PlanActionCreate, Kind: "Service", Namespace: "openstack", Name: "keystone-api"},
+		{Action: PlanActionNoop, Kind: "PersistentVolumeClaim", Namespace: "openstack", Name: "keystone-data"},
+		{Action: PlanActionDelete, Kind: "Secret", Namespace: "openstack", Name: "keystone-fernet"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("PlanResources() =\n%s\nwant\n%s", FormatPlan(plan), FormatPlan(want))
+	}
+	if got, wantSummary := PlanSummary(plan), "1 to create, 1 to update, 1 to delete, 2 unchanged"; got != wantSummary {
+		t.Errorf("PlanSummary() = %q, want %q", got, wantSummary)
+	}
+
+	// Every write is sent in dry run mode
+	wantWrites := map[string]string{"keystone-etc": "patch", "keystone-api": "create", "keystone-fernet": "delete"}
+	if len(c.writes) != len(wantWrites) {
+		t.Errorf("PlanResources() sent %d writes, want %d: %v", len(c.writes), len(wantWrites), c.writes)
+	}
+	for _, w := range c.writes {
+		if verb := wantWrites[w.name]; verb != w.verb {
+			t.Errorf("PlanResources() sent %s %s %s, want %q", w.verb, w.kind, w.name, verb)
+		}
+		if !reflect.DeepEqual(w.dryRun, []string{metav1.DryRunAll}) {
+			t.Errorf("%s %s %s was not sent in dry run mode: %v", w.verb, w.kind, w.name, w.dryRun)
+		}
+	}
+
+	// Nothing has been persisted
+	for _, u := range deployed {
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(u.GroupVersionKind())
+		if err := c.Get(context.TODO(), client.ObjectKeyFromObject(&u), live); err != nil {
+			t.Errorf("%s %s has been deleted: %v", u.GetKind(), u.GetName(), err)
+			continue
+		}
+		if DetectDrift(&u, live) != nil {
+			t.Errorf("%s %s has been modified", u.GetKind(), u.GetName())
+		}
+	}
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(created.GroupVersionKind())
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(created), live); err == nil {
+		t.Errorf("%s %s has been created", created.GetKind(), created.GetName())
+	}
+}
+
+func TestPlanResourcesNoop(t *testing.T) {
+	configMap := newObject("v1", "ConfigMap", "openstack", "keystone-etc", map[string]interface{}{
+		"data": map[string]interface{}{"a": "1"},
+	})
+	deployed := []unstructured.Unstructured{*applied(t, configMap)}
+	c := &writeRecorder{Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(deployed[0].DeepCopy()).Build()}
+
+	plan, err := PlanResources(context.TODO(), c, []unstructured.Unstructured{*configMap}, deployed, nil, DefaultKindSorter)
+	if err != nil {
+		t.Fatalf("PlanResources() error = %v", err)
+	}
+	if len(plan) != 1 || plan[0].Action != PlanActionNoop {
+		t.Errorf("PlanResources() = %v, want a single no-op", plan)
+	}
+	if len(c.writes) != 0 {
+		t.Errorf("PlanResources() sent writes %v", c.writes)
+	}
+}
+
+func TestDiffSummary(t *testing.T) {
+	live := newObject("apps/v1", "Deployment", "openstack", "keystone-api", map[string]interface{}{
+		"spec":   map[string]interface{}{"replicas": int64(1), "paused": false},
+		"status": map[string]interface{}{"readyReplicas": int64(1)},
+	})
+	live.SetResourceVersion("42")
+	desired := newObject("apps/v1", "Deployment", "openstack", "keystone-api", map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": int64(3), "paused": false, "minReadySeconds": int64(5)},
+	})
+
+	want := []string{"spec.minReadySeconds", "spec.replicas"}
+	if got := DiffSummary(live, desired); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffSummary() = %v, want %v", got, want)
+	}
+	if got := DiffSummary(live, live); len(got) != 0 {
+		t.Errorf("DiffSummary() of identical objects = %v", got)
+	}
+}
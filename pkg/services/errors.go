@@ -16,15 +16,143 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ErrorType classifies the errors of the operator. It drives the condition
+// reason set on the CR and how the reconcile is retried.
+type ErrorType string
+
+const (
+	// ErrorTypeRender indicates that the chart or file of the CR can not be rendered
+	ErrorTypeRender ErrorType = "RenderError"
+
+	// ErrorTypeTransient indicates a failure of the API server which may succeed later
+	ErrorTypeTransient ErrorType = "TransientError"
+
+	// ErrorTypeConflict indicates that a sub resource has been modified concurrently
+	ErrorTypeConflict ErrorType = "Conflict"
+
+	// ErrorTypeForbidden indicates that the operator is not allowed to handle a sub resource
+	ErrorTypeForbidden ErrorType = "Forbidden"
+
+	// ErrorTypeInvalidManifest indicates that the API server rejected a rendered sub resource
+	ErrorTypeInvalidManifest ErrorType = "InvalidManifest"
+
+	// ErrorTypeOwnership indicates that a sub resource is not owned by the CR
+	ErrorTypeOwnership ErrorType = "OwnershipMismatch"
 )
 
+// TypedError is an error classified by its ErrorType.
+type TypedError struct {
+	Type ErrorType
+	Err  error
+}
+
+// NewTypedError returns err classified as errType
+func NewTypedError(errType ErrorType, err error) *TypedError {
+	return &TypedError{Type: errType, Err: err}
+}
+
+func (e *TypedError) Error() string {
+	if e.Err == nil {
+		return string(e.Type)
+	}
+	return e.Err.Error()
+}
+
+func (e *TypedError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows errors.Is(err, ErrConflict) to match any error of the Conflict type
+func (e *TypedError) Is(target error) bool {
+	t, ok := target.(*TypedError)
+	return ok && t.Err == nil && t.Type == e.Type
+}
+
+// Sentinels matching, using errors.Is, all the errors of a type
+var (
+	ErrRender            = &TypedError{Type: ErrorTypeRender}
+	ErrTransient         = &TypedError{Type: ErrorTypeTransient}
+	ErrConflict          = &TypedError{Type: ErrorTypeConflict}
+	ErrForbidden         = &TypedError{Type: ErrorTypeForbidden}
+	ErrInvalidManifest   = &TypedError{Type: ErrorTypeInvalidManifest}
+	ErrOwnershipMismatch = &TypedError{Type: ErrorTypeOwnership}
+)
+
+// errorTypeRanks orders the error types from the most to the least retriable
+var errorTypeRanks = map[ErrorType]int{
+	ErrorTypeTransient:       0,
+	ErrorTypeConflict:        1,
+	ErrorTypeForbidden:       2,
+	ErrorTypeOwnership:       3,
+	ErrorTypeInvalidManifest: 4,
+	ErrorTypeRender:          5,
+}
+
+// ErrorTypeOf returns the type of err. The errors which have not been classified
+// are classified out of the API server status they contain, if any. The other
+// ones are considered transient. The type of an error aggregating several errors,
+// as a MultiError, is the most retriable of their types, so that the reconcile is
+// retried as long as one of them may succeed later.
+func ErrorTypeOf(err error) ErrorType {
+	switch e := err.(type) {
+	case *TypedError:
+		return e.Type
+	case interface{ Unwrap() []error }:
+		errType := ErrorType("")
+		for _, inner := range e.Unwrap() {
+			innerType := ErrorTypeOf(inner)
+			if errType == "" || errorTypeRanks[innerType] < errorTypeRanks[errType] {
+				errType = innerType
+			}
+		}
+		if errType != "" {
+			return errType
+		}
+	case interface{ Unwrap() error }:
+		if inner := e.Unwrap(); inner != nil {
+			return ErrorTypeOf(inner)
+		}
+	}
+
+	switch {
+	case apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err):
+		return ErrorTypeConflict
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		return ErrorTypeForbidden
+	case apierrors.IsInvalid(err) || apierrors.IsBadRequest(err):
+		return ErrorTypeInvalidManifest
+	default:
+		return ErrorTypeTransient
+	}
+}
+
+// ClassifyError wraps err into a TypedError if it is not classified yet
+func ClassifyError(err error) error {
+	var typed *TypedError
+	if err == nil || errors.As(err, &typed) {
+		return err
+	}
+	return NewTypedError(ErrorTypeOf(err), err)
+}
+
 var (
 	// ErrNotFound indicates the release was not found.
 	ErrNotFound = errors.New("Resource not found")
 
 	// OwnershipMismatch indicates that one of the subresources does
 	// not have the right ownership.
-	OwnershipMismatch = errors.New("Ownership Mismatch")
+	OwnershipMismatch = NewTypedError(ErrorTypeOwnership, errors.New("Ownership Mismatch"))
 
 	// Error detected during SyncResource
 	SyncError = errors.New("Sync Error")
@@ -41,3 +169,135 @@ var (
 	// Error detected during ReconcileResource
 	ReconcileError = errors.New("Reconcile Error")
 )
+
+// Operations on a sub resource reported by a ResourceError
+const (
+	OperationGet    = "get"
+	OperationCreate = "create"
+	OperationApply  = "apply"
+	OperationAdopt  = "adopt"
+	OperationRetain = "retain"
+	OperationPrune  = "prune"
+	OperationDelete = "delete"
+)
+
+// ResourceError is the failure of an operation on a sub resource.
+type ResourceError struct {
+	GroupVersionKind schema.GroupVersionKind
+	Namespace        string
+	Name             string
+	Operation        string
+	Err              error
+}
+
+// NewResourceError returns the failure of the operation on the sub resource u
+func NewResourceError(operation string, u *unstructured.Unstructured, err error) *ResourceError {
+	return &ResourceError{
+		GroupVersionKind: u.GroupVersionKind(),
+		Namespace:        u.GetNamespace(),
+		Name:             u.GetName(),
+		Operation:        operation,
+		Err:              ClassifyError(err),
+	}
+}
+
+func (e *ResourceError) Error() string {
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + e.Name
+	}
+	return fmt.Sprintf("%s %s %s: %v", e.Operation, e.GroupVersionKind.Kind, name, e.Err)
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError aggregates the errors encountered while processing
+// all the sub resources of an Oslc or Phase CR.
+type MultiError struct {
+	Errors []error
+}
+
+// NewMultiError returns a MultiError containing errs, or nil if errs is empty.
+// The MultiErrors contained in errs are flattened.
+func NewMultiError(errs []error) error {
+	flattened := make([]error, 0, len(errs))
+	for _, err := range errs {
+		var multi *MultiError
+		if errors.As(err, &multi) {
+			flattened = append(flattened, multi.Errors...)
+		} else if err != nil {
+			flattened = append(flattened, err)
+		}
+	}
+	if len(flattened) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: flattened}
+}
+
+func (e *MultiError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap allows errors.Is and errors.As to look into all the aggregated errors
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// ResourceErrors returns the ResourceErrors contained in err, one per failed sub resource
+func ResourceErrors(err error) []*ResourceError {
+	resErrs := make([]*ResourceError, 0)
+	var multi *MultiError
+	if errors.As(err, &multi) {
+		for _, e := range multi.Errors {
+			resErrs = append(resErrs, ResourceErrors(e)...)
+		}
+		return resErrs
+	}
+	var resErr *ResourceError
+	if errors.As(err, &resErr) {
+		resErrs = append(resErrs, resErr)
+	}
+	return resErrs
+}
+
+// ForbiddenRetryPeriod is the delay before retrying a reconcile which failed with a
+// Forbidden error, when the controller has no reconcile period.
+const ForbiddenRetryPeriod = 5 * time.Minute
+
+// ReconcileResult returns the result of a reconcile which failed with err, according to its type:
+//
+//   - transient errors are returned, hence retried with an exponential backoff,
+//   - conflicts are retried immediately, reading the latest version of the objects,
+//   - forbidden errors are retried after the reconcile period, the RBAC being fixed out of band,
+//   - render, invalid manifest and ownership errors are not retried. The CR is reconciled
+//     again once it is modified.
+func ReconcileResult(err error, period time.Duration) (reconcile.Result, error) {
+	if err == nil {
+		return reconcile.Result{}, nil
+	}
+
+	switch ErrorTypeOf(err) {
+	case ErrorTypeConflict:
+		return reconcile.Result{Requeue: true}, nil
+	case ErrorTypeForbidden:
+		if period == 0 {
+			period = ForbiddenRetryPeriod
+		}
+		return reconcile.Result{RequeueAfter: period}, nil
+	case ErrorTypeRender, ErrorTypeInvalidManifest, ErrorTypeOwnership:
+		log.Info("Not retrying until the CR is modified", "error", err.Error())
+		return reconcile.Result{}, nil
+	default:
+		return reconcile.Result{}, err
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var testGroupResource = schema.GroupResource{Group: "apps", Resource: "deployments"}
+
+func TestErrorTypeOf(t *testing.T) {
+	conflict := apierrors.NewConflict(testGroupResource, "keystone", errors.New("modified"))
+	forbidden := apierrors.NewForbidden(testGroupResource, "keystone", errors.New("rbac"))
+	invalid := apierrors.NewBadRequest("invalid")
+	render := NewTypedError(ErrorTypeRender, errors.New("bad template"))
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorType
+	}{
+		{name: "typed", err: render, want: ErrorTypeRender},
+		{name: "wrapped typed", err: fmt.Errorf("rendering: %w", render), want: ErrorTypeRender},
+		{name: "conflict", err: conflict, want: ErrorTypeConflict},
+		{name: "already exists", err: apierrors.NewAlreadyExists(testGroupResource, "keystone"), want: ErrorTypeConflict},
+		{name: "forbidden", err: forbidden, want: ErrorTypeForbidden},
+		{name: "bad request", err: invalid, want: ErrorTypeInvalidManifest},
+		{name: "unclassified", err: errors.New("connection refused"), want: ErrorTypeTransient},
+		{name: "resource error", err: NewResourceError(OperationApply, newObject("apps/v1", "Deployment", "openstack", "keystone", nil), forbidden),
+			want: ErrorTypeForbidden},
+		{name: "multi error ranks transient first", err: NewMultiError([]error{render, errors.New("timeout"), conflict}),
+			want: ErrorTypeTransient},
+		{name: "multi error ranks conflict before forbidden", err: NewMultiError([]error{forbidden, invalid, conflict}),
+			want: ErrorTypeConflict},
+		{name: "multi error ranks forbidden before render", err: NewMultiError([]error{render, forbidden}),
+			want: ErrorTypeForbidden},
+		{name: "wrapped multi error", err: fmt.Errorf("install: %w", NewMultiError([]error{render, ErrTransient})),
+			want: ErrorTypeTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorTypeOf(tt.err); got != tt.want {
+				t.Errorf("ErrorTypeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileResult(t *testing.T) {
+	render := NewTypedError(ErrorTypeRender, errors.New("bad template"))
+	transient := errors.New("timeout")
+
+	tests := []struct {
+		name    string
+		err     error
+		period  time.Duration
+		want    reconcile.Result
+		wantErr bool
+	}{
+		{name: "no error", err: nil, want: reconcile.Result{}},
+		{name: "transient", err: transient, want: reconcile.Result{}, wantErr: true},
+		{name: "conflict", err: ErrConflict, want: reconcile.Result{Requeue: true}},
+		{name: "forbidden with period", err: ErrForbidden, period: time.Minute, want: reconcile.Result{RequeueAfter: time.Minute}},
+		{name: "forbidden without period", err: ErrForbidden, want: reconcile.Result{RequeueAfter: ForbiddenRetryPeriod}},
+		{name: "render", err: render, want: reconcile.Result{}},
+		{name: "render and transient", err: NewMultiError([]error{render, transient}), want: reconcile.Result{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReconcileResult(tt.err, tt.period)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReconcileResult() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReconcileResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionReason(t *testing.T) {
+	render := NewTypedError(ErrorTypeRender, errors.New("bad template"))
+	transient := NewTypedError(ErrorTypeTransient, errors.New("timeout"))
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "unclassified", err: errors.New("timeout"), want: "InstallError"},
+		{name: "typed", err: render, want: string(ErrorTypeRender)},
+		{name: "multi error", err: NewMultiError([]error{render, transient}), want: string(ErrorTypeTransient)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConditionReason(tt.err, "InstallError"); string(got) != tt.want {
+				t.Errorf("ConditionReason() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMultiError(t *testing.T) {
+	first := errors.New("first")
+	second := errors.New("second")
+	third := errors.New("third")
+
+	tests := []struct {
+		name    string
+		errs    []error
+		want    []error
+		wantMsg string
+	}{
+		{name: "empty", errs: nil, want: nil},
+		{name: "only nil errors", errs: []error{nil, nil}, want: nil},
+		{name: "single error", errs: []error{nil, first}, want: []error{first}, wantMsg: "first"},
+		{name: "several errors", errs: []error{first, second}, want: []error{first, second}, wantMsg: "2 errors: first; second"},
+		{name: "nested multi error is flattened", errs: []error{first, &MultiError{Errors: []error{second, third}}},
+			want: []error{first, second, third}, wantMsg: "3 errors: first; second; third"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewMultiError(tt.errs)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("NewMultiError() = %v, want nil", err)
+				}
+				return
+			}
+			multi, ok := err.(*MultiError)
+			if !ok {
+				t.Fatalf("NewMultiError() = %T, want *MultiError", err)
+			}
+			if len(multi.Errors) != len(tt.want) {
+				t.Fatalf("NewMultiError() has %d errors, want %d", len(multi.Errors), len(tt.want))
+			}
+			for i := range tt.want {
+				if multi.Errors[i] != tt.want[i] {
+					t.Errorf("NewMultiError().Errors[%d] = %v, want %v", i, multi.Errors[i], tt.want[i])
+				}
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("NewMultiError().Error() = %q, want %q", err.Error(), tt.wantMsg)
+			}
+			for _, e := range tt.want {
+				if !errors.Is(err, e) {
+					t.Errorf("errors.Is(NewMultiError(), %v) = false", e)
+				}
+			}
+		})
+	}
+}
+
+func TestResourceErrors(t *testing.T) {
+	deployment := newObject("apps/v1", "Deployment", "openstack", "keystone", nil)
+	service := newObject("v1", "Service", "openstack", "keystone-api", nil)
+	applyErr := NewResourceError(OperationApply, deployment, errors.New("timeout"))
+	deleteErr := NewResourceError(OperationDelete, service, ErrForbidden)
+
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{name: "nil", err: nil, want: []string{}},
+		{name: "unrelated error", err: errors.New("timeout"), want: []string{}},
+		{name: "resource error", err: applyErr, want: []string{"apply Deployment openstack/keystone: timeout"}},
+		{name: "multi error", err: NewMultiError([]error{applyErr, errors.New("render"), deleteErr}),
+			want: []string{"apply Deployment openstack/keystone: timeout", "delete Service openstack/keystone-api: Forbidden"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResourceErrors(tt.err)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ResourceErrors() returned %d errors, want %d", len(got), len(tt.want))
+			}
+			for i := range tt.want {
+				if got[i].Error() != tt.want[i] {
+					t.Errorf("ResourceErrors()[%d] = %q, want %q", i, got[i].Error(), tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FlowEngine defines what executes the flow of an Oslc CR
+type FlowEngine string
+
+const (
+	// FlowEngineArgo submits the Workflow rendered out of the flow chart to Argo
+	FlowEngineArgo FlowEngine = "argo"
+
+	// FlowEngineArgoTemplate submits the flow to Argo as a WorkflowTemplate and a Workflow
+	FlowEngineArgoTemplate FlowEngine = "argo-template"
+
+	// FlowEngineNative executes the steps of the rendered Workflow within the operator
+	FlowEngineNative FlowEngine = "native"
+)
+
+// FlowPollPeriod is the period at which a running flow is checked when
+// the reconcile period of the operator is longer or disabled.
+const FlowPollPeriod = 10 * time.Second
+
+// GetFlowEngine returns the flow engine of an Oslc CR. Defaults to argo, which
+// is also used when no FlowBackend is registered for the engine.
+func GetFlowEngine(obj metav1.Object) FlowEngine {
+	value, ok := obj.GetAnnotations()[FlowEngineAnnotation]
+	if !ok {
+		return FlowEngineArgo
+	}
+
+	if engine := FlowEngine(value); GetFlowBackend(engine) != nil {
+		return engine
+	}
+	log.Info("Invalid flow engine, using argo", "name", obj.GetName(), "engine", value)
+	return FlowEngineArgo
+}
+
+// IsFlowSuspended returns true if spec.suspend or the SuspendAnnotation holds the flow
+// of the Oslc CR
+func IsFlowSuspended(obj metav1.Object, extension OslcSpecExtension) bool {
+	return extension.Suspend || obj.GetAnnotations()[SuspendAnnotation] == "true"
+}
+
+// IsFlowResumeRequested returns true if the ResumeAnnotation releases the flow of the Oslc CR
+func IsFlowResumeRequested(obj metav1.Object) bool {
+	return obj.GetAnnotations()[ResumeAnnotation] == "true"
+}
+
+// IsFlowAbortRequested returns true if the AbortAnnotation terminates the flow of the Oslc CR
+func IsFlowAbortRequested(obj metav1.Object) bool {
+	return obj.GetAnnotations()[AbortAnnotation] == "true"
+}
+
+// FlowStepPhase is the progress of a step of a flow
+type FlowStepPhase string
+
+const (
+	FlowStepPending   FlowStepPhase = "Pending"
+	FlowStepRunning   FlowStepPhase = "Running"
+	FlowStepSucceeded FlowStepPhase = "Succeeded"
+	FlowStepFailed    FlowStepPhase = "Failed"
+	FlowStepSkipped   FlowStepPhase = "Skipped"
+)
+
+// IsCompleted returns true once the step will not progress anymore
+func (p FlowStepPhase) IsCompleted() bool {
+	return p == FlowStepSucceeded || p == FlowStepFailed || p == FlowStepSkipped
+}
+
+// FlowStep records the progress of a step of a flow
+type FlowStep struct {
+	Name  string        `json:"name"`
+	Phase FlowStepPhase `json:"phase"`
+
+	// Kind and ObjectName identify the object the step acts upon
+	Kind       string `json:"kind,omitempty"`
+	ObjectName string `json:"objectName,omitempty"`
+
+	Message    string            `json:"message,omitempty"`
+	Outputs    map[string]string `json:"outputs,omitempty"`
+	StartedAt  *metav1.Time      `json:"startedAt,omitempty"`
+	FinishedAt *metav1.Time      `json:"finishedAt,omitempty"`
+
+	// Retries counts the times the step has been retried after failing
+	Retries int `json:"retries,omitempty"`
+}
+
+// String returns a printable version of the step
+func (s FlowStep) String() string {
+	line := fmt.Sprintf("%s: %s", s.Name, s.Phase)
+	if s.Message != "" {
+		line += " (" + s.Message + ")"
+	}
+	if s.StartedAt != nil {
+		line += " started " + s.StartedAt.UTC().Format(time.RFC3339)
+	}
+	if s.FinishedAt != nil {
+		line += " finished " + s.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	if s.Retries != 0 {
+		line += fmt.Sprintf(" retries %d", s.Retries)
+	}
+	return line
+}
+
+// FlowStatus is the progress of the flow of an Oslc CR. Steps may be empty
+// when the backend does not report the progress of each step.
+type FlowStatus struct {
+	Phase FlowStepPhase `json:"phase"`
+	Steps []FlowStep    `json:"steps"`
+
+	// Approvals are the approval gates of the flow
+	Approvals []Approval `json:"approvals,omitempty"`
+
+	// Suspended is true while the native engine holds the steps which have not started
+	Suspended bool `json:"suspended,omitempty"`
+}
+
+// Step returns the step with the name, nil if not found
+func (f *FlowStatus) Step(name string) *FlowStep {
+	for i := range f.Steps {
+		if f.Steps[i].Name == name {
+			return &f.Steps[i]
+		}
+	}
+	return nil
+}
+
+// CurrentPhase returns the lifecycle phase the flow is in, based on the kind of the
+// Phase CR of the last step which started. Empty if no step acting on a Phase CR started.
+func (f *FlowStatus) CurrentPhase() av1.OslcPhase {
+	var current av1.OslcPhase
+	for _, step := range f.Steps {
+		if step.StartedAt == nil || !strings.HasSuffix(step.Kind, "Phase") {
+			continue
+		}
+		current = av1.OslcPhase(strings.ToLower(strings.TrimSuffix(step.Kind, "Phase")))
+	}
+	return current
+}
+
+// FailedStep returns the first step which failed, nil if none failed
+func (f *FlowStatus) FailedStep() *FlowStep {
+	for i := range f.Steps {
+		if f.Steps[i].Phase == FlowStepFailed {
+			return &f.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Summary counts the steps of the flow by phase and names the steps running
+func (f *FlowStatus) Summary() string {
+	if len(f.Steps) == 0 {
+		return "flow " + strings.ToLower(string(f.Phase))
+	}
+	counts := map[FlowStepPhase]int{}
+	running := make([]string, 0)
+	for _, step := range f.Steps {
+		counts[step.Phase]++
+		if step.Phase == FlowStepRunning {
+			running = append(running, step.Name)
+		}
+	}
+	summary := fmt.Sprintf("%d/%d steps succeeded, %d running, %d failed, %d skipped",
+		counts[FlowStepSucceeded], len(f.Steps), counts[FlowStepRunning], counts[FlowStepFailed], counts[FlowStepSkipped])
+	if len(running) != 0 {
+		summary += ", current: " + strings.Join(running, ",")
+	}
+	return summary
+}
+
+// PendingApprovals returns the number of approval gates which have not been granted
+func (f *FlowStatus) PendingApprovals() int {
+	pending := 0
+	for _, approval := range f.Approvals {
+		if !approval.Granted {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Format returns a printable version of the progress of the flow, one step per line
+func (f *FlowStatus) Format() string {
+	lines := make([]string, 0, len(f.Steps)+1)
+	lines = append(lines, f.Summary())
+	for _, step := range f.Steps {
+		lines = append(lines, step.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FlowRequeuePeriod returns the period after which the reconcile of an Oslc CR
+// whose flow is still running has to be performed again.
+func FlowRequeuePeriod(flow *FlowStatus, period time.Duration) time.Duration {
+	if flow == nil || flow.Phase.IsCompleted() {
+		return period
+	}
+	if period == 0 || period > FlowPollPeriod {
+		return FlowPollPeriod
+	}
+	return period
+}
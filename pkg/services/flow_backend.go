@@ -0,0 +1,179 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FlowBackend executes the main flow of an Oslc CR, the flow which creates and
+// waits for its Phase CRs. A backend is selected by the FlowEngineAnnotation
+// of the Oslc and registered using RegisterFlowBackend.
+type FlowBackend interface {
+	// Engine returns the value of the FlowEngineAnnotation selecting the backend
+	Engine() FlowEngine
+
+	// Handles returns true if the rendered or deployed object belongs to the flow,
+	// in which case it is not handled as a regular sub resource.
+	Handles(u *unstructured.Unstructured) bool
+
+	// Render builds the objects executing the flow out of the rendered objects it handles
+	Render(run *FlowRun, rendered []unstructured.Unstructured) ([]unstructured.Unstructured, error)
+
+	// Submit creates or updates the objects executing the flow, or makes it progress
+	Submit(ctx context.Context, run *FlowRun) error
+
+	// Status returns the progress of the flow, nil if it has not been submitted yet
+	Status(ctx context.Context, run *FlowRun) (*FlowStatus, error)
+
+	// Suspend holds the steps of the flow which have not started yet, or releases them
+	Suspend(ctx context.Context, run *FlowRun, suspend bool) error
+
+	// Cancel stops the steps of the flow which are running
+	Cancel(ctx context.Context, run *FlowRun) error
+
+	// Cleanup deletes the objects executing the flow
+	Cleanup(ctx context.Context, run *FlowRun) error
+}
+
+// FlowRun contains what a FlowBackend needs to execute the flow of an Oslc CR
+type FlowRun struct {
+	Client    client.Client
+	Owners    []metav1.OwnerReference
+	Name      string
+	Namespace string
+
+	// Record identifies the run of the flow the objects belong to
+	Record *FlowRunRecord
+
+	// Objects are the objects executing the flow, as returned by Render
+	Objects []unstructured.Unstructured
+
+	// Inventory records the objects created for the flow and the progress of the flow
+	Inventory *Inventory
+
+	// Touched receives the objects the flow acts upon during Submit, so that they are watched
+	Touched []unstructured.Unstructured
+
+	// Status is the progress of the flow returned by the last Status
+	Status *FlowStatus
+}
+
+var (
+	flowBackendsLock sync.RWMutex
+	flowBackends     = map[FlowEngine]FlowBackend{
+		FlowEngineArgo:         argoWorkflowBackend{},
+		FlowEngineArgoTemplate: argoWorkflowTemplateBackend{},
+	}
+)
+
+// RegisterFlowBackend adds or replaces the backend of an engine
+func RegisterFlowBackend(backend FlowBackend) {
+	flowBackendsLock.Lock()
+	defer flowBackendsLock.Unlock()
+	flowBackends[backend.Engine()] = backend
+}
+
+// GetFlowBackend returns the backend of an engine, nil if none is registered
+func GetFlowBackend(engine FlowEngine) FlowBackend {
+	flowBackendsLock.RLock()
+	defer flowBackendsLock.RUnlock()
+	return flowBackends[engine]
+}
+
+// SubmitFlowObjects creates the objects executing the flow which do not exist yet and
+// applies the ones which drifted. The objects of the inventory which belong to the flow
+// but are not rendered anymore are deleted.
+func SubmitFlowObjects(ctx context.Context, run *FlowRun, backend FlowBackend) error {
+	errs := make([]error, 0)
+	for i := range run.Objects {
+		desired := run.Objects[i].DeepCopy()
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(desired.GroupVersionKind())
+		err := run.Client.Get(ctx, types.NamespacedName{Namespace: desired.GetNamespace(), Name: desired.GetName()}, live)
+		switch {
+		case apierrors.IsNotFound(err):
+			if err := SetLastAppliedHash(desired); err != nil {
+				errs = append(errs, NewResourceError(OperationCreate, desired, err))
+				continue
+			}
+			if err := run.Client.Create(ctx, desired); err != nil {
+				errs = append(errs, NewResourceError(OperationCreate, desired, err))
+				continue
+			}
+			log.Info("Submitted flow", "kind", desired.GetKind(), "name", desired.GetName())
+			live = desired
+		case err != nil:
+			errs = append(errs, NewResourceError(OperationGet, desired, err))
+			continue
+		case DetectDrift(desired, live) != nil:
+			if err := ApplyResource(ctx, run.Client, desired); err != nil {
+				errs = append(errs, NewResourceError(OperationApply, desired, err))
+				continue
+			}
+			live = desired
+		}
+		run.Inventory.Add(live)
+		run.Touched = append(run.Touched, *live)
+	}
+
+	for _, deployed := range run.Inventory.Objects() {
+		if !backend.Handles(&deployed) || FindResource(run.Objects, &deployed) != nil {
+			continue
+		}
+		if err := deleteFlowObject(ctx, run, &deployed); err != nil {
+			errs = append(errs, NewResourceError(OperationPrune, &deployed, err))
+		}
+	}
+	return NewMultiError(errs)
+}
+
+// CleanupFlowObjects deletes the objects of the inventory which belong to the flow
+func CleanupFlowObjects(ctx context.Context, run *FlowRun, backend FlowBackend) error {
+	errs := make([]error, 0)
+	for _, deployed := range run.Inventory.Objects() {
+		if !backend.Handles(&deployed) {
+			continue
+		}
+		if err := deleteFlowObject(ctx, run, &deployed); err != nil {
+			errs = append(errs, NewResourceError(OperationDelete, &deployed, err))
+		}
+	}
+	return NewMultiError(errs)
+}
+
+// deleteFlowObject deletes an object of the inventory, unless it has been recreated by someone else
+func deleteFlowObject(ctx context.Context, run *FlowRun, u *unstructured.Unstructured) error {
+	opts := []client.DeleteOption{client.PropagationPolicy(metav1.DeletePropagationBackground)}
+	if uid := u.GetUID(); uid != "" {
+		opts = append(opts, client.Preconditions{UID: &uid})
+	}
+	err := run.Client.Delete(ctx, u, opts...)
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		return err
+	}
+	log.Info("Deleted flow", "kind", u.GetKind(), "name", u.GetName())
+	run.Inventory.Remove(u)
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxArchivedFlowRuns is the number of archived runs recorded in the inventory. The
+// objects of the older runs are deleted.
+const maxArchivedFlowRuns = 10
+
+// FlowRunRecord identifies a run of the flow of an Oslc CR. A new run starts each
+// time the flow kind or the target version of the Oslc CR changes.
+type FlowRunRecord struct {
+	Number        int          `json:"number"`
+	FlowKind      string       `json:"flowKind"`
+	TargetVersion string       `json:"targetVersion,omitempty"`
+	StartedAt     *metav1.Time `json:"startedAt,omitempty"`
+
+	// ArchivedAt, Phase and Summary record the outcome of the run once archived
+	ArchivedAt *metav1.Time  `json:"archivedAt,omitempty"`
+	Phase      FlowStepPhase `json:"phase,omitempty"`
+	Summary    string        `json:"summary,omitempty"`
+
+	// Objects are the objects which executed the run, kept once archived
+	Objects []InventoryEntry `json:"objects,omitempty"`
+}
+
+// Matches returns true if the run executes the flow kind for the target version
+func (r FlowRunRecord) Matches(flowKind string, targetVersion string) bool {
+	return r.FlowKind == flowKind && r.TargetVersion == targetVersion
+}
+
+// Suffix returns the suffix appended to the names of the objects executing the run
+func (r FlowRunRecord) Suffix() string {
+	return r.FlowKind + "-" + strconv.Itoa(r.Number)
+}
+
+// Apply makes the rendered object executing the flow part of the run,
+// by suffixing its name and labelling it.
+func (r FlowRunRecord) Apply(u *unstructured.Unstructured) {
+	u.SetName(u.GetName() + "-" + r.Suffix())
+	labels := u.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[FlowKindLabel] = r.FlowKind
+	labels[FlowRunLabel] = strconv.Itoa(r.Number)
+	u.SetLabels(labels)
+}
+
+// CurrentFlowRun returns the run which has not been archived, nil if none
+func (inv *Inventory) CurrentFlowRun() *FlowRunRecord {
+	if len(inv.FlowRuns) == 0 || inv.FlowRuns[len(inv.FlowRuns)-1].ArchivedAt != nil {
+		return nil
+	}
+	return &inv.FlowRuns[len(inv.FlowRuns)-1]
+}
+
+// NextFlowRun returns the current run if it executes the flow kind for the target
+// version, else a new run. The new run is only recorded by StartFlowRun.
+func NextFlowRun(inv *Inventory, flowKind string, targetVersion string) *FlowRunRecord {
+	number := 1
+	if inv != nil && len(inv.FlowRuns) != 0 {
+		if current := inv.CurrentFlowRun(); current != nil && current.Matches(flowKind, targetVersion) {
+			return current
+		}
+		number = inv.FlowRuns[len(inv.FlowRuns)-1].Number + 1
+	}
+	return &FlowRunRecord{Number: number, FlowKind: flowKind, TargetVersion: targetVersion}
+}
+
+// StartFlowRun records the run of the flow in the inventory if it is a new one. The
+// previous run is archived first: it is cancelled if still running, its outcome is
+// recorded and its objects are forgotten by the inventory, hence kept.
+func StartFlowRun(ctx context.Context, run *FlowRun, backend FlowBackend) error {
+	inv := run.Inventory
+	current := inv.CurrentFlowRun()
+	if current != nil && current.Number == run.Record.Number {
+		return nil
+	}
+
+	previous := &FlowRun{
+		Client:    run.Client,
+		Owners:    run.Owners,
+		Name:      run.Name,
+		Namespace: run.Namespace,
+		Inventory: inv,
+	}
+	for _, deployed := range inv.Objects() {
+		if backend.Handles(&deployed) {
+			previous.Objects = append(previous.Objects, deployed)
+		}
+	}
+
+	if current != nil || len(previous.Objects) != 0 || inv.Flow != nil {
+		if current == nil {
+			// Objects executing the flow before the runs were recorded
+			inv.FlowRuns = append(inv.FlowRuns, FlowRunRecord{})
+			current = &inv.FlowRuns[len(inv.FlowRuns)-1]
+		}
+
+		status, err := backend.Status(ctx, previous)
+		if err != nil {
+			return err
+		}
+		if status != nil && !status.Phase.IsCompleted() {
+			if err := backend.Cancel(ctx, previous); err != nil {
+				return err
+			}
+			status, _ = backend.Status(ctx, previous)
+		}
+
+		now := metav1.Now()
+		current.ArchivedAt = &now
+		if status != nil {
+			current.Phase = status.Phase
+			current.Summary = status.Summary()
+		}
+		current.Objects = make([]InventoryEntry, 0, len(previous.Objects))
+		for i := range previous.Objects {
+			current.Objects = append(current.Objects, NewInventoryEntry(&previous.Objects[i]))
+			inv.Remove(&previous.Objects[i])
+		}
+		inv.Flow = nil
+		log.Info("Archived flow run", "name", run.Name, "run", current.Suffix(), "phase", current.Phase)
+	}
+
+	now := metav1.Now()
+	run.Record.StartedAt = &now
+	inv.FlowRuns = append(inv.FlowRuns, *run.Record)
+	inv.FlowRuns = pruneFlowRuns(ctx, run.Client, inv.FlowRuns)
+	run.Record = &inv.FlowRuns[len(inv.FlowRuns)-1]
+	log.Info("Started flow run", "name", run.Name, "run", run.Record.Suffix())
+	return nil
+}
+
+// pruneFlowRuns deletes the objects of the archived runs beyond maxArchivedFlowRuns and
+// returns the runs which are still recorded. The objects are deleted in the background,
+// hence the Phase CRs they own are garbage collected. A run whose objects could not be
+// deleted stays recorded, so that its deletion is retried when the next run starts.
+func pruneFlowRuns(ctx context.Context, c client.Client, runs []FlowRunRecord) []FlowRunRecord {
+	if len(runs) <= maxArchivedFlowRuns+1 {
+		return runs
+	}
+
+	dropped := len(runs) - maxArchivedFlowRuns - 1
+	kept := make([]FlowRunRecord, 0, len(runs))
+	for _, record := range runs[:dropped] {
+		errs := make([]error, 0)
+		for _, entry := range record.Objects {
+			obj := entry.ToUnstructured()
+			opts := []client.DeleteOption{client.PropagationPolicy(metav1.DeletePropagationBackground)}
+			if entry.UID != "" {
+				opts = append(opts, client.Preconditions{UID: &entry.UID})
+			}
+			if err := c.Delete(ctx, obj, opts...); err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				errs = append(errs, NewResourceError(OperationPrune, obj, err))
+			}
+		}
+		if err := NewMultiError(errs); err != nil {
+			log.Error(err, "Failed to delete flow run", "run", record.Suffix())
+			kept = append(kept, record)
+			continue
+		}
+		log.Info("Deleted flow run", "run", record.Suffix())
+	}
+	return append(kept, runs[dropped:]...)
+}
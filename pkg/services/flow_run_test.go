@@ -0,0 +1,122 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPruneFlowRuns(t *testing.T) {
+	objects := make([]client.Object, 0)
+	runs := make([]FlowRunRecord, 0)
+	for i := 1; i <= maxArchivedFlowRuns+3; i++ {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openstack", Name: fmt.Sprintf("keystone-upgrade-%d", i)}}
+		objects = append(objects, cm)
+		runs = append(runs, FlowRunRecord{
+			Number:   i,
+			FlowKind: "upgrade",
+			Objects:  []InventoryEntry{{Version: "v1", Kind: "ConfigMap", Namespace: "openstack", Name: cm.Name}},
+		})
+	}
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objects...).Build()
+
+	kept := pruneFlowRuns(context.TODO(), c, runs)
+	if len(kept) != maxArchivedFlowRuns+1 || kept[0].Number != 3 {
+		t.Fatalf("pruneFlowRuns() kept %d runs starting at %d, want %d starting at 3", len(kept), kept[0].Number, maxArchivedFlowRuns+1)
+	}
+
+	for i, run := range runs {
+		err := c.Get(context.TODO(), client.ObjectKey{Namespace: "openstack", Name: run.Objects[0].Name}, &corev1.ConfigMap{})
+		if deleted := apierrors.IsNotFound(err); deleted != (i < 2) {
+			t.Errorf("pruneFlowRuns() deleted the objects of run %d = %v, want %v", run.Number, deleted, i < 2)
+		}
+	}
+
+	if got := pruneFlowRuns(context.TODO(), c, kept); !reflect.DeepEqual(got, kept) {
+		t.Errorf("pruneFlowRuns() pruned the runs within the limit")
+	}
+}
+
+func TestStartFlowRunSameKind(t *testing.T) {
+	ctx := context.TODO()
+	backend := argoWorkflowBackend{}
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	inventory := NewInventory("openstack", []metav1.OwnerReference{newOwnerRef("keystone", "uid-keystone")})
+
+	// submit starts the run of the upgrade to the target version and submits its Workflow
+	submit := func(targetVersion string) *FlowRun {
+		run := newFlowRun(c)
+		run.Inventory = inventory
+		run.Record = NextFlowRun(inventory, "upgrade", targetVersion)
+		if err := StartFlowRun(ctx, run, backend); err != nil {
+			t.Fatalf("StartFlowRun() error = %v", err)
+		}
+		workflow := newWorkflow(argoWorkflowKind, "keystone-upgrade")
+		run.Record.Apply(workflow)
+		run.Objects = []unstructured.Unstructured{*workflow}
+		if err := backend.Submit(ctx, run); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		return run
+	}
+
+	first := submit("rocky")
+	if again := NextFlowRun(inventory, "upgrade", "rocky"); again.Number != first.Record.Number {
+		t.Errorf("NextFlowRun() of the same target version = run %d, want %d", again.Number, first.Record.Number)
+	}
+	second := submit("stein")
+
+	if first.Record.Suffix() != "upgrade-1" || second.Record.Suffix() != "upgrade-2" {
+		t.Errorf("Suffix() = %q and %q, want upgrade-1 and upgrade-2", first.Record.Suffix(), second.Record.Suffix())
+	}
+
+	// The first run is archived, cancelled, and its Workflow kept
+	if len(inventory.FlowRuns) != 2 || inventory.FlowRuns[0].ArchivedAt == nil || inventory.CurrentFlowRun().Number != 2 {
+		t.Fatalf("FlowRuns = %v, want run 1 archived and run 2 current", inventory.FlowRuns)
+	}
+	archived := inventory.FlowRuns[0]
+	if len(archived.Objects) != 1 || archived.Objects[0].Name != "keystone-upgrade-upgrade-1" {
+		t.Errorf("archived run objects = %v, want keystone-upgrade-upgrade-1", archived.Objects)
+	}
+	for _, u := range inventory.Objects() {
+		if u.GetName() == "keystone-upgrade-upgrade-1" {
+			t.Errorf("the Workflow of the archived run is still in the inventory")
+		}
+	}
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(first.Objects[0].GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKeyFromObject(&first.Objects[0]), live); err != nil {
+		t.Fatalf("the Workflow of the archived run has been deleted: %v", err)
+	}
+	if shutdown, _, _ := unstructured.NestedString(live.Object, "spec", "shutdown"); shutdown != "Terminate" {
+		t.Errorf("the Workflow of the archived run has not been cancelled")
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(&second.Objects[0]), live); err != nil {
+		t.Errorf("the Workflow of the second run has not been submitted: %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// inventoryDataKey is the key of the ConfigMap data containing the inventory
+	inventoryDataKey = "inventory"
+
+	// completedWaveDataKey is the key of the ConfigMap data containing the sync wave progress
+	completedWaveDataKey = "completedWave"
+
+	// flowDataKey is the key of the ConfigMap data containing the progress of the flow
+	flowDataKey = "flow"
+
+	// flowRunsDataKey is the key of the ConfigMap data containing the runs of the flow
+	flowRunsDataKey = "flowRuns"
+
+	// inventorySuffix is appended to the name of the owner to build the name of the ConfigMap
+	inventorySuffix = "inventory"
+)
+
+// InventoryEntry identifies a sub resource applied by the operator
+type InventoryEntry struct {
+	Group     string    `json:"group"`
+	Version   string    `json:"version"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+
+	// Adopted records when an already existing object has been adopted
+	Adopted *metav1.Time `json:"adopted,omitempty"`
+}
+
+// NewInventoryEntry returns the inventory entry of an object
+func NewInventoryEntry(u *unstructured.Unstructured) InventoryEntry {
+	gvk := u.GroupVersionKind()
+	return InventoryEntry{
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Kind:      gvk.Kind,
+		Namespace: u.GetNamespace(),
+		Name:      u.GetName(),
+		UID:       u.GetUID(),
+	}
+}
+
+// GroupVersionKind returns the GVK of the entry
+func (e InventoryEntry) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: e.Group, Version: e.Version, Kind: e.Kind}
+}
+
+// Matches returns true if the entry identifies the object. The UID is not compared.
+func (e InventoryEntry) Matches(u *unstructured.Unstructured) bool {
+	return e.Group == u.GroupVersionKind().Group &&
+		e.Kind == u.GetKind() &&
+		e.Namespace == u.GetNamespace() &&
+		e.Name == u.GetName()
+}
+
+// ToUnstructured returns an object containing only the identity of the entry
+func (e InventoryEntry) ToUnstructured() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(e.GroupVersionKind())
+	u.SetNamespace(e.Namespace)
+	u.SetName(e.Name)
+	u.SetUID(e.UID)
+	return u
+}
+
+// Inventory is the list of the sub resources applied on behalf of an
+// owner (Oslc or Phase). It is persisted in a companion ConfigMap owned
+// by the owner, which allows the operator to find its sub resources
+// again even if they are not rendered anymore.
+type Inventory struct {
+	Namespace string
+	Name      string
+	Entries   []InventoryEntry
+
+	// CompletedWave is the highest sync wave which has been applied and
+	// found healthy, nil if none has completed yet.
+	CompletedWave *int
+
+	// Flow is the progress of the flow executed by the native engine,
+	// nil if no flow has been started.
+	Flow *FlowStatus
+
+	// FlowRuns are the runs of the flow, the last one being the current one
+	// unless it has been archived.
+	FlowRuns []FlowRunRecord
+
+	owners []metav1.OwnerReference
+	exists bool
+}
+
+// InventoryName returns the name of the ConfigMap containing the inventory of the owner
+func InventoryName(owner metav1.OwnerReference) string {
+	return strings.ToLower(owner.Kind) + "-" + owner.Name + "-" + inventorySuffix
+}
+
+// NewInventory returns an empty inventory for the owners
+func NewInventory(namespace string, owners []metav1.OwnerReference) *Inventory {
+	inv := &Inventory{
+		Namespace: namespace,
+		Entries:   make([]InventoryEntry, 0),
+		owners:    owners,
+	}
+	if len(owners) != 0 {
+		inv.Name = InventoryName(owners[0])
+	}
+	return inv
+}
+
+// LoadInventory reads the inventory of the owners. An empty inventory is returned
+// if the ConfigMap does not exist yet or can not be read.
+func LoadInventory(ctx context.Context, c client.Client, namespace string, owners []metav1.OwnerReference) (*Inventory, error) {
+	inv := NewInventory(namespace, owners)
+
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: inv.Namespace, Name: inv.Name}, cm)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return inv, nil
+		}
+		return inv, err
+	}
+
+	inv.exists = true
+	if data, ok := cm.Data[inventoryDataKey]; ok && data != "" {
+		if err := json.Unmarshal([]byte(data), &inv.Entries); err != nil {
+			return inv, err
+		}
+	}
+	if data, ok := cm.Data[completedWaveDataKey]; ok {
+		wave, err := strconv.Atoi(data)
+		if err != nil {
+			return inv, err
+		}
+		inv.CompletedWave = &wave
+	}
+	if data, ok := cm.Data[flowDataKey]; ok && data != "" {
+		inv.Flow = &FlowStatus{}
+		if err := json.Unmarshal([]byte(data), inv.Flow); err != nil {
+			return inv, err
+		}
+	}
+	if data, ok := cm.Data[flowRunsDataKey]; ok && data != "" {
+		if err := json.Unmarshal([]byte(data), &inv.FlowRuns); err != nil {
+			return inv, err
+		}
+	}
+	return inv, nil
+}
+
+// Exists returns true if the inventory has already been saved
+func (inv *Inventory) Exists() bool {
+	return inv.exists
+}
+
+// Add records an applied object in the inventory, or refreshes its UID
+func (inv *Inventory) Add(u *unstructured.Unstructured) {
+	entry := NewInventoryEntry(u)
+	for i := range inv.Entries {
+		if inv.Entries[i].Matches(u) {
+			if inv.Entries[i].UID == entry.UID {
+				entry.Adopted = inv.Entries[i].Adopted
+			}
+			inv.Entries[i] = entry
+			return
+		}
+	}
+	inv.Entries = append(inv.Entries, entry)
+}
+
+// MarkAdopted records an adopted object in the inventory
+func (inv *Inventory) MarkAdopted(u *unstructured.Unstructured) {
+	inv.Add(u)
+	now := metav1.Now()
+	for i := range inv.Entries {
+		if inv.Entries[i].Matches(u) {
+			inv.Entries[i].Adopted = &now
+		}
+	}
+}
+
+// Remove forgets a deleted object
+func (inv *Inventory) Remove(u *unstructured.Unstructured) {
+	entries := make([]InventoryEntry, 0, len(inv.Entries))
+	for _, entry := range inv.Entries {
+		if !entry.Matches(u) {
+			entries = append(entries, entry)
+		}
+	}
+	inv.Entries = entries
+}
+
+// Objects returns an object containing only the identity of each entry
+func (inv *Inventory) Objects() []unstructured.Unstructured {
+	objects := make([]unstructured.Unstructured, 0, len(inv.Entries))
+	for _, entry := range inv.Entries {
+		objects = append(objects, *entry.ToUnstructured())
+	}
+	return objects
+}
+
+// Save creates or updates the ConfigMap containing the inventory
+func (inv *Inventory) Save(ctx context.Context, c client.Client) error {
+	sort.SliceStable(inv.Entries, func(i, j int) bool {
+		a, b := inv.Entries[i], inv.Entries[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	entries, err := json.Marshal(inv.Entries)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{inventoryDataKey: string(entries)}
+	if inv.CompletedWave != nil {
+		data[completedWaveDataKey] = strconv.Itoa(*inv.CompletedWave)
+	}
+	if inv.Flow != nil {
+		flow, err := json.Marshal(inv.Flow)
+		if err != nil {
+			return err
+		}
+		data[flowDataKey] = string(flow)
+	}
+	if len(inv.FlowRuns) != 0 {
+		runs, err := json.Marshal(inv.FlowRuns)
+		if err != nil {
+			return err
+		}
+		data[flowRunsDataKey] = string(runs)
+	}
+
+	cm := &corev1.ConfigMap{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: inv.Namespace, Name: inv.Name}, cm)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       inv.Namespace,
+				Name:            inv.Name,
+				OwnerReferences: inv.owners,
+			},
+			Data: data,
+		}
+		if err := c.Create(ctx, cm); err != nil {
+			return err
+		}
+		inv.exists = true
+		return nil
+	}
+
+	if reflect.DeepEqual(cm.Data, data) {
+		return nil
+	}
+	cm.Data = data
+	return c.Update(ctx, cm)
+}
+
+// Delete removes the ConfigMap containing the inventory
+func (inv *Inventory) Delete(ctx context.Context, c client.Client) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: inv.Namespace,
+			Name:      inv.Name,
+		},
+	}
+	if err := c.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	inv.exists = false
+	inv.Entries = make([]InventoryEntry, 0)
+	inv.CompletedWave = nil
+	inv.Flow = nil
+	inv.FlowRuns = nil
+	return nil
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package services
 
 import (
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"io/ioutil"
 	"sort"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // SortOrder is an ordering of Kinds.
@@ -55,12 +58,44 @@ var InstallOrder SortOrder = []string{
 	"CronJob",
 	"Ingress",
 	"APIService",
+	"Issuer",
+	"ClusterIssuer",
+	"Certificate",
+	"ServiceMonitor",
+	"PrometheusRule",
+	"WorkflowTemplate",
+	"PlanningPhase",
+	"InstallPhase",
+	"TestPhase",
+	"TrafficRolloutPhase",
+	"OperationalPhase",
+	"TrafficDrainPhase",
+	"UpgradePhase",
+	"RollbackPhase",
+	"DeletePhase",
+	"Workflow",
 }
 
 // UninstallOrder is the order in which manifests should be uninstalled (by Kind).
 //
 // Those occurring earlier in the list get uninstalled before those occurring later in the list.
 var UninstallOrder SortOrder = []string{
+	"Workflow",
+	"DeletePhase",
+	"RollbackPhase",
+	"UpgradePhase",
+	"TrafficDrainPhase",
+	"OperationalPhase",
+	"TrafficRolloutPhase",
+	"TestPhase",
+	"InstallPhase",
+	"PlanningPhase",
+	"WorkflowTemplate",
+	"PrometheusRule",
+	"ServiceMonitor",
+	"Certificate",
+	"ClusterIssuer",
+	"Issuer",
 	"APIService",
 	"Ingress",
 	"Service",
@@ -90,6 +125,51 @@ var UninstallOrder SortOrder = []string{
 	"Namespace",
 }
 
+// KindSorter sorts the manifests by kind, following an install and an uninstall order.
+// It is read from the operator configuration file by LoadSortOrderConfig. An empty
+// order is replaced by the one of the DefaultKindSorter.
+type KindSorter struct {
+	InstallOrder   SortOrder `json:"installOrder,omitempty"`
+	UninstallOrder SortOrder `json:"uninstallOrder,omitempty"`
+}
+
+// DefaultKindSorter sorts the manifests following InstallOrder and UninstallOrder
+var DefaultKindSorter = KindSorter{InstallOrder: InstallOrder, UninstallOrder: UninstallOrder}
+
+// LoadSortOrderConfig reads the kind ordering from a yaml file and returns the
+// KindSorter using it. The orders missing from the file are the ones of the
+// DefaultKindSorter, except that if the file only provides the installOrder,
+// the uninstallOrder is the reverse of it.
+func LoadSortOrderConfig(fileName string) (KindSorter, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return DefaultKindSorter, err
+	}
+
+	config := KindSorter{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return DefaultKindSorter, err
+	}
+
+	sorter := DefaultKindSorter
+	if len(config.InstallOrder) != 0 {
+		sorter.InstallOrder = config.InstallOrder
+		if len(config.UninstallOrder) == 0 {
+			reversed := make(SortOrder, 0, len(config.InstallOrder))
+			for i := len(config.InstallOrder) - 1; i >= 0; i-- {
+				reversed = append(reversed, config.InstallOrder[i])
+			}
+			sorter.UninstallOrder = reversed
+		}
+	}
+	if len(config.UninstallOrder) != 0 {
+		sorter.UninstallOrder = config.UninstallOrder
+	}
+
+	log.Info("Loaded kind ordering", "installOrder", sorter.InstallOrder, "uninstallOrder", sorter.UninstallOrder)
+	return sorter, nil
+}
+
 // sortByKind does an in-place sort of manifests by Kind.
 //
 // Results are sorted by 'ordering'
@@ -120,16 +200,27 @@ func (k *kindSorter) Len() int { return len(k.manifests) }
 
 func (k *kindSorter) Swap(i, j int) { k.manifests[i], k.manifests[j] = k.manifests[j], k.manifests[i] }
 
+// sortKind returns the kind used to sort a manifest. The kind can be
+// overridden using the SortAsAnnotation.
+func sortKind(u *unstructured.Unstructured) string {
+	if kind, ok := u.GetAnnotations()[SortAsAnnotation]; ok && kind != "" {
+		return kind
+	}
+	return u.GetKind()
+}
+
 func (k *kindSorter) Less(i, j int) bool {
 	a := k.manifests[i]
 	b := k.manifests[j]
-	first, aok := k.ordering[a.GetKind()]
-	second, bok := k.ordering[b.GetKind()]
+	aKind := sortKind(&a)
+	bKind := sortKind(&b)
+	first, aok := k.ordering[aKind]
+	second, bok := k.ordering[bKind]
 
 	if !aok && !bok {
 		// if both are unknown then sort alphabetically by kind and name
-		if a.GetKind() != b.GetKind() {
-			return a.GetKind() < b.GetKind()
+		if aKind != bKind {
+			return aKind < bKind
 		}
 		return a.GetName() < b.GetName()
 	}
@@ -150,18 +241,18 @@ func (k *kindSorter) Less(i, j int) bool {
 	return first < second
 }
 
-// SortByInstallOrder sorts manifests in InstallOrder
-func SortByInstallOrder(manifests []unstructured.Unstructured) []unstructured.Unstructured {
-	ordering := InstallOrder
-	ks := newKindSorter(manifests, ordering)
-	sort.Sort(ks)
-	return ks.manifests
+// SortByInstallOrder sorts manifests in the install order of the sorter
+func (s KindSorter) SortByInstallOrder(manifests []unstructured.Unstructured) []unstructured.Unstructured {
+	if len(s.InstallOrder) == 0 {
+		return sortByKind(manifests, InstallOrder)
+	}
+	return sortByKind(manifests, s.InstallOrder)
 }
 
-// SortByUninstallOrder sorts manifests in UninstallOrder
-func SortByUninstallOrder(manifests []unstructured.Unstructured) []unstructured.Unstructured {
-	ordering := UninstallOrder
-	ks := newKindSorter(manifests, ordering)
-	sort.Sort(ks)
-	return ks.manifests
+// SortByUninstallOrder sorts manifests in the uninstall order of the sorter
+func (s KindSorter) SortByUninstallOrder(manifests []unstructured.Unstructured) []unstructured.Unstructured {
+	if len(s.UninstallOrder) == 0 {
+		return sortByKind(manifests, UninstallOrder)
+	}
+	return sortByKind(manifests, s.UninstallOrder)
 }
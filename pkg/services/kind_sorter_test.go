@@ -0,0 +1,150 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// sortedNames returns the kind/name of the manifests
+func sortedNames(manifests []unstructured.Unstructured) []string {
+	names := make([]string, 0, len(manifests))
+	for _, m := range manifests {
+		names = append(names, m.GetKind()+"/"+m.GetName())
+	}
+	return names
+}
+
+func TestKindSorter(t *testing.T) {
+	sortAs := newObject("v1", "Pod", "ns", "early", nil)
+	sortAs.SetAnnotations(map[string]string{SortAsAnnotation: "Namespace"})
+
+	manifests := []unstructured.Unstructured{
+		*newObject("apps/v1", "Deployment", "ns", "b", nil),
+		*newObject("example.com/v1", "Widget", "ns", "w", nil),
+		*newObject("apps/v1", "Deployment", "ns", "a", nil),
+		*newObject("v1", "ConfigMap", "ns", "c", nil),
+		*newObject("example.com/v1", "Gadget", "ns", "g", nil),
+		*sortAs,
+	}
+
+	custom := KindSorter{InstallOrder: SortOrder{"Deployment", "ConfigMap"}}
+
+	tests := []struct {
+		name string
+		sort func([]unstructured.Unstructured) []unstructured.Unstructured
+		want []string
+	}{
+		{
+			name: "install order",
+			sort: DefaultKindSorter.SortByInstallOrder,
+			want: []string{"Pod/early", "ConfigMap/c", "Deployment/a", "Deployment/b", "Gadget/g", "Widget/w"},
+		},
+		{
+			name: "uninstall order",
+			sort: DefaultKindSorter.SortByUninstallOrder,
+			want: []string{"Deployment/a", "Deployment/b", "ConfigMap/c", "Pod/early", "Gadget/g", "Widget/w"},
+		},
+		{
+			name: "zero value uses the default order",
+			sort: KindSorter{}.SortByInstallOrder,
+			want: []string{"Pod/early", "ConfigMap/c", "Deployment/a", "Deployment/b", "Gadget/g", "Widget/w"},
+		},
+		{
+			name: "custom install order",
+			sort: custom.SortByInstallOrder,
+			want: []string{"Deployment/a", "Deployment/b", "ConfigMap/c", "Gadget/g", "Pod/early", "Widget/w"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]unstructured.Unstructured, len(manifests))
+			copy(items, manifests)
+			if got := sortedNames(tt.sort(items)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sort = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSortOrderConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		wantErr       bool
+		wantInstall   SortOrder
+		wantUninstall SortOrder
+	}{
+		{
+			name:          "empty file",
+			content:       "",
+			wantInstall:   InstallOrder,
+			wantUninstall: UninstallOrder,
+		},
+		{
+			name:          "install order only",
+			content:       "installOrder: [Namespace, ConfigMap, Deployment]\n",
+			wantInstall:   SortOrder{"Namespace", "ConfigMap", "Deployment"},
+			wantUninstall: SortOrder{"Deployment", "ConfigMap", "Namespace"},
+		},
+		{
+			name:          "both orders",
+			content:       "installOrder: [Namespace, ConfigMap]\nuninstallOrder: [Namespace, ConfigMap]\n",
+			wantInstall:   SortOrder{"Namespace", "ConfigMap"},
+			wantUninstall: SortOrder{"Namespace", "ConfigMap"},
+		},
+		{
+			name:          "uninstall order only",
+			content:       "uninstallOrder: [ConfigMap]\n",
+			wantInstall:   InstallOrder,
+			wantUninstall: SortOrder{"ConfigMap"},
+		},
+		{
+			name:    "invalid yaml",
+			content: "installOrder: {",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "kind-order.yaml")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			sorter, err := LoadSortOrderConfig(fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadSortOrderConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(sorter.InstallOrder, tt.wantInstall) {
+				t.Errorf("LoadSortOrderConfig() installOrder = %v, want %v", sorter.InstallOrder, tt.wantInstall)
+			}
+			if !reflect.DeepEqual(sorter.UninstallOrder, tt.wantUninstall) {
+				t.Errorf("LoadSortOrderConfig() uninstallOrder = %v, want %v", sorter.UninstallOrder, tt.wantUninstall)
+			}
+		})
+	}
+
+	if _, err := LoadSortOrderConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("LoadSortOrderConfig() of a missing file returned no error")
+	}
+}
@@ -16,7 +16,9 @@ package services
 
 import (
 	"context"
+
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // Manager manages a Openstack Service . It can deploy, upgrade, backup, restore
@@ -24,6 +26,12 @@ type OslcManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	FlowStatus() *FlowStatus
+	SuspendFlow(context.Context, bool) error
+	AbortFlow(context.Context) error
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.LifecycleFlow, error)
 	UpdateResource(context.Context) (*av1.LifecycleFlow, *av1.LifecycleFlow, error)
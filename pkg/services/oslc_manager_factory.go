@@ -20,5 +20,5 @@ import (
 
 // ManagerFactory creates Managers that are specific to custom resources.
 type OslcManagerFactory interface {
-	NewOslcManager(r *av1.Oslc) OslcManager
+	NewOslcManager(r *av1.Oslc, extension OslcSpecExtension) OslcManager
 }
@@ -0,0 +1,123 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OslcSpecExtension contains the fields of the spec of an Oslc CR interpreted by the
+// operator on top of the ones of av1.OslcSpec. They are declared by the Oslc CRD of
+// the chart, hence preserved by the API server, and read out of the unstructured CR.
+type OslcSpecExtension struct {
+	// TargetVersion is the version of the service the Oslc CR deploys. A new run
+	// of the flow starts each time it changes.
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// RollbackTo requests the rollback of the Oslc CR to a revision of its history.
+	// The operator restores the spec of the revision and clears it.
+	RollbackTo *RollbackConfig `json:"rollbackTo,omitempty"`
+
+	// Suspend holds the flow of the Oslc CR while true, as the SuspendAnnotation does.
+	// Setting it back to false releases the flow.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// RollbackConfig contains the revision an Oslc CR is rolled back to
+type RollbackConfig struct {
+	// Revision is the number of the ControllerRevision to restore
+	Revision int64 `json:"revision"`
+}
+
+// GetOslc reads the Oslc CR from the cluster into instance and the extension of its spec
+// into extension
+func GetOslc(ctx context.Context, c client.Client, key client.ObjectKey, instance *av1.Oslc,
+	extension *OslcSpecExtension) error {
+	live, err := liveObject(c, instance)
+	if err != nil {
+		return err
+	}
+	if err := c.Get(ctx, key, live); err != nil {
+		return err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, instance); err != nil {
+		return err
+	}
+	return specExtensionOf(live, extension)
+}
+
+// specExtensionOf decodes the extension of the spec of the unstructured Oslc CR
+func specExtensionOf(u *unstructured.Unstructured, extension *OslcSpecExtension) error {
+	spec, _, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil {
+		return err
+	}
+	*extension = OslcSpecExtension{}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(spec, extension)
+}
+
+// OslcSpecWithExtension is the spec of an Oslc CR merged with its extension, as
+// stored in the cluster and recorded by the revisions of the CR
+type OslcSpecWithExtension struct {
+	av1.OslcSpec      `json:",inline"`
+	OslcSpecExtension `json:",inline"`
+}
+
+// UpdateOslc patches the labels, the annotations and the spec of the Oslc CR in the
+// cluster. The spec is merged with extension, or with the extension of the spec in
+// the cluster if nil, so that the fields unknown to av1.OslcSpec are not dropped.
+// The patch is retried on conflict.
+func UpdateOslc(ctx context.Context, c client.Client, instance *av1.Oslc, extension *OslcSpecExtension) error {
+	current, err := liveObject(c, instance)
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(instance), current); err != nil {
+			return err
+		}
+
+		desired := extension
+		if desired == nil {
+			desired = &OslcSpecExtension{}
+			if err := specExtensionOf(current, desired); err != nil {
+				return err
+			}
+		}
+		spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&OslcSpecWithExtension{instance.Spec, *desired})
+		if err != nil {
+			return err
+		}
+
+		patch := client.MergeFromWithOptions(current.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		current.SetLabels(instance.GetLabels())
+		current.SetAnnotations(instance.GetAnnotations())
+		current.Object["spec"] = spec
+		if err := c.Patch(ctx, current, patch); err != nil {
+			return err
+		}
+		instance.SetResourceVersion(current.GetResourceVersion())
+		instance.SetGeneration(current.GetGeneration())
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestOslcSpecWithExtension(t *testing.T) {
+	spec := OslcSpecWithExtension{
+		OslcSpec:          av1.OslcSpec{ServiceName: "keystone", FlowKind: "upgrade"},
+		OslcSpecExtension: OslcSpecExtension{TargetVersion: "rocky"},
+	}
+
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["serviceName"] != "keystone" || fields["targetVersion"] != "rocky" {
+		t.Errorf("ToUnstructured() = %v, want the spec and its extension inlined", fields)
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := OslcSpecWithExtension{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, spec) {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded, spec)
+	}
+}
@@ -16,7 +16,9 @@ package services
 
 import (
 	"context"
+
 	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // PlanningPhaseManager manages the PlanningPhase Phase of an OpenstackServiceLifeCycle
@@ -24,6 +26,9 @@ type PlanningPhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -36,6 +41,9 @@ type InstallPhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -48,6 +56,9 @@ type TestPhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -60,6 +71,9 @@ type TrafficRolloutPhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -72,6 +86,9 @@ type OperationalPhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -84,6 +101,9 @@ type TrafficDrainPhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -96,6 +116,9 @@ type UpgradePhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -108,6 +131,9 @@ type RollbackPhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
@@ -120,6 +146,9 @@ type DeletePhaseManager interface {
 	ResourceName() string
 	IsInstalled() bool
 	IsUpdateRequired() bool
+	AdoptedResources() []unstructured.Unstructured
+	PlanResource(context.Context) ([]PlanAction, error)
+	RecordRevision(context.Context) (*RevisionHistory, error)
 	SyncResource(context.Context) error
 	InstallResource(context.Context) (*av1.SubResourceList, error)
 	UpdateResource(context.Context) (*av1.SubResourceList, *av1.SubResourceList, error)
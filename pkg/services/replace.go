@@ -0,0 +1,244 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReplacePolicy defines what the operator does when the API server rejects the
+// update of a sub resource because it modifies immutable fields, for instance
+// the pod template of a Job or the selector of a StatefulSet.
+type ReplacePolicy string
+
+const (
+	// ReplacePolicyFail reports the rejected update as an InvalidManifest error
+	ReplacePolicyFail ReplacePolicy = "fail"
+
+	// ReplacePolicyReplaceOnChange deletes the live sub resource and creates it again
+	ReplacePolicyReplaceOnChange ReplacePolicy = "replace-on-change"
+
+	// ReplacePolicyIgnore keeps the immutable fields of the live sub resource, applies
+	// the change of the other fields and records the change as applied
+	ReplacePolicyIgnore ReplacePolicy = "ignore"
+)
+
+// GetReplacePolicy returns the replace policy of a rendered sub resource. Defaults to fail.
+func GetReplacePolicy(u *unstructured.Unstructured) ReplacePolicy {
+	value, ok := u.GetAnnotations()[ReplacePolicyAnnotation]
+	if !ok {
+		return ReplacePolicyFail
+	}
+
+	switch policy := ReplacePolicy(value); policy {
+	case ReplacePolicyFail, ReplacePolicyReplaceOnChange, ReplacePolicyIgnore:
+		return policy
+	default:
+		log.Info("Invalid replace policy, using fail", "kind", u.GetKind(), "name", u.GetName(), "policy", value)
+		return ReplacePolicyFail
+	}
+}
+
+// IsImmutableFieldError returns true if the API server rejected an update because
+// it modifies fields which can only be set at creation.
+func IsImmutableFieldError(err error) bool {
+	if !apierrors.IsInvalid(err) {
+		return false
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if isImmutableFieldMessage(cause.Message) {
+				return true
+			}
+		}
+	}
+	return isImmutableFieldMessage(err.Error())
+}
+
+// ImmutableFields returns the paths of the fields whose modification has been rejected
+// by the API server, as reported by the causes of an immutable field error. The list
+// indexes are dropped, hence a field of an item of a list is reported as the whole list.
+func ImmutableFields(err error) [][]string {
+	fields := make([][]string, 0)
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return fields
+	}
+
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Field == "" || !isImmutableFieldMessage(cause.Message) {
+			continue
+		}
+		path := make([]string, 0)
+		for _, name := range strings.Split(cause.Field, ".") {
+			if i := strings.Index(name, "["); i >= 0 {
+				if i > 0 {
+					path = append(path, name[:i])
+				}
+				break
+			}
+			path = append(path, name)
+		}
+		if len(path) != 0 {
+			fields = append(fields, path)
+		}
+	}
+	return fields
+}
+
+// isImmutableFieldMessage matches the messages of the validations of the API server
+// rejecting the modification of immutable fields, such as "field is immutable" or
+// "updates to statefulset spec for fields other than ... are forbidden".
+func isImmutableFieldMessage(message string) bool {
+	return strings.Contains(message, "field is immutable") ||
+		(strings.Contains(message, "updates to") && strings.Contains(message, "are forbidden"))
+}
+
+// ErrReplacePending is returned while the live version of a sub resource replaced
+// under the replace-on-change policy is being deleted. The replace is not done yet:
+// the sync wave waits for the deletion to complete and the rendered version is
+// created by a later reconcile.
+var ErrReplacePending = NewTypedError(ErrorTypeTransient, errors.New("waiting for the deletion of the replaced sub resource"))
+
+// ApplyOrReplace applies the rendered version of a sub resource. When the update of
+// the live version is rejected because it modifies immutable fields, the ReplacePolicy
+// of the rendered version decides what happens. It returns false if the change has been
+// ignored, in which case the live version is kept unmodified, and ErrReplacePending
+// while the live version is being replaced.
+func ApplyOrReplace(ctx context.Context, c client.Client, rendered *unstructured.Unstructured,
+	live *unstructured.Unstructured) (bool, error) {
+	if live != nil && live.GetDeletionTimestamp() != nil {
+		log.Info("Waiting for the deletion of sub resource", "kind", rendered.GetKind(), "name", rendered.GetName())
+		return false, ErrReplacePending
+	}
+
+	err := ApplyResource(ctx, c, rendered)
+	if err == nil || live == nil || !IsImmutableFieldError(err) {
+		return err == nil, err
+	}
+
+	switch GetReplacePolicy(rendered) {
+	case ReplacePolicyReplaceOnChange:
+		if err := ReplaceResource(ctx, c, rendered, live); err != nil {
+			return false, err
+		}
+		return true, nil
+	case ReplacePolicyIgnore:
+		return applyMutableFields(ctx, c, rendered, live, ImmutableFields(err))
+	default:
+		return false, err
+	}
+}
+
+// ReplaceResource deletes the live version of a sub resource using the foreground
+// propagation, so that the objects it owns (the Pods of a Job...) are deleted first,
+// then creates the rendered version once the deletion completed. It returns
+// ErrReplacePending while the deletion is in progress.
+func ReplaceResource(ctx context.Context, c client.Client, rendered *unstructured.Unstructured,
+	live *unstructured.Unstructured) error {
+	uid := live.GetUID()
+	err := c.Delete(ctx, live,
+		client.PropagationPolicy(metav1.DeletePropagationForeground),
+		client.Preconditions{UID: &uid})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	log.Info("Replacing sub resource", "kind", live.GetKind(), "namespace", live.GetNamespace(), "name", live.GetName())
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(live.GroupVersionKind())
+	err = c.Get(ctx, types.NamespacedName{Namespace: live.GetNamespace(), Name: live.GetName()}, current)
+	if err == nil {
+		log.Info("Waiting for the deletion of sub resource", "kind", live.GetKind(), "name", live.GetName())
+		return ErrReplacePending
+	}
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	return ApplyResource(ctx, c, rendered)
+}
+
+// applyMutableFields applies the rendered version of a sub resource whose immutable fields
+// are reset to their live value, then stamps the live version with the hash of the rendered
+// one. It returns false if the immutable fields are unknown or rejected again, in which case
+// the whole change is ignored.
+func applyMutableFields(ctx context.Context, c client.Client, rendered *unstructured.Unstructured,
+	live *unstructured.Unstructured, fields [][]string) (bool, error) {
+	if len(fields) != 0 {
+		mutable := rendered.DeepCopy()
+		for _, field := range fields {
+			value, found, err := unstructured.NestedFieldCopy(live.Object, field...)
+			if err != nil {
+				return false, err
+			}
+			if !found {
+				unstructured.RemoveNestedField(mutable.Object, field...)
+			} else if err := unstructured.SetNestedField(mutable.Object, value, field...); err != nil {
+				return false, err
+			}
+		}
+
+		// mutable keeps the hash of the rendered version, so that the ignored change of
+		// the immutable fields is not reported as a drift anymore.
+		err := applyPatch(ctx, c, mutable)
+		if err == nil {
+			log.Info("Ignoring the change of immutable fields", "kind", rendered.GetKind(), "name", rendered.GetName(),
+				"fields", fieldNames(fields))
+			return true, nil
+		}
+		if !IsImmutableFieldError(err) {
+			return false, err
+		}
+	}
+
+	log.Info("Ignoring the change of sub resource with immutable fields", "kind", rendered.GetKind(), "name", rendered.GetName())
+	return false, acceptChange(ctx, c, rendered, live)
+}
+
+// fieldNames joins the paths of the fields
+func fieldNames(fields [][]string) []string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, strings.Join(field, "."))
+	}
+	return names
+}
+
+// acceptChange stamps the live version of a sub resource with the hash of the rendered
+// version, so that the change of its immutable fields is not reported as a drift anymore.
+func acceptChange(ctx context.Context, c client.Client, rendered *unstructured.Unstructured,
+	live *unstructured.Unstructured) error {
+	before := live.DeepCopy()
+
+	annotations := live.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedHashAnnotation] = rendered.GetAnnotations()[LastAppliedHashAnnotation]
+	live.SetAnnotations(annotations)
+
+	return c.Patch(ctx, live, client.MergeFrom(before))
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newInvalid returns the error of the API server rejecting the update of a Job
+func newInvalid(errs ...*field.Error) error {
+	return apierrors.NewInvalid(schema.GroupKind{Group: "batch", Kind: "Job"}, "job", field.ErrorList(errs))
+}
+
+func TestGetReplacePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        ReplacePolicy
+	}{
+		{name: "no annotation", annotations: nil, want: ReplacePolicyFail},
+		{name: "fail", annotations: map[string]string{ReplacePolicyAnnotation: "fail"}, want: ReplacePolicyFail},
+		{name: "replace-on-change", annotations: map[string]string{ReplacePolicyAnnotation: "replace-on-change"}, want: ReplacePolicyReplaceOnChange},
+		{name: "ignore", annotations: map[string]string{ReplacePolicyAnnotation: "ignore"}, want: ReplacePolicyIgnore},
+		{name: "invalid", annotations: map[string]string{ReplacePolicyAnnotation: "recreate"}, want: ReplacePolicyFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newObject("batch/v1", "Job", "ns", "job", nil)
+			u.SetAnnotations(tt.annotations)
+			if got := GetReplacePolicy(u); got != tt.want {
+				t.Errorf("GetReplacePolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsImmutableFieldError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "immutable field",
+			err:  newInvalid(field.Invalid(field.NewPath("spec", "template"), nil, "field is immutable")),
+			want: true,
+		},
+		{
+			name: "forbidden statefulset update",
+			err: newInvalid(field.Forbidden(field.NewPath("spec"),
+				"updates to statefulset spec for fields other than 'replicas', 'template' and 'updateStrategy' are forbidden")),
+			want: true,
+		},
+		{
+			name: "other invalid field",
+			err:  newInvalid(field.Required(field.NewPath("spec", "template"), "")),
+			want: false,
+		},
+		{
+			name: "not invalid",
+			err:  apierrors.NewConflict(schema.GroupResource{Group: "batch", Resource: "jobs"}, "job", errors.New("field is immutable")),
+			want: false,
+		},
+		{
+			name: "not an api error",
+			err:  errors.New("field is immutable"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsImmutableFieldError(tt.err); got != tt.want {
+				t.Errorf("IsImmutableFieldError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImmutableFields(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want [][]string
+	}{
+		{
+			name: "immutable fields",
+			err: newInvalid(
+				field.Invalid(field.NewPath("spec", "template"), nil, "field is immutable"),
+				field.Invalid(field.NewPath("spec", "selector"), nil, "field is immutable")),
+			want: [][]string{{"spec", "template"}, {"spec", "selector"}},
+		},
+		{
+			name: "list index",
+			err:  newInvalid(field.Invalid(field.NewPath("spec", "volumeClaimTemplates").Index(0), nil, "field is immutable")),
+			want: [][]string{{"spec", "volumeClaimTemplates"}},
+		},
+		{
+			name: "other causes are skipped",
+			err: newInvalid(
+				field.Required(field.NewPath("spec", "replicas"), ""),
+				field.Invalid(field.NewPath("spec", "template"), nil, "field is immutable")),
+			want: [][]string{{"spec", "template"}},
+		},
+		{
+			name: "not an api error",
+			err:  errors.New("field is immutable"),
+			want: [][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ImmutableFields(tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ImmutableFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrReplaceDeleting(t *testing.T) {
+	now := metav1.Now()
+	live := newObject("batch/v1", "Job", "openstack", "keystone-db-sync", nil)
+	live.SetDeletionTimestamp(&now)
+	rendered := newObject("batch/v1", "Job", "openstack", "keystone-db-sync", nil)
+	c := &writeRecorder{Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()}
+
+	applied, err := ApplyOrReplace(context.TODO(), c, rendered, live)
+	if !errors.Is(err, ErrReplacePending) {
+		t.Fatalf("ApplyOrReplace() error = %v, want ErrReplacePending", err)
+	}
+	if applied {
+		t.Errorf("ApplyOrReplace() = true while the live version is being deleted")
+	}
+	if len(c.writes) != 0 {
+		t.Errorf("ApplyOrReplace() sent writes %v", c.writes)
+	}
+	if got := ErrorTypeOf(NewResourceError(OperationApply, rendered, err)); got != ErrorTypeTransient {
+		t.Errorf("ErrorTypeOf() = %v, want %v", got, ErrorTypeTransient)
+	}
+}
+
+func TestReplaceResourcePending(t *testing.T) {
+	// The finalizer of the Pods of the Job keeps it until they are deleted
+	live := newObject("batch/v1", "Job", "openstack", "keystone-db-sync", nil)
+	live.SetFinalizers([]string{metav1.FinalizerDeleteDependents})
+	rendered := newObject("batch/v1", "Job", "openstack", "keystone-db-sync", nil)
+	c := &writeRecorder{Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(live.DeepCopy()).Build()}
+
+	if err := ReplaceResource(context.TODO(), c, rendered, live); !errors.Is(err, ErrReplacePending) {
+		t.Fatalf("ReplaceResource() error = %v, want ErrReplacePending", err)
+	}
+	if len(c.writes) != 1 || c.writes[0].verb != "delete" {
+		t.Errorf("ReplaceResource() sent writes %v, want a single delete", c.writes)
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(live.GroupVersionKind())
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(live), current); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if current.GetDeletionTimestamp() == nil {
+		t.Errorf("the live version is not being deleted")
+	}
+}
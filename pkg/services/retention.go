@@ -0,0 +1,135 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResourcePolicyKeep is the value of the ResourcePolicyAnnotation preventing
+// the deletion of a sub resource.
+const ResourcePolicyKeep = "keep"
+
+// GetRetainKinds returns the kinds of sub resources an Oslc or Phase CR retains
+// when uninstalled, as listed in its RetainKindsAnnotation. An entry is either a
+// kind, or a kind and a label requirement separated by a colon, such as
+// Secret:openstacklcm.airshipit.org/database, to only retain the sub resources
+// of that kind matching the requirement.
+func GetRetainKinds(obj metav1.Object) []string {
+	kinds := make([]string, 0)
+	for _, kind := range strings.Split(obj.GetAnnotations()[RetainKindsAnnotation], ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// IsRetained returns true if the sub resource must not be deleted, either because
+// of its ResourcePolicyAnnotation or because its kind, and its labels when the
+// retained kind carries a label requirement, are retained.
+func IsRetained(u *unstructured.Unstructured, retainKinds []string) bool {
+	if u.GetAnnotations()[ResourcePolicyAnnotation] == ResourcePolicyKeep {
+		return true
+	}
+	for _, retainKind := range retainKinds {
+		kind, requirement, selected := strings.Cut(retainKind, ":")
+		if u.GetKind() != kind {
+			continue
+		}
+		if !selected {
+			return true
+		}
+		selector, err := labels.Parse(requirement)
+		if err != nil {
+			log.Info("Invalid retained kind, ignoring it", "kind", retainKind, "error", err.Error())
+			continue
+		}
+		if selector.Matches(labels.Set(u.GetLabels())) {
+			return true
+		}
+	}
+	return false
+}
+
+// Release strips the owner references of the owners, or the labels and annotations
+// tracking them, from a retained sub resource so that neither the Kubernetes garbage
+// collector nor the operator delete it with its owner.
+func Release(ctx context.Context, c client.Client, live *unstructured.Unstructured, owners []metav1.OwnerReference) error {
+	if !IsOwnedBy(live, owners) {
+		return nil
+	}
+
+	before := live.DeepCopy()
+
+	refs := make([]metav1.OwnerReference, 0)
+	for _, ref := range live.GetOwnerReferences() {
+		owned := false
+		for _, owner := range owners {
+			if ref.UID == owner.UID {
+				owned = true
+			}
+		}
+		if !owned {
+			refs = append(refs, ref)
+		}
+	}
+	live.SetOwnerReferences(refs)
+
+	if IsTracked(live) {
+		Untrack(live)
+	}
+
+	if err := c.Patch(ctx, live, client.MergeFrom(before)); err != nil {
+		return err
+	}
+
+	log.Info("Retained sub resource", "kind", live.GetKind(), "namespace", live.GetNamespace(), "name", live.GetName())
+	return nil
+}
+
+// RetainIfRequired releases the sub resource instead of deleting it when it is retained.
+// The live version of the sub resource is used, since the objects listed in the inventory
+// do not carry the annotations. It returns true if the sub resource has been retained.
+func RetainIfRequired(ctx context.Context, c client.Client, u *unstructured.Unstructured,
+	owners []metav1.OwnerReference, retainKinds []string) (bool, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(u.GroupVersionKind())
+	if err := c.Get(ctx, types.NamespacedName{Namespace: u.GetNamespace(), Name: u.GetName()}, live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// The object has been recreated by someone else
+	if uid := u.GetUID(); uid != "" && uid != live.GetUID() {
+		return false, nil
+	}
+
+	if !IsRetained(live, retainKinds) {
+		return false, nil
+	}
+	return true, Release(ctx, c, live, owners)
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetRetainKinds(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation *string
+		want       []string
+	}{
+		{name: "no annotation", annotation: nil, want: []string{}},
+		{name: "empty", annotation: stringPtr(""), want: []string{}},
+		{name: "kinds", annotation: stringPtr("PersistentVolumeClaim, Secret,"), want: []string{"PersistentVolumeClaim", "Secret"}},
+		{name: "label requirement", annotation: stringPtr("Secret:app=db"), want: []string{"Secret:app=db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newObject("openstacklcm.airshipit.org/v1alpha1", "DeletePhase", "openstack", "keystone", nil)
+			if tt.annotation != nil {
+				obj.SetAnnotations(map[string]string{RetainKindsAnnotation: *tt.annotation})
+			}
+			if got := GetRetainKinds(obj); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRetainKinds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetained(t *testing.T) {
+	withLabels := func(u *unstructured.Unstructured, labels map[string]string) *unstructured.Unstructured {
+		u.SetLabels(labels)
+		return u
+	}
+	kept := newObject("v1", "ConfigMap", "openstack", "config", nil)
+	kept.SetAnnotations(map[string]string{ResourcePolicyAnnotation: ResourcePolicyKeep})
+
+	tests := []struct {
+		name        string
+		u           *unstructured.Unstructured
+		retainKinds []string
+		want        bool
+	}{
+		{name: "resource policy", u: kept, retainKinds: nil, want: true},
+		{name: "kind not retained", u: newObject("v1", "ConfigMap", "openstack", "config", nil),
+			retainKinds: []string{"Secret"}, want: false},
+		{name: "kind retained", u: newObject("v1", "Secret", "openstack", "db", nil),
+			retainKinds: []string{"PersistentVolumeClaim", "Secret"}, want: true},
+		{name: "label present", u: withLabels(newObject("v1", "Secret", "openstack", "db", nil), map[string]string{DatabaseLabel: ""}),
+			retainKinds: []string{"Secret:" + DatabaseLabel}, want: true},
+		{name: "label missing", u: newObject("v1", "Secret", "openstack", "keystone-etc", nil),
+			retainKinds: []string{"Secret:" + DatabaseLabel}, want: false},
+		{name: "label on another kind", u: withLabels(newObject("v1", "ConfigMap", "openstack", "db", nil), map[string]string{DatabaseLabel: ""}),
+			retainKinds: []string{"Secret:" + DatabaseLabel}, want: false},
+		{name: "label value", u: withLabels(newObject("batch/v1", "Job", "openstack", "db-backup", nil), map[string]string{"app": "backup"}),
+			retainKinds: []string{"Job:app=backup"}, want: true},
+		{name: "other label value", u: withLabels(newObject("batch/v1", "Job", "openstack", "db-sync", nil), map[string]string{"app": "sync"}),
+			retainKinds: []string{"Job:app=backup"}, want: false},
+		{name: "invalid requirement", u: newObject("batch/v1", "Job", "openstack", "db-sync", nil),
+			retainKinds: []string{"Job:app=="}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetained(tt.u, tt.retainKinds); got != tt.want {
+				t.Errorf("IsRetained() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetainIfRequired(t *testing.T) {
+	owner := newOwnerRef("keystone", "uid-keystone")
+	other := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "uid-other"}
+
+	ownerRefOwned := func() *unstructured.Unstructured {
+		u := newObject("v1", "Secret", "openstack", "db", nil)
+		u.SetLabels(map[string]string{DatabaseLabel: ""})
+		u.SetOwnerReferences([]metav1.OwnerReference{other, owner})
+		return u
+	}
+	labelTracked := func() *unstructured.Unstructured {
+		u := newObject("v1", "Secret", "openstack", "db", nil)
+		u.SetLabels(map[string]string{DatabaseLabel: "", OwnerUIDLabel: string(owner.UID), OwnerKindLabel: owner.Kind})
+		u.SetAnnotations(map[string]string{OwnerNameAnnotation: owner.Name, OwnerNamespaceAnnotation: "openstack"})
+		return u
+	}
+
+	tests := []struct {
+		name        string
+		live        func() *unstructured.Unstructured
+		retainKinds []string
+		retained    bool
+	}{
+		{name: "owner reference", live: ownerRefOwned, retainKinds: []string{"Secret:" + DatabaseLabel}, retained: true},
+		{name: "tracked by labels", live: labelTracked, retainKinds: []string{"Secret:" + DatabaseLabel}, retained: true},
+		{name: "not retained", live: ownerRefOwned, retainKinds: []string{"PersistentVolumeClaim"}, retained: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(tt.live()).Build()
+
+			retained, err := RetainIfRequired(ctx, c, tt.live(), []metav1.OwnerReference{owner}, tt.retainKinds)
+			if err != nil {
+				t.Fatalf("RetainIfRequired() error = %v", err)
+			}
+			if retained != tt.retained {
+				t.Fatalf("RetainIfRequired() = %v, want %v", retained, tt.retained)
+			}
+
+			got := &unstructured.Unstructured{}
+			got.SetGroupVersionKind(tt.live().GroupVersionKind())
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "openstack", Name: "db"}, got); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if owned := IsOwnedBy(got, []metav1.OwnerReference{owner}); owned == tt.retained {
+				t.Errorf("IsOwnedBy() = %v after the retention", owned)
+			}
+			if !tt.retained {
+				return
+			}
+			if IsTracked(got) || len(OwnerRequest(got)) != 0 {
+				t.Errorf("retained object still tracks its owner: labels %v, annotations %v", got.GetLabels(), got.GetAnnotations())
+			}
+			if _, ok := got.GetLabels()[DatabaseLabel]; !ok {
+				t.Errorf("retained object lost its labels %v", got.GetLabels())
+			}
+			if refs := got.GetOwnerReferences(); len(tt.live().GetOwnerReferences()) != 0 &&
+				(len(refs) != 1 || refs[0].UID != other.UID) {
+				t.Errorf("owner references = %v, want only %s", refs, other.Name)
+			}
+		})
+	}
+}
+
+func TestRetainIfRequiredRecreated(t *testing.T) {
+	owner := newOwnerRef("keystone", "uid-keystone")
+	live := newObject("v1", "PersistentVolumeClaim", "openstack", "db", nil)
+	live.SetOwnerReferences([]metav1.OwnerReference{owner})
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(live).Build()
+
+	// The inventory refers to a previous object of the same name
+	deployed := live.DeepCopy()
+	deployed.SetUID("uid-previous")
+	retained, err := RetainIfRequired(context.TODO(), c, deployed, []metav1.OwnerReference{owner}, []string{"PersistentVolumeClaim"})
+	if err != nil || retained {
+		t.Errorf("RetainIfRequired() = %v, %v, want false, nil", retained, err)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,259 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// DefaultRevisionHistoryLimit is the number of previous revisions kept when
+// the revisionHistoryLimit of the CR is not set
+const DefaultRevisionHistoryLimit int32 = 10
+
+// revisionGVK is the GVK of the ControllerRevision CRD shipped with the operator
+var revisionGVK = schema.GroupVersionKind{Group: "openstacklcm.airshipit.org", Version: "v1alpha1", Kind: "ControllerRevision"}
+
+// annotationPrefix is the prefix of the annotations interpreted by the operator
+const annotationPrefix = "openstacklcm.airshipit.org/"
+
+// RevisionSnapshot is the state of an Oslc or Phase CR recorded by a ControllerRevision:
+// its spec, the annotations interpreted by the operator and the values its charts are
+// rendered with.
+type RevisionSnapshot struct {
+	Spec        interface{}            `json:"spec"`
+	Annotations map[string]string      `json:"annotations,omitempty"`
+	Values      map[string]interface{} `json:"values,omitempty"`
+}
+
+// NewRevisionSnapshot returns the snapshot of the CR. The values are copied, since
+// the renderers may complete them afterwards.
+func NewRevisionSnapshot(obj metav1.Object, spec interface{}, values map[string]interface{}) RevisionSnapshot {
+	snapshot := RevisionSnapshot{Spec: spec}
+	if raw, err := json.Marshal(values); err == nil {
+		_ = json.Unmarshal(raw, &snapshot.Values)
+	}
+	for key, value := range obj.GetAnnotations() {
+		if !isRecordedAnnotation(key) {
+			continue
+		}
+		if snapshot.Annotations == nil {
+			snapshot.Annotations = map[string]string{}
+		}
+		snapshot.Annotations[key] = value
+	}
+	return snapshot
+}
+
+// isRecordedAnnotation returns true if the annotation of a CR is recorded by its revisions.
+// The annotations requesting an operation of the operator are not.
+func isRecordedAnnotation(key string) bool {
+	switch key {
+	case DryRunAnnotation, RollbackToAnnotation, SuspendAnnotation, ResumeAnnotation, AbortAnnotation:
+		return false
+	}
+	return strings.HasPrefix(key, annotationPrefix)
+}
+
+// RevisionHistory contains the revision numbers of a CR
+type RevisionHistory struct {
+	// Current is the revision matching the current snapshot of the CR
+	Current int64
+
+	// Previous is the revision before the current one, 0 if none
+	Previous int64
+
+	// Created is true when the current revision has just been recorded
+	Created bool
+}
+
+// String returns a printable version of the revision numbers
+func (h RevisionHistory) String() string {
+	if h.Previous == 0 {
+		return fmt.Sprintf("current revision %d", h.Current)
+	}
+	return fmt.Sprintf("current revision %d, previous revision %d", h.Current, h.Previous)
+}
+
+// GetRevisionHistoryLimit returns the number of previous revisions to keep. Defaults to 10.
+func GetRevisionHistoryLimit(limit *int32) int32 {
+	if limit == nil || *limit < 0 {
+		return DefaultRevisionHistoryLimit
+	}
+	return *limit
+}
+
+// RevisionName returns the name of the ControllerRevision of the owner recording a snapshot
+func RevisionName(owner metav1.OwnerReference, hash string) string {
+	return strings.ToLower(owner.Kind) + "-" + owner.Name + "-" + hash[:10]
+}
+
+// ListRevisions returns the ControllerRevisions of the Oslc or Phase CR obj ordered by
+// revision number
+func ListRevisions(ctx context.Context, c client.Client, obj client.Object) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(revisionGVK.GroupVersion().WithKind(revisionGVK.Kind + "List"))
+	err := c.List(ctx, list, client.InNamespace(obj.GetNamespace()), client.MatchingLabels{RevisionOwnerLabel: string(obj.GetUID())})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := list.Items
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return RevisionNumber(&revisions[i]) < RevisionNumber(&revisions[j])
+	})
+	return revisions, nil
+}
+
+// RevisionNumber returns the revision number of a ControllerRevision
+func RevisionNumber(u *unstructured.Unstructured) int64 {
+	revision, _, _ := unstructured.NestedInt64(u.Object, "revision")
+	return revision
+}
+
+// RevisionSnapshotOf returns the snapshot recorded by a ControllerRevision
+func RevisionSnapshotOf(u *unstructured.Unstructured) (*RevisionSnapshot, error) {
+	data, found, err := unstructured.NestedMap(u.Object, "data")
+	if err != nil || !found {
+		return nil, fmt.Errorf("revision %s has no data", u.GetName())
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &RevisionSnapshot{}
+	if err := json.Unmarshal(raw, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// RecordRevision creates a ControllerRevision, owned by the Oslc or Phase CR obj, of its
+// snapshot unless the latest revision already records it. A previous revision recording
+// the same snapshot is renumbered instead of being duplicated. The previous revisions
+// beyond the limit are deleted.
+func RecordRevision(ctx context.Context, c client.Client, obj client.Object,
+	snapshot RevisionSnapshot, limit *int32) (*RevisionHistory, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	owner := *metav1.NewControllerRef(obj, gvk)
+
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	hash := hex.EncodeToString(sum[:])
+
+	revisions, err := ListRevisions(ctx, c, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &RevisionHistory{Current: 1}
+	if len(revisions) != 0 {
+		latest := &revisions[len(revisions)-1]
+		history.Current = RevisionNumber(latest) + 1
+		if latest.GetLabels()[RevisionHashLabel] == hash[:10] {
+			history.Current = RevisionNumber(latest)
+			if len(revisions) > 1 {
+				history.Previous = RevisionNumber(&revisions[len(revisions)-2])
+			}
+			return history, nil
+		}
+		history.Previous = RevisionNumber(latest)
+	}
+	history.Created = true
+
+	var recorded *unstructured.Unstructured
+	for i := range revisions {
+		if revisions[i].GetLabels()[RevisionHashLabel] == hash[:10] {
+			recorded = &revisions[i]
+		}
+	}
+
+	if recorded != nil {
+		// Same snapshot as an older revision, for instance after a rollback
+		patch := []byte(fmt.Sprintf(`{"revision":%d}`, history.Current))
+		if err := c.Patch(ctx, recorded, client.RawPatch(types.MergePatchType, patch)); err != nil {
+			return nil, NewResourceError(OperationApply, recorded, err)
+		}
+		_ = unstructured.SetNestedField(recorded.Object, history.Current, "revision")
+		log.Info("Renumbered revision", "name", recorded.GetName(), "revision", history.Current)
+	} else {
+		recorded = &unstructured.Unstructured{}
+		recorded.SetGroupVersionKind(revisionGVK)
+		recorded.SetNamespace(obj.GetNamespace())
+		recorded.SetName(RevisionName(owner, hash))
+		recorded.SetOwnerReferences([]metav1.OwnerReference{owner})
+		recorded.SetLabels(map[string]string{
+			ManagedByLabel:     ManagedByValue,
+			RevisionOwnerLabel: string(owner.UID),
+			RevisionHashLabel:  hash[:10],
+		})
+		recorded.Object["data"] = data
+		recorded.Object["revision"] = history.Current
+		if err := c.Create(ctx, recorded); err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, NewResourceError(OperationCreate, recorded, err)
+		}
+		log.Info("Recorded revision", "name", recorded.GetName(), "revision", history.Current)
+		revisions = append(revisions, *recorded)
+	}
+
+	return history, pruneRevisions(ctx, c, revisions, history.Current, GetRevisionHistoryLimit(limit))
+}
+
+// pruneRevisions deletes the oldest revisions but the current one and the limit previous ones
+func pruneRevisions(ctx context.Context, c client.Client, revisions []unstructured.Unstructured, current int64, limit int32) error {
+	previous := make([]unstructured.Unstructured, 0, len(revisions))
+	for i := range revisions {
+		if RevisionNumber(&revisions[i]) != current {
+			previous = append(previous, revisions[i])
+		}
+	}
+	sort.SliceStable(previous, func(i, j int) bool {
+		return RevisionNumber(&previous[i]) < RevisionNumber(&previous[j])
+	})
+
+	errs := make([]error, 0)
+	for i := 0; i < len(previous)-int(limit); i++ {
+		if err := c.Delete(ctx, &previous[i]); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, NewResourceError(OperationPrune, &previous[i], err))
+			continue
+		}
+		log.Info("Deleted revision", "name", previous[i].GetName(), "revision", RevisionNumber(&previous[i]))
+	}
+	return NewMultiError(errs)
+}
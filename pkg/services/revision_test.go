@@ -0,0 +1,148 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newRevisionOwner() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openstack", Name: "keystone", UID: types.UID("1234")},
+	}
+}
+
+func newRevisionSnapshot(targetVersion string) RevisionSnapshot {
+	return RevisionSnapshot{Spec: map[string]interface{}{"targetVersion": targetVersion}}
+}
+
+func TestRecordRevision(t *testing.T) {
+	one := int32(1)
+	tests := []struct {
+		name     string
+		versions []string
+		limit    *int32
+		want     RevisionHistory
+		kept     []int64
+	}{
+		{name: "first", versions: []string{"ocata"}, want: RevisionHistory{Current: 1, Created: true}, kept: []int64{1}},
+		{name: "unchanged", versions: []string{"ocata", "ocata"}, want: RevisionHistory{Current: 1}, kept: []int64{1}},
+		{name: "changed", versions: []string{"ocata", "pike"},
+			want: RevisionHistory{Current: 2, Previous: 1, Created: true}, kept: []int64{1, 2}},
+		{name: "unchanged with previous", versions: []string{"ocata", "pike", "pike"},
+			want: RevisionHistory{Current: 2, Previous: 1}, kept: []int64{1, 2}},
+		{name: "renumbered", versions: []string{"ocata", "pike", "ocata"},
+			want: RevisionHistory{Current: 3, Previous: 2, Created: true}, kept: []int64{2, 3}},
+		{name: "pruned", versions: []string{"ocata", "pike", "queens"}, limit: &one,
+			want: RevisionHistory{Current: 3, Previous: 2, Created: true}, kept: []int64{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := newRevisionOwner()
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(owner).Build()
+
+			var history *RevisionHistory
+			var err error
+			for _, version := range tt.versions {
+				if history, err = RecordRevision(context.TODO(), c, owner, newRevisionSnapshot(version), tt.limit); err != nil {
+					t.Fatalf("RecordRevision() error = %v", err)
+				}
+			}
+			if *history != tt.want {
+				t.Errorf("RecordRevision() = %+v, want %+v", *history, tt.want)
+			}
+
+			revisions, err := ListRevisions(context.TODO(), c, owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != len(tt.kept) {
+				t.Fatalf("ListRevisions() returned %d revisions, want %v", len(revisions), tt.kept)
+			}
+			for i := range revisions {
+				if RevisionNumber(&revisions[i]) != tt.kept[i] {
+					t.Errorf("ListRevisions()[%d] revision = %d, want %d", i, RevisionNumber(&revisions[i]), tt.kept[i])
+				}
+				refs := revisions[i].GetOwnerReferences()
+				if len(refs) != 1 || refs[0].UID != owner.UID || refs[0].Kind != "ConfigMap" || refs[0].Controller == nil || !*refs[0].Controller {
+					t.Errorf("ListRevisions()[%d] owner references = %v, want the controller reference of the owner", i, refs)
+				}
+			}
+
+			snapshot, err := RevisionSnapshotOf(FindRevision(revisions, tt.want.Current))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := snapshot.Spec.(map[string]interface{})["targetVersion"]; got != tt.versions[len(tt.versions)-1] {
+				t.Errorf("RevisionSnapshotOf() target version = %v, want %v", got, tt.versions[len(tt.versions)-1])
+			}
+		})
+	}
+}
+
+func TestPatchRevisionStatus(t *testing.T) {
+	// The revision numbers are not part of the typed status, hence an unstructured CR
+	oslc := newObject("openstacklcm.airshipit.org/v1alpha1", "Oslc", "openstack", "keystone", map[string]interface{}{
+		"status": map[string]interface{}{"actualState": "deployed"},
+	})
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(oslc).Build()
+
+	for _, history := range []RevisionHistory{{Current: 1}, {Current: 2, Previous: 1}, {Current: 2, Previous: 1}} {
+		if err := PatchRevisionStatus(context.TODO(), c, oslc, history); err != nil {
+			t.Fatalf("PatchRevisionStatus() error = %v", err)
+		}
+		status, err := GetRevisionStatus(context.TODO(), c, oslc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.CurrentRevision != history.Current || status.PreviousRevision != history.Previous {
+			t.Errorf("PatchRevisionStatus() status = %+v, want %+v", *status, history)
+		}
+	}
+
+	// The revision numbers are preserved by the patch of the rest of the status
+	instance := newObject("openstacklcm.airshipit.org/v1alpha1", "Oslc", "openstack", "keystone", map[string]interface{}{
+		"status": map[string]interface{}{"actualState": "pending"},
+	})
+	instance.SetResourceVersion(oslc.GetResourceVersion())
+	if err := PatchStatus(context.TODO(), c, instance); err != nil {
+		t.Fatalf("PatchStatus() error = %v", err)
+	}
+	live := oslc.DeepCopy()
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(oslc), live); err != nil {
+		t.Fatal(err)
+	}
+	if state, _, _ := unstructured.NestedString(live.Object, "status", "actualState"); state != "pending" {
+		t.Errorf("PatchStatus() actual state = %v, want pending", state)
+	}
+	status, err := GetRevisionStatus(context.TODO(), c, oslc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.CurrentRevision != 2 || status.PreviousRevision != 1 {
+		t.Errorf("PatchStatus() revision status = %+v, want it preserved", *status)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"encoding/json"
+	"strconv"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FlowKindRollback is the flow kind restoring a previous version of the service
+const FlowKindRollback av1.OslcFlowKind = "rollback"
+
+// GetRollbackRevision returns the revision the spec.rollbackTo of the Oslc CR, or else its
+// RollbackToAnnotation, points to. Returns false if neither is set or the revision is invalid.
+func GetRollbackRevision(obj metav1.Object, extension OslcSpecExtension) (int64, bool) {
+	if extension.RollbackTo != nil {
+		if extension.RollbackTo.Revision <= 0 {
+			log.Info("Invalid rollback revision, ignoring", "name", obj.GetName(), "revision", extension.RollbackTo.Revision)
+			return 0, false
+		}
+		return extension.RollbackTo.Revision, true
+	}
+
+	value, ok := obj.GetAnnotations()[RollbackToAnnotation]
+	if !ok {
+		return 0, false
+	}
+
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || revision <= 0 {
+		log.Info("Invalid rollback revision, ignoring", "name", obj.GetName(), "revision", value)
+		return 0, false
+	}
+	return revision, true
+}
+
+// FindRevision returns the ControllerRevision with the revision number, nil if not found
+func FindRevision(revisions []unstructured.Unstructured, revision int64) *unstructured.Unstructured {
+	for i := range revisions {
+		if RevisionNumber(&revisions[i]) == revision {
+			return &revisions[i]
+		}
+	}
+	return nil
+}
+
+// PreviousTargetVersion returns the target version of the latest run of the flow which
+// differs from the target version, empty if none. The run preceding a change of the
+// target version is considered before it is archived, since the flow of the new run
+// is rendered first.
+func PreviousTargetVersion(inv *Inventory, targetVersion string) string {
+	if inv == nil {
+		return ""
+	}
+	for i := len(inv.FlowRuns) - 1; i >= 0; i-- {
+		run := inv.FlowRuns[i]
+		if run.TargetVersion != "" && run.TargetVersion != targetVersion {
+			return run.TargetVersion
+		}
+	}
+	return ""
+}
+
+// RestoreRevision replaces the spec and the recorded annotations of the Oslc CR by the
+// ones of the snapshot and sets its flow kind to rollback. It returns the extension of
+// the spec recorded in the snapshot, including its target version, without rollbackTo.
+// The RollbackToAnnotation is removed.
+func RestoreRevision(instance *av1.Oslc, snapshot *RevisionSnapshot) (*OslcSpecExtension, error) {
+	raw, err := json.Marshal(snapshot.Spec)
+	if err != nil {
+		return nil, err
+	}
+	spec := OslcSpecWithExtension{}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, NewTypedError(ErrorTypeInvalidManifest, err)
+	}
+	spec.FlowKind = FlowKindRollback
+	spec.RollbackTo = nil
+	instance.Spec = spec.OslcSpec
+
+	annotations := map[string]string{}
+	for key, value := range instance.GetAnnotations() {
+		if !isRecordedAnnotation(key) && key != RollbackToAnnotation {
+			annotations[key] = value
+		}
+	}
+	for key, value := range snapshot.Annotations {
+		annotations[key] = value
+	}
+	instance.SetAnnotations(annotations)
+	return &spec.OslcSpecExtension, nil
+}
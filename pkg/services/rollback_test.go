@@ -0,0 +1,121 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	av1 "github.com/keleustes/armada-crd/pkg/apis/openstacklcm/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetRollbackRevision(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		rollbackTo *RollbackConfig
+		want       int64
+		wantOk     bool
+	}{
+		{name: "none"},
+		{name: "annotation", annotation: "3", want: 3, wantOk: true},
+		{name: "invalid annotation", annotation: "last"},
+		{name: "spec", rollbackTo: &RollbackConfig{Revision: 2}, want: 2, wantOk: true},
+		{name: "spec over annotation", annotation: "3", rollbackTo: &RollbackConfig{Revision: 2}, want: 2, wantOk: true},
+		{name: "invalid spec", rollbackTo: &RollbackConfig{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &metav1.ObjectMeta{Name: "keystone"}
+			if tt.annotation != "" {
+				obj.SetAnnotations(map[string]string{RollbackToAnnotation: tt.annotation})
+			}
+			got, ok := GetRollbackRevision(obj, OslcSpecExtension{RollbackTo: tt.rollbackTo})
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("GetRollbackRevision() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestPreviousTargetVersion(t *testing.T) {
+	now := metav1.Now()
+	inv := &Inventory{FlowRuns: []FlowRunRecord{
+		{Number: 1, FlowKind: "install", TargetVersion: "ocata", ArchivedAt: &now},
+		{Number: 2, FlowKind: "upgrade", TargetVersion: "pike"},
+	}}
+
+	tests := []struct {
+		name          string
+		inv           *Inventory
+		targetVersion string
+		want          string
+	}{
+		{name: "no inventory", targetVersion: "pike"},
+		{name: "running", inv: inv, targetVersion: "pike", want: "ocata"},
+		{name: "not archived yet", inv: inv, targetVersion: "queens", want: "pike"},
+		{name: "same version", inv: &Inventory{FlowRuns: inv.FlowRuns[:1]}, targetVersion: "ocata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PreviousTargetVersion(tt.inv, tt.targetVersion); got != tt.want {
+				t.Errorf("PreviousTargetVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	instance := &av1.Oslc{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "keystone",
+			Annotations: map[string]string{
+				RollbackToAnnotation:     "1",
+				"other":                  "kept",
+				AbortAnnotation:          "true",
+				RetainKindsAnnotation:    "PersistentVolumeClaim",
+				AdoptionPolicyAnnotation: "never",
+			},
+		},
+		Spec: av1.OslcSpec{ServiceName: "keystone", FlowKind: "upgrade"},
+	}
+	snapshot := &RevisionSnapshot{
+		Spec: map[string]interface{}{"serviceName": "keystone", "flowKind": "install", "targetVersion": "ocata",
+			"rollbackTo": map[string]interface{}{"revision": int64(1)}},
+		Annotations: map[string]string{AdoptionPolicyAnnotation: "always"},
+	}
+
+	extension, err := RestoreRevision(instance, snapshot)
+	if err != nil {
+		t.Fatalf("RestoreRevision() error = %v", err)
+	}
+	if extension.TargetVersion != "ocata" || extension.RollbackTo != nil {
+		t.Errorf("RestoreRevision() extension = %+v, want target version ocata without rollbackTo", extension)
+	}
+	if instance.Spec.FlowKind != FlowKindRollback {
+		t.Errorf("RestoreRevision() flow kind = %v, want %v", instance.Spec.FlowKind, FlowKindRollback)
+	}
+	want := map[string]string{"other": "kept", AbortAnnotation: "true", AdoptionPolicyAnnotation: "always"}
+	if !reflect.DeepEqual(instance.GetAnnotations(), want) {
+		t.Errorf("RestoreRevision() annotations = %v, want %v", instance.GetAnnotations(), want)
+	}
+
+	if _, err := RestoreRevision(instance, &RevisionSnapshot{Spec: "invalid"}); ErrorTypeOf(err) != ErrorTypeInvalidManifest {
+		t.Errorf("RestoreRevision() error = %v, want an invalid manifest error", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ZoneLabel is the well-known node label containing the availability zone of a node
+const ZoneLabel = "topology.kubernetes.io/zone"
+
+// sliceAnnotations are the annotations describing the slice of an Oslc CR. They are
+// propagated to the Phase CRs created by its flow.
+var sliceAnnotations = []string{
+	SliceAnnotation,
+	SliceNodeSelectorAnnotation,
+	SliceZoneAnnotation,
+	SliceReplicasAnnotation,
+}
+
+// Slice is the slice (or shard) of a service an Oslc or Phase CR applies its
+// lifecycle to, such as one availability zone during a blue-green upgrade.
+type Slice struct {
+	Name         string
+	NodeSelector map[string]string
+	Zone         string
+	Replicas     *int32
+	Annotations  map[string]string
+}
+
+// GetSlice returns the slice an Oslc or Phase CR is scoped to, as described by its
+// SliceAnnotation, SliceNodeSelectorAnnotation, SliceZoneAnnotation and
+// SliceReplicasAnnotation, nil if it applies to the whole service. The name of the
+// slice defaults to the zone.
+func GetSlice(obj metav1.Object) *Slice {
+	annotations := obj.GetAnnotations()
+	slice := &Slice{
+		Name:         strings.ToLower(strings.TrimSpace(annotations[SliceAnnotation])),
+		NodeSelector: map[string]string{},
+		Zone:         strings.TrimSpace(annotations[SliceZoneAnnotation]),
+		Annotations:  map[string]string{},
+	}
+
+	for _, key := range sliceAnnotations {
+		if value, ok := annotations[key]; ok {
+			slice.Annotations[key] = value
+		}
+	}
+	if len(slice.Annotations) == 0 {
+		return nil
+	}
+
+	if slice.Name == "" {
+		slice.Name = strings.ToLower(slice.Zone)
+	}
+	if errs := validation.IsDNS1123Label(slice.Name); len(errs) != 0 {
+		log.Info("Invalid slice name, applying to the whole service", "name", obj.GetName(), "slice", slice.Name, "reason", strings.Join(errs, ", "))
+		return nil
+	}
+
+	if value := annotations[SliceNodeSelectorAnnotation]; value != "" {
+		selector, err := labels.ConvertSelectorToLabelsMap(value)
+		if err != nil {
+			log.Info("Invalid slice node selector, ignoring it", "name", obj.GetName(), "selector", value, "reason", err.Error())
+		} else {
+			for k, v := range selector {
+				slice.NodeSelector[k] = v
+			}
+		}
+	}
+	if slice.Zone != "" {
+		slice.NodeSelector[ZoneLabel] = slice.Zone
+	}
+
+	if value := annotations[SliceReplicasAnnotation]; value != "" {
+		replicas, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || replicas < 0 {
+			log.Info("Invalid slice replicas, ignoring them", "name", obj.GetName(), "replicas", value)
+		} else {
+			count := int32(replicas)
+			slice.Replicas = &count
+		}
+	}
+
+	return slice
+}
+
+// Suffix returns the suffix appended to the names of the resources of the slice,
+// empty for the whole service
+func (s *Slice) Suffix() string {
+	if s == nil {
+		return ""
+	}
+	return "-" + s.Name
+}
+
+// String returns the name of the slice
+func (s *Slice) String() string {
+	if s == nil {
+		return "all"
+	}
+	return s.Name
+}
+
+// Values returns the .Values.oslc.slice tree passed to the charts:
+//
+//	slice:
+//	  name: az1
+//	  suffix: -az1
+//	  zone: az1
+//	  node_selector:
+//	    topology.kubernetes.io/zone: az1
+//	  replicas: 1
+//	  annotations:
+//	    openstacklcm.airshipit.org/slice-zone: az1
+func (s *Slice) Values() map[string]interface{} {
+	nodeSelector := map[string]interface{}{}
+	for k, v := range s.NodeSelector {
+		nodeSelector[k] = v
+	}
+	annotations := map[string]interface{}{}
+	for k, v := range s.Annotations {
+		annotations[k] = v
+	}
+
+	values := map[string]interface{}{
+		"name":          s.Name,
+		"suffix":        s.Suffix(),
+		"zone":          s.Zone,
+		"node_selector": nodeSelector,
+		"annotations":   annotations,
+	}
+	if s.Replicas != nil {
+		values["replicas"] = int64(*s.Replicas)
+	}
+	return values
+}
+
+// Apply labels an object rendered for the slice with its name
+func (s *Slice) Apply(u *unstructured.Unstructured) {
+	if s == nil {
+		return
+	}
+	objectLabels := u.GetLabels()
+	if objectLabels == nil {
+		objectLabels = map[string]string{}
+	}
+	objectLabels[SliceLabel] = s.Name
+	u.SetLabels(objectLabels)
+}
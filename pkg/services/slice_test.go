@@ -0,0 +1,123 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetSlice(t *testing.T) {
+	replicas := int32(2)
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		want         string
+		suffix       string
+		nodeSelector map[string]string
+		replicas     *int32
+	}{
+		{
+			name:   "whole service",
+			want:   "all",
+			suffix: "",
+		},
+		{
+			name:         "zone",
+			annotations:  map[string]string{SliceZoneAnnotation: "AZ1"},
+			want:         "az1",
+			suffix:       "-az1",
+			nodeSelector: map[string]string{ZoneLabel: "AZ1"},
+		},
+		{
+			name: "named slice with node selector",
+			annotations: map[string]string{
+				SliceAnnotation:             "blue",
+				SliceNodeSelectorAnnotation: "rack=r1,openstack-control-plane=enabled",
+				SliceZoneAnnotation:         "az2",
+				SliceReplicasAnnotation:     "2",
+			},
+			want:   "blue",
+			suffix: "-blue",
+			nodeSelector: map[string]string{
+				"rack":                    "r1",
+				"openstack-control-plane": "enabled",
+				ZoneLabel:                 "az2",
+			},
+			replicas: &replicas,
+		},
+		{
+			name:         "invalid node selector and replicas",
+			annotations:  map[string]string{SliceAnnotation: "blue", SliceNodeSelectorAnnotation: "rack", SliceReplicasAnnotation: "-1"},
+			want:         "blue",
+			suffix:       "-blue",
+			nodeSelector: map[string]string{},
+		},
+		{
+			name:        "invalid name",
+			annotations: map[string]string{SliceAnnotation: "blue_green"},
+			want:        "all",
+			suffix:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newObject("openstacklcm.airshipit.org/v1alpha1", "Oslc", "openstack", "keystone", nil)
+			obj.SetAnnotations(tt.annotations)
+			slice := GetSlice(obj)
+			if got := slice.String(); got != tt.want {
+				t.Fatalf("GetSlice() = %q, want %q", got, tt.want)
+			}
+			if got := slice.Suffix(); got != tt.suffix {
+				t.Errorf("Suffix() = %q, want %q", got, tt.suffix)
+			}
+
+			// The rendered objects are labeled with the slice only
+			u := newObject("argoproj.io/v1alpha1", "Workflow", "openstack", "keystone-upgrade", nil)
+			slice.Apply(u)
+			if slice == nil {
+				if _, ok := u.GetLabels()[SliceLabel]; ok {
+					t.Errorf("Apply() labeled the object of the whole service: %v", u.GetLabels())
+				}
+				return
+			}
+			if got := u.GetLabels()[SliceLabel]; got != tt.want {
+				t.Errorf("Apply() %s = %q, want %q", SliceLabel, got, tt.want)
+			}
+
+			if !reflect.DeepEqual(slice.NodeSelector, tt.nodeSelector) {
+				t.Errorf("NodeSelector = %v, want %v", slice.NodeSelector, tt.nodeSelector)
+			}
+			if !reflect.DeepEqual(slice.Replicas, tt.replicas) {
+				t.Errorf("Replicas = %v, want %v", slice.Replicas, tt.replicas)
+			}
+			if !reflect.DeepEqual(slice.Annotations, tt.annotations) {
+				t.Errorf("Annotations = %v, want %v", slice.Annotations, tt.annotations)
+			}
+
+			values := slice.Values()
+			if values["suffix"] != tt.suffix || values["name"] != tt.want {
+				t.Errorf("Values() name = %v, suffix = %v", values["name"], values["suffix"])
+			}
+			if got := values["node_selector"].(map[string]interface{}); len(got) != len(tt.nodeSelector) {
+				t.Errorf("Values() node_selector = %v, want %v", got, tt.nodeSelector)
+			}
+			if _, ok := values["replicas"]; ok != (tt.replicas != nil) {
+				t.Errorf("Values() replicas = %v, want %v", values["replicas"], tt.replicas)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// liveObject returns an empty unstructured object of the kind of obj, to read the
+// latest version of obj from the API server
+func liveObject(c client.Client, obj client.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	return u, nil
+}
+
+// PatchStatus patches the status of the Oslc or Phase CR obj in the cluster. The write
+// is skipped when the live status is already the status of obj. The status of obj has
+// been computed by the reconcile out of the version of obj it read, hence the patch is
+// locked on the resourceVersion of obj: if the CR has been modified since then, the
+// Conflict error is returned and the reconcile is performed again on the fresh object
+// instead of overwriting the status, including its conditions, with a stale one.
+func PatchStatus(ctx context.Context, c client.Client, obj client.Object) error {
+	current, err := liveObject(c, obj)
+	if err != nil {
+		return err
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return err
+	}
+
+	desired, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	status, _, _ := unstructured.NestedMap(desired, "status")
+	if status == nil {
+		status = map[string]interface{}{}
+	}
+	liveStatus, _, _ := unstructured.NestedMap(current.Object, "status")
+	for _, key := range revisionStatusKeys {
+		if value, found := liveStatus[key]; found {
+			status[key] = value
+		}
+	}
+	if equality.Semantic.DeepEqual(liveStatus, status) {
+		return nil
+	}
+
+	base := current.DeepCopy()
+	base.SetResourceVersion(obj.GetResourceVersion())
+	patch := client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{})
+	current.Object["status"] = status
+	if err := c.Status().Patch(ctx, current, patch); err != nil {
+		return err
+	}
+	obj.SetResourceVersion(current.GetResourceVersion())
+	return nil
+}
+
+// revisionStatusKeys are the keys of RevisionStatus, which the typed status of the
+// Oslc and Phase CRs does not contain
+var revisionStatusKeys = []string{"currentRevision", "previousRevision"}
+
+// RevisionStatus contains the revision numbers published in the status of an Oslc or
+// Phase CR, next to the fields of its typed status
+type RevisionStatus struct {
+	// CurrentRevision is the revision matching the current spec of the CR
+	CurrentRevision int64 `json:"currentRevision,omitempty"`
+
+	// PreviousRevision is the revision before the current one
+	PreviousRevision int64 `json:"previousRevision,omitempty"`
+}
+
+// GetRevisionStatus returns the revision numbers published in the status of the CR
+// in the cluster
+func GetRevisionStatus(ctx context.Context, c client.Client, obj client.Object) (*RevisionStatus, error) {
+	current, err := liveObject(c, obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return nil, err
+	}
+	status := &RevisionStatus{}
+	status.CurrentRevision, _, _ = unstructured.NestedInt64(current.Object, "status", "currentRevision")
+	status.PreviousRevision, _, _ = unstructured.NestedInt64(current.Object, "status", "previousRevision")
+	return status, nil
+}
+
+// PatchRevisionStatus publishes the revision numbers of history in the status of the
+// Oslc or Phase CR obj in the cluster. The write is skipped when they did not change.
+// As PatchStatus, the patch is locked on the resourceVersion of obj.
+func PatchRevisionStatus(ctx context.Context, c client.Client, obj client.Object, history RevisionHistory) error {
+	current, err := liveObject(c, obj)
+	if err != nil {
+		return err
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return err
+	}
+
+	desired := current.DeepCopy()
+	_ = unstructured.SetNestedField(desired.Object, history.Current, "status", "currentRevision")
+	if history.Previous == 0 {
+		unstructured.RemoveNestedField(desired.Object, "status", "previousRevision")
+	} else {
+		_ = unstructured.SetNestedField(desired.Object, history.Previous, "status", "previousRevision")
+	}
+	if equality.Semantic.DeepEqual(current.Object, desired.Object) {
+		return nil
+	}
+
+	base := current.DeepCopy()
+	base.SetResourceVersion(obj.GetResourceVersion())
+	patch := client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{})
+	if err := c.Status().Patch(ctx, desired, patch); err != nil {
+		return err
+	}
+	obj.SetResourceVersion(desired.GetResourceVersion())
+	return nil
+}
+
+// PatchFinalizer adds or removes the finalizer of the Oslc or Phase CR obj in the cluster.
+// A patch is used, retried on conflict, so that the finalizers set concurrently are preserved.
+func PatchFinalizer(ctx context.Context, c client.Client, obj client.Object, finalizer string, add bool) error {
+	current, err := liveObject(c, obj)
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+			return err
+		}
+
+		patch := client.MergeFromWithOptions(current.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		var changed bool
+		if add {
+			changed = controllerutil.AddFinalizer(current, finalizer)
+		} else {
+			changed = controllerutil.RemoveFinalizer(current, finalizer)
+		}
+		if changed {
+			if err := c.Patch(ctx, current, patch); err != nil {
+				return err
+			}
+		}
+		obj.SetFinalizers(current.GetFinalizers())
+		obj.SetResourceVersion(current.GetResourceVersion())
+		return nil
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// statusRecorder records the writes sent to the status subresource
+type statusRecorder struct {
+	client.StatusWriter
+	writes *[]recordedWrite
+}
+
+func (w statusRecorder) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	*w.writes = append(*w.writes, recordedWrite{verb: "update", name: obj.GetName()})
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func (w statusRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	*w.writes = append(*w.writes, recordedWrite{verb: "patch", name: obj.GetName()})
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *writeRecorder) Status() client.StatusWriter {
+	return statusRecorder{StatusWriter: c.Client.Status(), writes: &c.writes}
+}
+
+func newTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openstack", Name: "keystone", Finalizers: []string{"other"}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodPending,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func TestPatchStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		phase      corev1.PodPhase
+		wantPhase  corev1.PodPhase
+		wantWrites int
+	}{
+		{name: "unchanged", phase: corev1.PodPending, wantPhase: corev1.PodPending, wantWrites: 0},
+		{name: "changed", phase: corev1.PodRunning, wantPhase: corev1.PodRunning, wantWrites: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &writeRecorder{Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(newTestPod()).Build()}
+
+			instance := &corev1.Pod{}
+			if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "openstack", Name: "keystone"}, instance); err != nil {
+				t.Fatal(err)
+			}
+			resourceVersion := instance.GetResourceVersion()
+			instance.Status.Phase = tt.phase
+			if err := PatchStatus(context.TODO(), c, instance); err != nil {
+				t.Fatalf("PatchStatus() error = %v", err)
+			}
+			if len(c.writes) != tt.wantWrites {
+				t.Errorf("PatchStatus() sent writes %v, want %d", c.writes, tt.wantWrites)
+			}
+
+			live := &corev1.Pod{}
+			if err := c.Get(context.TODO(), client.ObjectKeyFromObject(instance), live); err != nil {
+				t.Fatal(err)
+			}
+			if live.Status.Phase != tt.wantPhase {
+				t.Errorf("PatchStatus() live phase = %v, want %v", live.Status.Phase, tt.wantPhase)
+			}
+			if len(live.Status.Conditions) != 1 {
+				t.Errorf("PatchStatus() live conditions = %v", live.Status.Conditions)
+			}
+			if live.GetResourceVersion() != instance.GetResourceVersion() {
+				t.Errorf("PatchStatus() resourceVersion = %v, want %v", instance.GetResourceVersion(), live.GetResourceVersion())
+			}
+			if tt.wantWrites == 0 && instance.GetResourceVersion() != resourceVersion {
+				t.Errorf("PatchStatus() modified the unchanged CR")
+			}
+		})
+	}
+}
+
+func TestPatchStatusConflict(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(newTestPod()).Build()
+
+	stale := &corev1.Pod{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "openstack", Name: "keystone"}, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// A condition is added concurrently to the status the reconcile has read
+	fresh := stale.DeepCopy()
+	fresh.Status.Conditions = append(fresh.Status.Conditions, corev1.PodCondition{Type: corev1.PodReady, Status: corev1.ConditionTrue})
+	if err := c.Status().Update(context.TODO(), fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	// The status computed out of the stale version is not written
+	stale.Status.Phase = corev1.PodRunning
+	if err := PatchStatus(context.TODO(), c, stale); !apierrors.IsConflict(err) {
+		t.Fatalf("PatchStatus() error = %v, want a Conflict", err)
+	}
+
+	live := &corev1.Pod{}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(stale), live); err != nil {
+		t.Fatal(err)
+	}
+	if live.Status.Phase != corev1.PodPending || len(live.Status.Conditions) != 2 {
+		t.Errorf("PatchStatus() overwrote the live status %v", live.Status)
+	}
+}
+
+func TestPatchFinalizer(t *testing.T) {
+	tests := []struct {
+		name      string
+		finalizer string
+		add       bool
+		want      []string
+	}{
+		{name: "add", finalizer: "uninstall", add: true, want: []string{"other", "uninstall"}},
+		{name: "add existing", finalizer: "other", add: true, want: []string{"other"}},
+		{name: "remove", finalizer: "other", add: false, want: nil},
+		{name: "remove missing", finalizer: "uninstall", add: false, want: []string{"other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(newTestPod()).Build()
+
+			// The instance misses the finalizer set concurrently, which must be preserved
+			instance := newTestPod()
+			instance.SetFinalizers(nil)
+			if err := PatchFinalizer(context.TODO(), c, instance, tt.finalizer, tt.add); err != nil {
+				t.Fatalf("PatchFinalizer() error = %v", err)
+			}
+
+			live := &corev1.Pod{}
+			if err := c.Get(context.TODO(), client.ObjectKeyFromObject(instance), live); err != nil {
+				t.Fatal(err)
+			}
+			if len(live.GetFinalizers()) != len(tt.want) {
+				t.Fatalf("PatchFinalizer() live finalizers = %v, want %v", live.GetFinalizers(), tt.want)
+			}
+			for i := range tt.want {
+				if live.GetFinalizers()[i] != tt.want[i] {
+					t.Errorf("PatchFinalizer() live finalizers = %v, want %v", live.GetFinalizers(), tt.want)
+				}
+			}
+			if len(instance.GetFinalizers()) != len(tt.want) {
+				t.Errorf("PatchFinalizer() instance finalizers = %v, want %v", instance.GetFinalizers(), tt.want)
+			}
+		})
+	}
+}
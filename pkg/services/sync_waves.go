@@ -0,0 +1,189 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/keleustes/oslc-operator/pkg/health"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultSyncWavePollPeriod is the default period at which the sub resources of a CR
+// which are not all applied and healthy yet are checked when the reconcile period of
+// the operator is longer or disabled. The sync waves which are not reached yet are
+// applied by those reconciles.
+const DefaultSyncWavePollPeriod = 10 * time.Second
+
+// SyncWave is a group of sub resources applied together
+type SyncWave struct {
+	Wave  int
+	Items []unstructured.Unstructured
+}
+
+// GetSyncWave returns the sync wave of a sub resource
+func GetSyncWave(u *unstructured.Unstructured) int {
+	value, ok := u.GetAnnotations()[SyncWaveAnnotation]
+	if !ok {
+		return 0
+	}
+	wave, err := strconv.Atoi(value)
+	if err != nil {
+		log.Info("Invalid sync wave, using 0", "kind", u.GetKind(), "name", u.GetName(), "wave", value)
+		return 0
+	}
+	return wave
+}
+
+// SplitSyncWaves groups the sub resources by sync wave. The waves are sorted
+// by increasing number and the sub resources of a wave by the install order of sorter.
+func SplitSyncWaves(items []unstructured.Unstructured, sorter KindSorter) []SyncWave {
+	byWave := map[int][]unstructured.Unstructured{}
+	for _, item := range items {
+		wave := GetSyncWave(&item)
+		byWave[wave] = append(byWave[wave], item)
+	}
+
+	waves := make([]SyncWave, 0, len(byWave))
+	for wave, waveItems := range byWave {
+		waves = append(waves, SyncWave{Wave: wave, Items: sorter.SortByInstallOrder(waveItems)})
+	}
+	sort.Slice(waves, func(i, j int) bool { return waves[i].Wave < waves[j].Wave })
+	return waves
+}
+
+// ApplyFunc applies one sub resource. It returns true if the sub resource was
+// created or modified.
+type ApplyFunc func(u *unstructured.Unstructured) (bool, error)
+
+// ApplySyncWaves applies the sub resources wave by wave, calling apply on each of
+// them, and stops at the first wave which is not healthy yet. The progress is
+// recorded in the inventory so that the waves already completed are not waited
+// for again during the next reconcile, unless one of their sub resources has
+// been modified. The instances of a CustomResourceDefinition which is part of the
+// items are applied only once the CRD is Established, and a wave replacing one of
+// its sub resources waits for the deletion of the live version. It returns true once all
+// the waves are healthy.
+func ApplySyncWaves(ctx context.Context, c client.Client, inventory *Inventory,
+	items []unstructured.Unstructured, sorter KindSorter, apply ApplyFunc) (bool, error) {
+
+	// lastHealthy is the last wave found healthy during this reconcile. The wave
+	// numbers are not necessarily contiguous, hence a completed wave which is not
+	// healthy anymore regresses the inventory to it rather than to its own number
+	// minus one.
+	var lastHealthy *int
+	for _, wave := range SplitSyncWaves(items, sorter) {
+		modified := false
+		waiting := false
+		errs := make([]error, 0)
+		for i := range wave.Items {
+			// The instances of a CRD of the same rendering wait for the CRD to be Established
+			if crd := DefiningCRD(items, &wave.Items[i]); crd != nil {
+				established, err := IsCRDEstablished(ctx, c, crd)
+				if err != nil {
+					errs = append(errs, NewResourceError(OperationGet, crd, err))
+					continue
+				}
+				if !established {
+					log.Info("Waiting for CRD to be established", "crd", crd.GetName(), "kind", wave.Items[i].GetKind(), "name", wave.Items[i].GetName())
+					waiting = true
+					continue
+				}
+			}
+
+			changed, err := apply(&wave.Items[i])
+			if errors.Is(err, ErrReplacePending) {
+				waiting = true
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+			modified = modified || changed
+		}
+		if len(errs) != 0 {
+			return false, NewMultiError(errs)
+		}
+
+		completed := inventory.CompletedWave != nil && *inventory.CompletedWave >= wave.Wave
+		if waiting {
+			if completed {
+				inventory.CompletedWave = lastHealthy
+			}
+			return false, nil
+		}
+		if completed && !modified {
+			healthyWave := wave.Wave
+			lastHealthy = &healthyWave
+			continue
+		}
+
+		live := make([]unstructured.Unstructured, 0, len(wave.Items))
+		for i := range wave.Items {
+			item := &wave.Items[i]
+			existing := &unstructured.Unstructured{}
+			existing.SetGroupVersionKind(item.GroupVersionKind())
+			if err := c.Get(ctx, types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()}, existing); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return false, NewResourceError(OperationGet, item, err)
+				}
+				existing = item
+			}
+			live = append(live, *existing)
+		}
+
+		verdict := health.CheckAll(live)
+		if !verdict.IsReady() {
+			if completed {
+				inventory.CompletedWave = lastHealthy
+			}
+			if verdict.IsFailed() {
+				return false, fmt.Errorf("sync wave %d failed: %s", wave.Wave, verdict.Reason)
+			}
+			log.Info("Waiting for sync wave", "wave", wave.Wave, "reason", verdict.Reason)
+			return false, nil
+		}
+
+		completedWave := wave.Wave
+		inventory.CompletedWave = &completedWave
+		lastHealthy = &completedWave
+	}
+
+	return true, nil
+}
+
+// SyncWaveRequeuePeriod returns the period after which the reconcile of a CR has to
+// be performed again. pending tells whether its sub resources are not all applied
+// and healthy yet, in which case they are checked at least every pollPeriod. A
+// pollPeriod of 0 disables that polling.
+func SyncWaveRequeuePeriod(pending bool, period time.Duration, pollPeriod time.Duration) time.Duration {
+	if !pending || pollPeriod <= 0 {
+		return period
+	}
+	if period == 0 || period > pollPeriod {
+		return pollPeriod
+	}
+	return period
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// withWave returns u annotated with the sync wave
+func withWave(u *unstructured.Unstructured, wave string) unstructured.Unstructured {
+	u.SetAnnotations(map[string]string{SyncWaveAnnotation: wave})
+	return *u
+}
+
+func TestGetSyncWave(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        int
+	}{
+		{name: "no annotation", annotations: nil, want: 0},
+		{name: "positive", annotations: map[string]string{SyncWaveAnnotation: "2"}, want: 2},
+		{name: "negative", annotations: map[string]string{SyncWaveAnnotation: "-1"}, want: -1},
+		{name: "invalid", annotations: map[string]string{SyncWaveAnnotation: "first"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newObject("v1", "ConfigMap", "openstack", "config", nil)
+			u.SetAnnotations(tt.annotations)
+			if got := GetSyncWave(u); got != tt.want {
+				t.Errorf("GetSyncWave() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSyncWaves(t *testing.T) {
+	job := withWave(newObject("batch/v1", "Job", "openstack", "db-sync", nil), "1")
+	deployment := *newObject("apps/v1", "Deployment", "openstack", "api", nil)
+	service := *newObject("v1", "Service", "openstack", "api", nil)
+	secret := withWave(newObject("v1", "Secret", "openstack", "db", nil), "-1")
+	configMap := *newObject("v1", "ConfigMap", "openstack", "config", nil)
+
+	tests := []struct {
+		name  string
+		items []unstructured.Unstructured
+		want  map[int][]string
+	}{
+		{name: "empty", items: nil, want: map[int][]string{}},
+		{name: "single wave sorted by kind", items: []unstructured.Unstructured{deployment, service, configMap},
+			want: map[int][]string{0: {"ConfigMap", "Service", "Deployment"}}},
+		{name: "several waves", items: []unstructured.Unstructured{job, deployment, secret, service},
+			want: map[int][]string{-1: {"Secret"}, 0: {"Service", "Deployment"}, 1: {"Job"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waves := SplitSyncWaves(tt.items, DefaultKindSorter)
+			if len(waves) != len(tt.want) {
+				t.Fatalf("SplitSyncWaves() returned %d waves, want %d", len(waves), len(tt.want))
+			}
+			for i, wave := range waves {
+				if i > 0 && waves[i-1].Wave >= wave.Wave {
+					t.Errorf("SplitSyncWaves() waves are not sorted: %d before %d", waves[i-1].Wave, wave.Wave)
+				}
+				kinds := make([]string, 0, len(wave.Items))
+				for _, item := range wave.Items {
+					kinds = append(kinds, item.GetKind())
+				}
+				if !reflect.DeepEqual(kinds, tt.want[wave.Wave]) {
+					t.Errorf("SplitSyncWaves() wave %d = %v, want %v", wave.Wave, kinds, tt.want[wave.Wave])
+				}
+			}
+		})
+	}
+}
+
+func TestSyncWaveRequeuePeriod(t *testing.T) {
+	poll := DefaultSyncWavePollPeriod
+	tests := []struct {
+		name       string
+		pending    bool
+		period     time.Duration
+		pollPeriod time.Duration
+		want       time.Duration
+	}{
+		{name: "not pending", pending: false, period: time.Minute, pollPeriod: poll, want: time.Minute},
+		{name: "not pending without period", pending: false, period: 0, pollPeriod: poll, want: 0},
+		{name: "pending without period", pending: true, period: 0, pollPeriod: poll, want: poll},
+		{name: "pending with longer period", pending: true, period: time.Hour, pollPeriod: poll, want: poll},
+		{name: "pending with shorter period", pending: true, period: time.Second, pollPeriod: poll, want: time.Second},
+		{name: "pending with configured poll period", pending: true, period: time.Hour, pollPeriod: time.Minute, want: time.Minute},
+		{name: "pending with polling disabled", pending: true, period: time.Hour, pollPeriod: 0, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SyncWaveRequeuePeriod(tt.pending, tt.period, tt.pollPeriod); got != tt.want {
+				t.Errorf("SyncWaveRequeuePeriod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySyncWavesCompletedWave(t *testing.T) {
+	secret := withWave(newObject("v1", "Secret", "openstack", "db", nil), "-1")
+	configMap := withWave(newObject("v1", "ConfigMap", "openstack", "config", nil), "2")
+	job := withWave(newObject("batch/v1", "Job", "openstack", "db-sync", nil), "5")
+	items := []unstructured.Unstructured{secret, configMap, job}
+
+	tests := []struct {
+		name      string
+		completed *int
+		modified  string
+		want      *int
+	}{
+		{name: "first wave modified", completed: intPtr(5), modified: "Secret", want: intPtr(2)},
+		{name: "middle wave modified", completed: intPtr(5), modified: "ConfigMap", want: intPtr(2)},
+		{name: "last wave modified", completed: intPtr(5), modified: "Job", want: intPtr(2)},
+		{name: "not completed yet", completed: intPtr(-1), modified: "", want: intPtr(2)},
+		{name: "nothing completed", completed: nil, modified: "", want: intPtr(2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The Job is running, so the wave 5 is not healthy
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).
+				WithObjects(secret.DeepCopy(), configMap.DeepCopy(), job.DeepCopy()).Build()
+			inventory := &Inventory{CompletedWave: tt.completed}
+			apply := func(u *unstructured.Unstructured) (bool, error) {
+				return u.GetKind() == tt.modified, nil
+			}
+
+			done, err := ApplySyncWaves(context.TODO(), c, inventory, items, DefaultKindSorter, apply)
+			if err != nil {
+				t.Fatalf("ApplySyncWaves() error = %v", err)
+			}
+			if done {
+				t.Errorf("ApplySyncWaves() = true while the Job is running")
+			}
+			if !reflect.DeepEqual(inventory.CompletedWave, tt.want) {
+				t.Errorf("CompletedWave = %v, want %v", waveString(inventory.CompletedWave), waveString(tt.want))
+			}
+		})
+	}
+}
+
+func TestApplySyncWavesReplacePending(t *testing.T) {
+	configMap := withWave(newObject("v1", "ConfigMap", "openstack", "config", nil), "0")
+	job := withWave(newObject("batch/v1", "Job", "openstack", "db-sync", nil), "1")
+	service := withWave(newObject("v1", "Service", "openstack", "api", nil), "2")
+	items := []unstructured.Unstructured{configMap, job, service}
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(configMap.DeepCopy()).Build()
+	inventory := &Inventory{CompletedWave: intPtr(2)}
+	applied := make([]string, 0)
+	apply := func(u *unstructured.Unstructured) (bool, error) {
+		applied = append(applied, u.GetKind())
+		if u.GetKind() == "Job" {
+			return false, NewResourceError(OperationApply, u, ErrReplacePending)
+		}
+		return false, nil
+	}
+
+	done, err := ApplySyncWaves(context.TODO(), c, inventory, items, DefaultKindSorter, apply)
+	if err != nil {
+		t.Fatalf("ApplySyncWaves() error = %v", err)
+	}
+	if done {
+		t.Errorf("ApplySyncWaves() = true while the Job is being replaced")
+	}
+	if want := []string{"ConfigMap", "Job"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied %v, want %v", applied, want)
+	}
+	if !reflect.DeepEqual(inventory.CompletedWave, intPtr(0)) {
+		t.Errorf("CompletedWave = %v, want 0", waveString(inventory.CompletedWave))
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func waveString(wave *int) string {
+	if wave == nil {
+		return "nil"
+	}
+	return strconv.Itoa(*wave)
+}
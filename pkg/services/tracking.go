@@ -0,0 +1,117 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// IsClusterScoped returns true if the kind is cluster-scoped. The kinds unknown
+// to the API server yet, for instance the instances of a CRD created by the same
+// rendering, are considered namespaced.
+func IsClusterScoped(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (bool, error) {
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameRoot, nil
+}
+
+// TrackOwnership replaces the owner references of the rendered sub resources which
+// can not carry them by the OwnerUIDLabel and OwnerKindLabel labels and the owner
+// name and namespace annotations. Owner references can neither point from a
+// cluster-scoped object to a namespaced one nor span namespaces, hence the Kubernetes
+// garbage collector does not handle those sub resources. The namespace defaulted by
+// the renderer is removed from the cluster-scoped ones.
+func TrackOwnership(mapper meta.RESTMapper, items []unstructured.Unstructured, owners []metav1.OwnerReference, namespace string) error {
+	if len(owners) == 0 {
+		return nil
+	}
+
+	for i := range items {
+		u := &items[i]
+		clusterScoped, err := IsClusterScoped(mapper, u.GroupVersionKind())
+		if err != nil {
+			return err
+		}
+		if clusterScoped {
+			u.SetNamespace("")
+		} else if u.GetNamespace() == namespace {
+			continue
+		}
+
+		labels := u.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[OwnerUIDLabel] = string(owners[0].UID)
+		labels[OwnerKindLabel] = owners[0].Kind
+		u.SetLabels(labels)
+
+		annotations := u.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[OwnerNameAnnotation] = owners[0].Name
+		annotations[OwnerNamespaceAnnotation] = namespace
+		u.SetAnnotations(annotations)
+
+		u.SetOwnerReferences(nil)
+	}
+	return nil
+}
+
+// IsTracked returns true if the ownership of the sub resource is tracked by labels
+func IsTracked(u *unstructured.Unstructured) bool {
+	_, ok := u.GetLabels()[OwnerUIDLabel]
+	return ok
+}
+
+// Untrack removes the OwnerUIDLabel and OwnerKindLabel labels and the owner name
+// and namespace annotations from the sub resource
+func Untrack(u *unstructured.Unstructured) {
+	labels := u.GetLabels()
+	delete(labels, OwnerUIDLabel)
+	delete(labels, OwnerKindLabel)
+	u.SetLabels(labels)
+
+	annotations := u.GetAnnotations()
+	delete(annotations, OwnerNameAnnotation)
+	delete(annotations, OwnerNamespaceAnnotation)
+	u.SetAnnotations(annotations)
+}
+
+// OwnerRequest maps a sub resource tracked by labels to the reconcile request of
+// its owner. It returns nothing for the other objects.
+func OwnerRequest(obj client.Object) []reconcile.Request {
+	annotations := obj.GetAnnotations()
+	name, ok := annotations[OwnerNameAnnotation]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: annotations[OwnerNamespaceAnnotation], Name: name}},
+	}
+}
@@ -19,8 +19,10 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -37,14 +39,16 @@ func BuildDependentResourceWatchUpdater(mgr manager.Manager, owner *unstructured
 
 	var m sync.RWMutex
 	watches := map[schema.GroupVersionKind]struct{}{}
+	labelWatches := map[schema.GroupVersionKind]struct{}{}
 	watchUpdater := func(dependent []unstructured.Unstructured) error {
 		for _, u := range dependent {
 			gvk := u.GroupVersionKind()
 			wlog := log.WithValues("OwnerKind", owner.GroupVersionKind().GroupKind(), "resourceType", gvk.GroupVersion(), "resourceKind", gvk.Kind)
 			m.RLock()
 			_, ok := watches[gvk]
+			_, labelOk := labelWatches[gvk]
 			m.RUnlock()
-			if ok {
+			if ok && (labelOk || !IsTracked(&u)) {
 				continue
 			}
 
@@ -63,11 +67,39 @@ func BuildDependentResourceWatchUpdater(mgr manager.Manager, owner *unstructured
 			depClusterScoped := depMapping.Scope.Name() == meta.RESTScopeNameRoot
 			ownerClusterScoped := ownerMapping.Scope.Name() == meta.RESTScopeNameRoot
 
+			// The cluster-scoped and cross-namespace sub resources of a namespaced owner can not
+			// carry an owner reference. They are tracked by labels instead, and OwnerRequest maps
+			// them back to their owner using the owner name and namespace annotations set on
+			// them by TrackOwnership.
+			if !labelOk && !ownerClusterScoped && (depClusterScoped || IsTracked(&u)) {
+				selector := labels.SelectorFromSet(labels.Set{OwnerKindLabel: owner.GetKind()})
+				labelPredicate := crtpredicate.NewPredicateFuncs(func(obj client.Object) bool {
+					return selector.Matches(labels.Set(obj.GetLabels()))
+				})
+				tracked := &unstructured.Unstructured{}
+				tracked.SetGroupVersionKind(gvk)
+				err = c.Watch(&source.Kind{Type: tracked}, crthandler.EnqueueRequestsFromMapFunc(OwnerRequest),
+					labelPredicate, dependentPredicate)
+				if err != nil {
+					wlog.Error(err, "Add label Watch to Controller")
+					return err
+				}
+				wlog.Info("Added label watch")
+
+				m.Lock()
+				labelWatches[gvk] = struct{}{}
+				m.Unlock()
+			}
+
+			if ok {
+				continue
+			}
+
+			// A cluster-scoped kind can never be owned by a namespaced owner
 			if !ownerClusterScoped && depClusterScoped {
 				m.Lock()
 				watches[gvk] = struct{}{}
 				m.Unlock()
-				wlog.Info("Cannot watch cluster-scoped")
 				continue
 			}
 
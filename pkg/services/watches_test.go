@@ -0,0 +1,233 @@
+// Copyright 2019 The Openstack-Service-Lifecyle Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var (
+	oslcGVK        = schema.GroupVersionKind{Group: "openstacklcm.airshipit.org", Version: "v1alpha1", Kind: "Oslc"}
+	clusterRoleGVK = schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}
+	configMapGVK   = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+)
+
+// newTestRESTMapper returns a RESTMapper knowing the kinds used by the tests
+func newTestRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(oslcGVK, meta.RESTScopeNamespace)
+	mapper.Add(configMapGVK, meta.RESTScopeNamespace)
+	mapper.Add(clusterRoleGVK, meta.RESTScopeRoot)
+	return mapper
+}
+
+// watchManager is the Manager of the watch tests. Only its RESTMapper is used.
+type watchManager struct {
+	manager.Manager
+	mapper meta.RESTMapper
+}
+
+func (m watchManager) GetRESTMapper() meta.RESTMapper {
+	return m.mapper
+}
+
+// recordedWatch is a watch added to a watchController
+type recordedWatch struct {
+	kind       schema.GroupVersionKind
+	handler    handler.EventHandler
+	predicates []predicate.Predicate
+}
+
+// watchController records the watches added to the Controller
+type watchController struct {
+	controller.Controller
+	watches []recordedWatch
+}
+
+func (c *watchController) Watch(src source.Source, h handler.EventHandler, predicates ...predicate.Predicate) error {
+	kind := src.(*source.Kind)
+	c.watches = append(c.watches, recordedWatch{
+		kind:       kind.Type.GetObjectKind().GroupVersionKind(),
+		handler:    h,
+		predicates: predicates,
+	})
+	return nil
+}
+
+// trackedClusterRole returns a ClusterRole rendered by the keystone Oslc, with its
+// ownership tracked by labels
+func trackedClusterRole(t *testing.T, owner metav1.OwnerReference) unstructured.Unstructured {
+	items := []unstructured.Unstructured{*newObject("rbac.authorization.k8s.io/v1", "ClusterRole", "openstack", "keystone", nil)}
+	if err := TrackOwnership(newTestRESTMapper(), items, []metav1.OwnerReference{owner}, "openstack"); err != nil {
+		t.Fatalf("TrackOwnership() error = %v", err)
+	}
+	return items[0]
+}
+
+func TestTrackOwnership(t *testing.T) {
+	owner := newOwnerRef("keystone", "uid-keystone")
+	items := []unstructured.Unstructured{
+		*newObject("rbac.authorization.k8s.io/v1", "ClusterRole", "openstack", "keystone", nil),
+		*newObject("v1", "ConfigMap", "openstack", "keystone-etc", nil),
+		*newObject("v1", "ConfigMap", "kube-system", "keystone-ca", nil),
+	}
+	for i := range items {
+		items[i].SetOwnerReferences([]metav1.OwnerReference{owner})
+	}
+
+	if err := TrackOwnership(newTestRESTMapper(), items, []metav1.OwnerReference{owner}, "openstack"); err != nil {
+		t.Fatalf("TrackOwnership() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		u         unstructured.Unstructured
+		namespace string
+		tracked   bool
+	}{
+		{name: "cluster-scoped", u: items[0], namespace: "", tracked: true},
+		{name: "same namespace", u: items[1], namespace: "openstack", tracked: false},
+		{name: "other namespace", u: items[2], namespace: "kube-system", tracked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.u.GetNamespace(); got != tt.namespace {
+				t.Errorf("namespace = %q, want %q", got, tt.namespace)
+			}
+			if got := IsTracked(&tt.u); got != tt.tracked {
+				t.Fatalf("IsTracked() = %v, want %v", got, tt.tracked)
+			}
+			if !tt.tracked {
+				if len(tt.u.GetOwnerReferences()) != 1 || len(OwnerRequest(&tt.u)) != 0 {
+					t.Errorf("untracked sub resource lost its owner reference: %v", tt.u.GetOwnerReferences())
+				}
+				return
+			}
+			if len(tt.u.GetOwnerReferences()) != 0 {
+				t.Errorf("tracked sub resource still carries owner references %v", tt.u.GetOwnerReferences())
+			}
+			if got := tt.u.GetLabels()[OwnerKindLabel]; got != owner.Kind {
+				t.Errorf("%s = %q, want %q", OwnerKindLabel, got, owner.Kind)
+			}
+			if !IsOwnedBy(&tt.u, []metav1.OwnerReference{owner}) {
+				t.Errorf("tracked sub resource is not owned by %s", owner.Name)
+			}
+			want := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "openstack", Name: owner.Name}}}
+			if got := OwnerRequest(&tt.u); !reflect.DeepEqual(got, want) {
+				t.Errorf("OwnerRequest() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDependentResourceWatchUpdater(t *testing.T) {
+	owner := &unstructured.Unstructured{}
+	owner.SetGroupVersionKind(oslcGVK)
+	ownerRef := newOwnerRef("keystone", "uid-keystone")
+
+	clusterRole := trackedClusterRole(t, ownerRef)
+	configMap := *newObject("v1", "ConfigMap", "openstack", "keystone-etc", nil)
+	configMap.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+
+	c := &watchController{}
+	mgr := watchManager{mapper: newTestRESTMapper()}
+	updater := BuildDependentResourceWatchUpdater(mgr, owner, c, predicate.Funcs{})
+
+	for i := 0; i < 2; i++ {
+		// The watches are added only once
+		if err := updater([]unstructured.Unstructured{clusterRole, configMap}); err != nil {
+			t.Fatalf("watch updater error = %v", err)
+		}
+	}
+	if len(c.watches) != 2 {
+		t.Fatalf("added %d watches, want 2: %v", len(c.watches), c.watches)
+	}
+
+	for _, w := range c.watches {
+		switch w.kind {
+		case clusterRoleGVK:
+			if _, ok := w.handler.(*handler.EnqueueRequestForOwner); ok {
+				t.Errorf("ClusterRole is watched by owner reference")
+			}
+		case configMapGVK:
+			if _, ok := w.handler.(*handler.EnqueueRequestForOwner); !ok {
+				t.Errorf("ConfigMap is not watched by owner reference: %T", w.handler)
+			}
+		default:
+			t.Errorf("unexpected watch on %s", w.kind)
+		}
+	}
+
+	// The events of the tracked ClusterRole are mapped back to the Oslc
+	watch := c.watches[0]
+	if watch.kind != clusterRoleGVK {
+		t.Fatalf("first watch is on %s, want %s", watch.kind, clusterRoleGVK)
+	}
+	untracked := *newObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "system:auth-delegator", nil)
+	for _, tt := range []struct {
+		name string
+		u    *unstructured.Unstructured
+		want []reconcile.Request
+	}{
+		{name: "tracked", u: &clusterRole,
+			want: []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "openstack", Name: "keystone"}}}},
+		{name: "untracked", u: &untracked, want: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			evt := event.CreateEvent{Object: tt.u}
+			for _, p := range watch.predicates {
+				if !p.Create(evt) {
+					if tt.want != nil {
+						t.Fatalf("tracked ClusterRole filtered out by the predicates")
+					}
+					return
+				}
+			}
+			if tt.want == nil {
+				t.Fatalf("untracked ClusterRole not filtered out by the predicates")
+			}
+
+			queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer queue.ShutDown()
+			watch.handler.Create(evt, queue)
+			got := make([]reconcile.Request, 0)
+			for queue.Len() > 0 {
+				item, _ := queue.Get()
+				got = append(got, item.(reconcile.Request))
+				queue.Done(item)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enqueued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}